@@ -1,19 +1,50 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"github.com/rubenwo/cnn-go/pkg/cnn"
+	"github.com/rubenwo/cnn-go/pkg/cnn/layer"
 	"github.com/rubenwo/cnn-go/pkg/cnn/maths"
 	"github.com/rubenwo/cnn-go/pkg/cnn/metrics"
 	"github.com/rubenwo/cnn-go/pkg/images"
 	"github.com/rubenwo/cnn-go/pkg/mnist"
 	"image"
 	"log"
-	"math/rand"
+	"os"
 	"time"
 )
 
+const modelPath = "./mnist.cnn"
+
 func main() {
-	rand.Seed(time.Now().UnixNano())
+	if f, err := os.Open(modelPath); err == nil {
+		// A trained model exists, validate it instead of training a new one
+		nn, err := cnn.Load(f)
+		f.Close()
+		if err != nil {
+			log.Fatal(err)
+		}
+		valLabels, err := mnist.ReadLabels("./assets/mnist/t10k-labels-idx1-ubyte", 10000)
+		if err != nil {
+			log.Fatal(err)
+		}
+		valImageTensors, err := mnist.ReadGrayImages("./assets/mnist/t10k-images-idx3-ubyte", 10000)
+		if err != nil {
+			log.Fatal(err)
+		}
+		result, err := nn.Validate(valImageTensors, mnist.LabelsToTensors(valLabels))
+		if err != nil {
+			log.Fatal(err)
+		}
+		cnn.NewTextReporter(os.Stdout, 0).Validated(result)
+		fmt.Print(result.Evaluation)
+		return
+	} else if !errors.Is(err, os.ErrNotExist) {
+		log.Fatal(err)
+	}
+
 	labels, err := mnist.ReadLabels("./assets/mnist/train-labels-idx1-ubyte", 60000)
 	if err != nil {
 		log.Fatal(err)
@@ -34,19 +65,64 @@ func main() {
 		log.Fatal(err)
 	}
 
-	nn := cnn.New([]int{28, 28}, 0.005, &metrics.CrossEntropyLoss{})
+	// The seed is printed so the run can be reproduced with cnn.WithSeed
+	seed := time.Now().UnixNano()
+	fmt.Printf("seed: %d\n", seed)
+	nn := cnn.New([]int{28, 28}, cnn.NewSGD(0.005), &metrics.CrossEntropyLoss{}, cnn.WithSeed(seed))
 
 	nn.AddConvolutionLayer([]int{3, 3}, 8).
 		AddMaxPoolingLayer(2, []int{2, 2}).
 		AddFullyConnectedLayer(10). // 0-9
 		AddSoftmaxLayer()
 
-	nn.Fit(imageTensors, labelTensors, valImageTensors, valLabelTensors, 12, 64, true, 100, func() {
-		nn.SetLearningRate(nn.LearningRate() * 0.82)
-	})
+	// The filters are saved before training, to compare them with the trained filters
+	if err := saveFilters(nn, "./filters"); err != nil {
+		log.Fatal(err)
+	}
+
+	nn.SetScheduler(cnn.NewExponentialDecay(cnn.EveryEpoch, 0.005, 0.82))
 
-	nn.Validate(valImageTensors, valLabelTensors)
+	reporter := cnn.NewTextReporter(os.Stdout, len(imageTensors))
+	nn.SetReporter(reporter)
 
+	if _, err := nn.Fit(context.Background(), imageTensors, labelTensors, valImageTensors, valLabelTensors, 12, 64, 100); err != nil {
+		log.Fatal(err)
+	}
+
+	result, err := nn.Validate(valImageTensors, valLabelTensors)
+	if err != nil {
+		log.Fatal(err)
+	}
+	reporter.Validated(result)
+	fmt.Print(result.Evaluation)
+
+	f, err := os.Create(modelPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := nn.Save(f); err != nil {
+		log.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// saveFilters saves the filters of the convolution layers of nn as images to dir
+func saveFilters(nn *cnn.Network, dir string) error {
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		return err
+	}
+	for _, l := range nn.Layers() {
+		if conv, ok := l.(*layer.ConvolutionLayer); ok {
+			n, err := conv.SaveFiltersAsImages(dir)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("Saved %d filters to images\n", n)
+		}
+	}
+	return nil
 }
 
 func readImages() ([]maths.Tensor, []maths.Tensor) {
@@ -0,0 +1,171 @@
+package autograd_test
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/rubenwo/cnn-go/pkg/cnn/autograd"
+	"github.com/rubenwo/cnn-go/pkg/cnn/layer"
+	"github.com/rubenwo/cnn-go/pkg/cnn/maths"
+	"github.com/rubenwo/cnn-go/pkg/cnn/metrics"
+)
+
+// assertEqual fails if got and want differ by more than tolerance in any value
+func assertEqual(t *testing.T, name string, got, want *maths.Tensor, tolerance float64) {
+	t.Helper()
+	if got.Len() != want.Len() {
+		t.Fatalf("%s has %d values, want %d", name, got.Len(), want.Len())
+	}
+	for i := 0; i < want.Len(); i++ {
+		if math.Abs(got.At(i)-want.At(i)) > tolerance {
+			t.Fatalf("%s[%d] is %g, want %g", name, i, got.At(i), want.At(i))
+		}
+	}
+}
+
+// The fused layers compute exactly the same values and gradients as their composition from autograd operations
+
+func TestReLULayerMatchesAutograd(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+	input := randomTensor(random, 4, 3)
+	gradient := randomTensor(random, 4, 3)
+
+	relu := layer.NewReLULayer([]int{4, 3})
+	output, cache := relu.ForwardPropagation(*input, layer.Training)
+	inputGradient := relu.BackwardPropagation(*gradient, cache, nil)
+
+	x := autograd.NewTape().Variable(input)
+	y := autograd.ReLU(x)
+	y.BackwardWith(gradient)
+
+	assertEqual(t, "output", &output, y.Value(), 0)
+	assertEqual(t, "input gradient", &inputGradient, x.Grad(), 0)
+}
+
+func TestFullyConnectedLayerMatchesAutograd(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+	input := randomTensor(random, 3, 2)
+	gradient := randomTensor(random, 5)
+
+	dense := layer.NewFullyConnectedLayer(5, []int{3, 2})
+	parameters := dense.Parameters()
+	weights, biases := parameters[0].Value, parameters[1].Value
+	biases.Apply(func(float64, int) float64 { return random.NormFloat64() })
+	output, cache := dense.ForwardPropagation(*input, layer.Training)
+	grads := []*maths.Tensor{weights.Zeroes(), biases.Zeroes()}
+	inputGradient := dense.BackwardPropagation(*gradient, cache, grads)
+
+	// The weights of size [3, 2, 5] are a 5x6 matrix, the input is used as a 6x1 matrix
+	tape := autograd.NewTape()
+	x, w, b := tape.Variable(input), tape.Variable(weights), tape.Variable(biases)
+	y := autograd.Add(autograd.MatMul(autograd.Reshape(w, 6, 5), autograd.Reshape(x, 1, 6)), autograd.Reshape(b, 1, 5))
+	y.BackwardWith(gradient.Reshape(1, 5))
+
+	assertEqual(t, "output", &output, y.Value(), 0)
+	assertEqual(t, "input gradient", &inputGradient, x.Grad(), 0)
+	assertEqual(t, "weights gradient", grads[0], w.Grad(), 0)
+	assertEqual(t, "biases gradient", grads[1], b.Grad(), 0)
+}
+
+func TestConvolutionLayerMatchesAutograd(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+	inputDims, filterDims, depth := []int{7, 6, 2}, []int{3, 2}, 4
+	strides, padding := []int{2, 1}, []int{1, 0}
+
+	conv := layer.NewConvolutionLayer(filterDims, depth, inputDims,
+		layer.WithStrides(strides...), layer.WithPadding(padding...), layer.WithBias())
+	parameters := conv.Parameters()
+	filters, biases := parameters[0].Value, parameters[1].Value
+	biases.Apply(func(float64, int) float64 { return random.NormFloat64() })
+	input := randomTensor(random, inputDims...)
+	gradient := randomTensor(random, conv.OutputDims()...)
+
+	output, cache := conv.ForwardPropagation(*input, layer.Training)
+	grads := []*maths.Tensor{filters.Zeroes(), biases.Zeroes()}
+	inputGradient := conv.BackwardPropagation(*gradient, cache, grads)
+
+	// The input is lowered to columns by multiplying it with a matrix selecting the input value of every filter
+	// value at every output position, column o*filterLen+k holds the value filter value k is applied to at
+	// position o. The positions and the filter values are in Horner order, like the values of a tensor.
+	outputDims := conv.OutputDims()
+	inputLen := maths.ProductIntSlice(inputDims)
+	mapLen := outputDims[0] * outputDims[1]
+	filterLen := filterDims[0] * filterDims[1] * inputDims[2]
+	selection := maths.NewTensor([]int{inputLen, mapLen * filterLen}, nil)
+	for o := 0; o < mapLen; o++ {
+		y, x := o%outputDims[0], o/outputDims[0]
+		for k := 0; k < filterLen; k++ {
+			i, j, channel := k%filterDims[0], k/filterDims[0]%filterDims[1], k/(filterDims[0]*filterDims[1])
+			row, col := y*strides[0]-padding[0]+i, x*strides[1]-padding[1]+j
+			if row < 0 || row >= inputDims[0] || col < 0 || col >= inputDims[1] {
+				continue
+			}
+			selection.Set([]int{row + inputDims[0]*(col+inputDims[1]*channel), o*filterLen + k}, 1)
+		}
+	}
+
+	tape := autograd.NewTape()
+	in, f, b := tape.Variable(input), tape.Variable(filters), tape.Variable(biases)
+	columns := autograd.Reshape(autograd.MatMul(tape.Constant(selection), autograd.Reshape(in, 1, inputLen)), filterLen, mapLen)
+	// filters (depth x filterLen) * columns^T (filterLen x mapLen) gives a depth x mapLen matrix, every map is stored
+	// one after the other
+	maps := autograd.MatMul(autograd.Reshape(f, filterLen, depth), autograd.Transpose(columns, 0, 1))
+	result := autograd.Add(autograd.Reshape(maps, outputDims...), b)
+	result.BackwardWith(gradient)
+
+	assertEqual(t, "output", &output, result.Value(), 0)
+	assertEqual(t, "input gradient", &inputGradient, in.Grad(), 0)
+	assertEqual(t, "filter gradient", grads[0], f.Grad(), 0)
+	assertEqual(t, "bias gradient", grads[1], b.Grad(), 0)
+}
+
+func TestSoftmaxLayerMatchesAutograd(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+	inputs := []*maths.Tensor{
+		randomTensor(random, 5),
+		randomTensor(random, 3, 2),
+		maths.NewTensor([]int{3}, []float64{1000, 1001, 999.5}),
+	}
+	for _, input := range inputs {
+		gradient := randomTensor(random, input.Dimensions()...)
+
+		softmax := layer.NewSoftmaxLayer(input.Dimensions())
+		output, cache := softmax.ForwardPropagation(*input, layer.Training)
+		inputGradient := softmax.BackwardPropagation(*gradient, cache, nil)
+
+		x := autograd.NewTape().Variable(input)
+		y := autograd.Softmax(x)
+		y.BackwardWith(gradient)
+
+		assertEqual(t, "output", &output, y.Value(), 1e-12)
+		assertEqual(t, "input gradient", &inputGradient, x.Grad(), 1e-12)
+	}
+}
+
+func TestSoftmaxCrossEntropyMatchesAutograd(t *testing.T) {
+	logits := [][]float64{{-1.5, 2, 0.3, 0.1}, {1e3, -1e3, 999, 0}}
+	target := []float64{0, 1, 0, 0}
+	for _, predicted := range logits {
+		for _, smoothing := range []float64{0, 0.2} {
+			loss := &metrics.SoftmaxCrossEntropyLoss{LabelSmoothing: smoothing}
+			lossValues := loss.CalculateLoss(target, predicted)
+			derivative := loss.CalculateLossDerivative(target, predicted)
+
+			// The loss is -sum(t * log(softmax(x))) of the smoothed targets t
+			smoothed := make([]float64, len(target))
+			for i, v := range target {
+				smoothed[i] = v*(1-smoothing) + smoothing/float64(len(target))
+			}
+			tape := autograd.NewTape()
+			x := tape.Variable(maths.NewTensor([]int{len(predicted)}, append([]float64(nil), predicted...)))
+			targets := tape.Constant(maths.NewTensor([]int{len(smoothed)}, smoothed))
+			y := autograd.Neg(autograd.Sum(autograd.Mul(targets, autograd.LogSoftmax(x)), false))
+			y.Backward()
+
+			sum := maths.NewTensor([]int{1}, []float64{maths.SumFloat64Slice(lossValues.Values())})
+			assertEqual(t, "loss", sum, y.Value(), 1e-9)
+			assertEqual(t, "derivative", &derivative, x.Grad(), 1e-12)
+		}
+	}
+}
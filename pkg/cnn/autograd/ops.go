@@ -0,0 +1,242 @@
+package autograd
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/rubenwo/cnn-go/pkg/cnn/maths"
+)
+
+// The binary operations broadcast their operands as described by maths.BroadcastDimensions. The gradient of an
+// operand that was broadcast is summed over the repeated dimensions.
+
+// unbroadcast sums grad over the dimensions that an operand of size dims was repeated along
+func unbroadcast(grad *maths.Tensor, dims []int) *maths.Tensor {
+	gradDims := grad.Dimensions()
+	extra := len(gradDims) - len(dims)
+	var axes []int
+	for i, dim := range gradDims {
+		if i < extra || dims[i-extra] == 1 && dim != 1 {
+			axes = append(axes, i)
+		}
+	}
+	if len(axes) == 0 {
+		return grad
+	}
+	return must(maths.Sum(grad, true, axes...)).Reshape(dims...)
+}
+
+// binary records the result of a broadcasting operation. gradA and gradB return the gradients of a and b before
+// unbroadcasting, given the gradient of the result and the result itself.
+func binary(a, b *Variable, value *maths.Tensor, gradA, gradB func(grad, value *maths.Tensor) *maths.Tensor) *Variable {
+	return result(value, func(grad *maths.Tensor) {
+		if a.requiresGrad {
+			a.accumulate(unbroadcast(gradA(grad, value), a.value.Dimensions()))
+		}
+		if b.requiresGrad {
+			b.accumulate(unbroadcast(gradB(grad, value), b.value.Dimensions()))
+		}
+	}, a, b)
+}
+
+func Add(a, b *Variable) *Variable {
+	return binary(a, b, must(maths.Add(a.value, b.value)),
+		func(grad, _ *maths.Tensor) *maths.Tensor { return grad },
+		func(grad, _ *maths.Tensor) *maths.Tensor { return grad })
+}
+
+func Sub(a, b *Variable) *Variable {
+	return binary(a, b, must(maths.Sub(a.value, b.value)),
+		func(grad, _ *maths.Tensor) *maths.Tensor { return grad },
+		func(grad, _ *maths.Tensor) *maths.Tensor { return grad.MulScalar(-1) })
+}
+
+// Mul returns the elementwise product of a and b.
+func Mul(a, b *Variable) *Variable {
+	return binary(a, b, must(maths.Mul(a.value, b.value)),
+		func(grad, _ *maths.Tensor) *maths.Tensor { return must(maths.Mul(grad, b.value)) },
+		func(grad, _ *maths.Tensor) *maths.Tensor { return must(maths.Mul(grad, a.value)) })
+}
+
+// Div returns the elementwise quotient of a and b.
+func Div(a, b *Variable) *Variable {
+	return binary(a, b, must(maths.Div(a.value, b.value)),
+		func(grad, _ *maths.Tensor) *maths.Tensor { return must(maths.Div(grad, b.value)) },
+		func(grad, value *maths.Tensor) *maths.Tensor {
+			// d(a/b)/db = -(a/b)/b
+			return must(maths.Div(must(maths.Mul(grad, value)), b.value)).MulScalar(-1)
+		})
+}
+
+// Pow returns a to the power b elementwise. The gradient of b is only defined for positive a.
+func Pow(a, b *Variable) *Variable {
+	return binary(a, b, must(maths.Pow(a.value, b.value)),
+		func(grad, _ *maths.Tensor) *maths.Tensor {
+			// d(a^b)/da = b * a^(b-1)
+			exponent := must(maths.Sub(b.value, maths.Scalar(1)))
+			return must(maths.Mul(grad, must(maths.Mul(b.value, must(maths.Pow(a.value, exponent))))))
+		},
+		func(grad, value *maths.Tensor) *maths.Tensor {
+			// d(a^b)/db = a^b * log(a)
+			log := apply(a.value, math.Log)
+			return must(maths.Mul(must(maths.Mul(grad, value)), log))
+		})
+}
+
+// Maximum returns the elementwise maximum of a and b. The gradient is passed to a where a and b are equal.
+func Maximum(a, b *Variable) *Variable {
+	return binary(a, b, must(maths.Maximum(a.value, b.value)),
+		func(grad, _ *maths.Tensor) *maths.Tensor { return selectGrad(grad, a.value, b.value, true) },
+		func(grad, _ *maths.Tensor) *maths.Tensor { return selectGrad(grad, b.value, a.value, false) })
+}
+
+// Minimum returns the elementwise minimum of a and b. The gradient is passed to a where a and b are equal.
+func Minimum(a, b *Variable) *Variable {
+	return binary(a, b, must(maths.Minimum(a.value, b.value)),
+		func(grad, _ *maths.Tensor) *maths.Tensor { return selectGrad(grad, b.value, a.value, true) },
+		func(grad, _ *maths.Tensor) *maths.Tensor { return selectGrad(grad, a.value, b.value, false) })
+}
+
+// selectGrad returns grad where x is larger than y, or equal to y if ties is set, and 0 elsewhere
+func selectGrad(grad, x, y *maths.Tensor, ties bool) *maths.Tensor {
+	mask := must(broadcastCompare(x, y, ties))
+	return must(maths.Mul(grad, mask))
+}
+
+// broadcastCompare returns 1 where x > y, or x >= y if orEqual is set, and 0 elsewhere
+func broadcastCompare(x, y *maths.Tensor, orEqual bool) (*maths.Tensor, error) {
+	diff, err := maths.Sub(x, y)
+	if err != nil {
+		return nil, err
+	}
+	return apply(diff, func(d float64) float64 {
+		if d > 0 || orEqual && d == 0 {
+			return 1
+		}
+		return 0
+	}), nil
+}
+
+// apply returns a new tensor holding fn applied to every value of t
+func apply(t *maths.Tensor, fn func(x float64) float64) *maths.Tensor {
+	values := make([]float64, t.Len())
+	for i, v := range t.Values() {
+		values[i] = fn(v)
+	}
+	return maths.NewTensor(append([]int(nil), t.Dimensions()...), values)
+}
+
+// unary records fn applied to every value of a. derivative returns the derivative of fn at x, with y = fn(x).
+func unary(a *Variable, fn func(x float64) float64, derivative func(x, y float64) float64) *Variable {
+	value := apply(a.value, fn)
+	return result(value, func(grad *maths.Tensor) {
+		x, y, g := a.value.Values(), value.Values(), grad.Values()
+		values := make([]float64, len(g))
+		for i := range values {
+			values[i] = g[i] * derivative(x[i], y[i])
+		}
+		a.accumulate(maths.NewTensor(value.Dimensions(), values))
+	}, a)
+}
+
+func Neg(a *Variable) *Variable {
+	return Scale(a, -1)
+}
+
+// Scale returns a multiplied by factor.
+func Scale(a *Variable, factor float64) *Variable {
+	return unary(a, func(x float64) float64 { return x * factor }, func(_, _ float64) float64 { return factor })
+}
+
+func Exp(a *Variable) *Variable {
+	return unary(a, math.Exp, func(_, y float64) float64 { return y })
+}
+
+func Log(a *Variable) *Variable {
+	return unary(a, math.Log, func(x, _ float64) float64 { return 1 / x })
+}
+
+func Sqrt(a *Variable) *Variable {
+	return unary(a, math.Sqrt, func(_, y float64) float64 { return 0.5 / y })
+}
+
+// ReLU returns max(a, 0) elementwise. The gradient at 0 is 0.
+func ReLU(a *Variable) *Variable {
+	return unary(a, func(x float64) float64 { return math.Max(x, 0) }, func(x, _ float64) float64 {
+		if x > 0 {
+			return 1
+		}
+		return 0
+	})
+}
+
+func Sigmoid(a *Variable) *Variable {
+	return unary(a, maths.Sigmoid, func(_, y float64) float64 { return y * (1 - y) })
+}
+
+func Tanh(a *Variable) *Variable {
+	return unary(a, math.Tanh, func(_, y float64) float64 { return 1 - y*y })
+}
+
+// Reshape returns a with its values in the same Horner order arranged as a tensor of size dims.
+func Reshape(a *Variable, dims ...int) *Variable {
+	return result(a.value.Reshape(dims...), func(grad *maths.Tensor) {
+		a.accumulate(grad.Reshape(a.value.Dimensions()...))
+	}, a)
+}
+
+// Permute returns a with its dimensions reordered: dimension i of the result is dimension axes[i] of a.
+func Permute(a *Variable, axes ...int) *Variable {
+	value := a.value.Permute(axes...).Contiguous()
+	return result(value, func(grad *maths.Tensor) {
+		inverse := make([]int, len(axes))
+		for i, axis := range axes {
+			inverse[axis] = i
+		}
+		a.accumulate(grad.Permute(inverse...).Contiguous())
+	}, a)
+}
+
+// Transpose returns a with dimensions axis1 and axis2 swapped.
+func Transpose(a *Variable, axis1, axis2 int) *Variable {
+	axes := make([]int, len(a.value.Dimensions()))
+	for i := range axes {
+		axes[i] = i
+	}
+	axes[axis1], axes[axis2] = axes[axis2], axes[axis1]
+	return Permute(a, axes...)
+}
+
+// MatMul returns the matrix product of a and b. Both are 2 dimensional tensors used as matrices the way
+// maths.NewMatrix describes: a tensor of size [cols, rows]. So a of size [k, m] times b of size [n, k] gives a
+// result of size [n, m].
+func MatMul(a, b *Variable) *Variable {
+	ma, mb := matrix(a.value), matrix(b.value)
+	value := maths.NewTensor([]int{mb.Cols(), ma.Rows()}, nil)
+	maths.Gemm(false, false, 1, ma, mb, 0, matrix(value))
+
+	return result(value, func(grad *maths.Tensor) {
+		g := matrix(grad)
+		if a.requiresGrad {
+			// grad a = grad * b^T
+			ga := maths.NewTensor(append([]int(nil), a.value.Dimensions()...), nil)
+			maths.Gemm(false, true, 1, g, mb, 0, matrix(ga))
+			a.accumulate(ga)
+		}
+		if b.requiresGrad {
+			// grad b = a^T * grad
+			gb := maths.NewTensor(append([]int(nil), b.value.Dimensions()...), nil)
+			maths.Gemm(true, false, 1, ma, g, 0, matrix(gb))
+			b.accumulate(gb)
+		}
+	}, a, b)
+}
+
+// matrix returns the 2 dimensional tensor t as a matrix sharing its values if t is contiguous
+func matrix(t *maths.Tensor) *maths.Matrix {
+	dims := t.Dimensions()
+	if len(dims) != 2 {
+		panic(fmt.Sprintf("tensor of size %v is not a matrix", dims))
+	}
+	return maths.NewMatrix(dims[1], dims[0], t.Values())
+}
@@ -0,0 +1,173 @@
+package autograd_test
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/rubenwo/cnn-go/pkg/cnn/autograd"
+	"github.com/rubenwo/cnn-go/pkg/cnn/maths"
+)
+
+// randomTensor returns a tensor of size dims with normally distributed values
+func randomTensor(random *rand.Rand, dims ...int) *maths.Tensor {
+	t := maths.NewTensor(dims, nil)
+	t.Apply(func(float64, int) float64 { return random.NormFloat64() })
+	return t
+}
+
+// positiveTensor returns a tensor of size dims with values in [0.5, 2.5)
+func positiveTensor(random *rand.Rand, dims ...int) *maths.Tensor {
+	t := maths.NewTensor(dims, nil)
+	t.Apply(func(float64, int) float64 { return 0.5 + 2*random.Float64() })
+	return t
+}
+
+// inner returns the sum of the products of the values of a and b
+func inner(a, b *maths.Tensor) float64 {
+	sum := 0.0
+	for i := 0; i < a.Len(); i++ {
+		sum += a.At(i) * b.At(i)
+	}
+	return sum
+}
+
+// checkGradients compares the gradients that Backward computes for the inputs of fn with central finite
+// differences of <fn(inputs), w> for random weights w
+func checkGradients(t *testing.T, name string, fn func(x []*autograd.Variable) *autograd.Variable, inputs ...*maths.Tensor) {
+	t.Helper()
+	const epsilon, tolerance = 1e-6, 1e-6
+
+	evaluate := func() (*autograd.Variable, []*autograd.Variable) {
+		tape := autograd.NewTape()
+		variables := make([]*autograd.Variable, len(inputs))
+		for i, input := range inputs {
+			variables[i] = tape.Variable(input)
+		}
+		return fn(variables), variables
+	}
+
+	output, variables := evaluate()
+	weights := randomTensor(rand.New(rand.NewSource(1)), output.Value().Dimensions()...)
+	output.BackwardWith(weights)
+
+	for i, input := range inputs {
+		grad := variables[i].Grad()
+		if grad == nil {
+			t.Errorf("%s: input %d has no gradient", name, i)
+			continue
+		}
+		for j := 0; j < input.Len(); j++ {
+			value := input.At(j)
+			// Results like those of Reshape share the values of the input, so they are used before the input changes
+			input.SetValue(j, value+epsilon)
+			plus, _ := evaluate()
+			objective := inner(plus.Value(), weights)
+			input.SetValue(j, value-epsilon)
+			minus, _ := evaluate()
+			objective -= inner(minus.Value(), weights)
+			input.SetValue(j, value)
+
+			numeric := objective / (2 * epsilon)
+			scale := math.Max(1, math.Max(math.Abs(grad.At(j)), math.Abs(numeric)))
+			if math.Abs(grad.At(j)-numeric)/scale > tolerance {
+				t.Errorf("%s: input %d[%d]: analytic %g, numeric %g", name, i, j, grad.At(j), numeric)
+			}
+		}
+	}
+}
+
+func TestBinaryGradients(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+	tests := []struct {
+		name string
+		fn   func(a, b *autograd.Variable) *autograd.Variable
+		a, b *maths.Tensor
+	}{
+		{name: "Add", fn: autograd.Add, a: randomTensor(random, 3, 4), b: randomTensor(random, 3, 4)},
+		// b is repeated along the missing first dimension and along the dimensions of size 1
+		{name: "Add missing dimension", fn: autograd.Add, a: randomTensor(random, 3, 4), b: randomTensor(random, 4)},
+		{name: "Add size 1", fn: autograd.Add, a: randomTensor(random, 2, 3, 4), b: randomTensor(random, 3, 1)},
+		{name: "Add both broadcast", fn: autograd.Add, a: randomTensor(random, 3, 1), b: randomTensor(random, 1, 4)},
+		{name: "Sub", fn: autograd.Sub, a: randomTensor(random, 3, 1), b: randomTensor(random, 2, 3, 4)},
+		{name: "Mul", fn: autograd.Mul, a: randomTensor(random, 3, 4), b: randomTensor(random, 3, 4)},
+		{name: "Mul broadcast", fn: autograd.Mul, a: randomTensor(random, 2, 3, 4), b: randomTensor(random, 1, 4)},
+		{name: "Mul scalar", fn: autograd.Mul, a: randomTensor(random, 3, 4), b: randomTensor(random, 1)},
+		{name: "Div", fn: autograd.Div, a: randomTensor(random, 3, 4), b: positiveTensor(random, 4)},
+		{name: "Pow", fn: autograd.Pow, a: positiveTensor(random, 3, 4), b: randomTensor(random, 3, 1)},
+		{name: "Maximum", fn: autograd.Maximum, a: randomTensor(random, 3, 4), b: randomTensor(random, 4)},
+		{name: "Minimum", fn: autograd.Minimum, a: randomTensor(random, 3, 4), b: randomTensor(random, 3, 1)},
+		// a of size [k, m] times b of size [n, k]
+		{name: "MatMul", fn: autograd.MatMul, a: randomTensor(random, 3, 4), b: randomTensor(random, 5, 3)},
+		{name: "MatMul vector", fn: autograd.MatMul, a: randomTensor(random, 6, 2), b: randomTensor(random, 1, 6)},
+	}
+	for _, test := range tests {
+		checkGradients(t, test.name, func(x []*autograd.Variable) *autograd.Variable {
+			return test.fn(x[0], x[1])
+		}, test.a, test.b)
+	}
+}
+
+func TestUnaryGradients(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+	// The values of x are at least 0.1 away from 0, where ReLU has a kink
+	x := maths.NewTensor([]int{3, 2}, []float64{-1.3, 0.4, 2.2, -0.1, 0.8, -0.6})
+	tests := []struct {
+		name  string
+		fn    func(a *autograd.Variable) *autograd.Variable
+		input *maths.Tensor
+	}{
+		{name: "Neg", fn: autograd.Neg, input: x},
+		{name: "Scale", fn: func(a *autograd.Variable) *autograd.Variable { return autograd.Scale(a, -2.5) }, input: x},
+		{name: "Exp", fn: autograd.Exp, input: x},
+		{name: "Log", fn: autograd.Log, input: positiveTensor(random, 3, 2)},
+		{name: "Sqrt", fn: autograd.Sqrt, input: positiveTensor(random, 3, 2)},
+		{name: "ReLU", fn: autograd.ReLU, input: x},
+		{name: "Sigmoid", fn: autograd.Sigmoid, input: x},
+		{name: "Tanh", fn: autograd.Tanh, input: x},
+		{name: "Reshape", fn: func(a *autograd.Variable) *autograd.Variable { return autograd.Reshape(a, 2, 3) }, input: x},
+		{name: "Permute", fn: func(a *autograd.Variable) *autograd.Variable { return autograd.Permute(a, 2, 0, 1) }, input: randomTensor(random, 2, 3, 4)},
+		{name: "Transpose", fn: func(a *autograd.Variable) *autograd.Variable { return autograd.Transpose(a, 0, 1) }, input: x},
+		// The gradients of a variable used twice are added
+		{name: "Mul self", fn: func(a *autograd.Variable) *autograd.Variable { return autograd.Mul(a, a) }, input: x},
+	}
+	for _, test := range tests {
+		checkGradients(t, test.name, func(x []*autograd.Variable) *autograd.Variable {
+			return test.fn(x[0])
+		}, test.input)
+	}
+}
+
+func TestReductionGradients(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+	// Normally distributed values have no ties, so Max has a single largest value
+	input := randomTensor(random, 2, 3, 4)
+	reductions := []struct {
+		name string
+		fn   func(a *autograd.Variable, keepDims bool, axes ...int) *autograd.Variable
+	}{
+		{name: "Sum", fn: autograd.Sum},
+		{name: "Mean", fn: autograd.Mean},
+		{name: "Var", fn: autograd.Var},
+		{name: "Max", fn: autograd.Max},
+		{name: "LogSumExp", fn: autograd.LogSumExp},
+	}
+	for _, reduction := range reductions {
+		for _, axes := range [][]int{nil, {0}, {1}, {0, 2}} {
+			for _, keepDims := range []bool{false, true} {
+				checkGradients(t, reduction.name, func(x []*autograd.Variable) *autograd.Variable {
+					return reduction.fn(x[0], keepDims, axes...)
+				}, input)
+			}
+		}
+	}
+
+	for _, axes := range [][]int{nil, {2}} {
+		checkGradients(t, "Softmax", func(x []*autograd.Variable) *autograd.Variable {
+			return autograd.Softmax(x[0], axes...)
+		}, input)
+		checkGradients(t, "LogSoftmax", func(x []*autograd.Variable) *autograd.Variable {
+			return autograd.LogSoftmax(x[0], axes...)
+		}, input)
+	}
+}
@@ -0,0 +1,83 @@
+package autograd
+
+import (
+	"math"
+
+	"github.com/rubenwo/cnn-go/pkg/cnn/maths"
+)
+
+// The reductions combine the values of a variable along axes like the reductions of the maths package: without
+// axes all dimensions are reduced, and the reduced dimensions are kept with size 1 if keepDims is set.
+
+// keptDims returns the dimensions of a with the reduced axes set to 1
+func keptDims(a *Variable, axes []int) []int {
+	dims := append([]int(nil), a.value.Dimensions()...)
+	if len(axes) == 0 {
+		for i := range dims {
+			dims[i] = 1
+		}
+	}
+	for _, axis := range axes {
+		dims[axis] = 1
+	}
+	return dims
+}
+
+// expand returns grad, the gradient of a reduction of a, repeated along the reduced axes to the size of a
+func expand(grad *maths.Tensor, a *Variable, axes []int) *maths.Tensor {
+	zeroes := maths.NewTensor(append([]int(nil), a.value.Dimensions()...), nil)
+	return must(maths.Add(zeroes, grad.Reshape(keptDims(a, axes)...)))
+}
+
+// Sum returns the sum of the values of a along axes.
+func Sum(a *Variable, keepDims bool, axes ...int) *Variable {
+	return result(must(maths.Sum(a.value, keepDims, axes...)), func(grad *maths.Tensor) {
+		a.accumulate(expand(grad, a, axes))
+	}, a)
+}
+
+// Mean returns the mean of the values of a along axes.
+func Mean(a *Variable, keepDims bool, axes ...int) *Variable {
+	value := must(maths.Mean(a.value, keepDims, axes...))
+	count := float64(a.value.Len() / value.Len())
+	return result(value, func(grad *maths.Tensor) {
+		a.accumulate(expand(grad, a, axes).MulScalar(1 / count))
+	}, a)
+}
+
+// Var returns the population variance of the values of a along axes.
+func Var(a *Variable, keepDims bool, axes ...int) *Variable {
+	diff := Sub(a, Mean(a, true, axes...))
+	return Mean(Mul(diff, diff), keepDims, axes...)
+}
+
+// Max returns the largest value of a along axes. The gradient is passed to every position holding the largest
+// value.
+func Max(a *Variable, keepDims bool, axes ...int) *Variable {
+	value := must(maths.Max(a.value, keepDims, axes...))
+	return result(value, func(grad *maths.Tensor) {
+		mask := must(broadcastCompare(a.value, value.Reshape(keptDims(a, axes)...), true))
+		a.accumulate(must(maths.Mul(expand(grad, a, axes), mask)))
+	}, a)
+}
+
+// LogSumExp returns log(sum(exp(x))) of the values x of a along axes, computed without overflowing for large values.
+func LogSumExp(a *Variable, keepDims bool, axes ...int) *Variable {
+	value := must(maths.LogSumExp(a.value, keepDims, axes...))
+	return result(value, func(grad *maths.Tensor) {
+		// The derivative is the softmax of a along axes: exp(x - logsumexp(x))
+		softmax := must(maths.Sub(a.value, value.Reshape(keptDims(a, axes)...)))
+		softmax = apply(softmax, math.Exp)
+		a.accumulate(must(maths.Mul(expand(grad, a, axes), softmax)))
+	}, a)
+}
+
+// LogSoftmax returns the logarithm of the softmax of a along axes.
+func LogSoftmax(a *Variable, axes ...int) *Variable {
+	return Sub(a, LogSumExp(a, true, axes...))
+}
+
+// Softmax returns exp(x) / sum(exp(x)) of the values x of a along axes.
+func Softmax(a *Variable, axes ...int) *Variable {
+	return Exp(LogSoftmax(a, axes...))
+}
@@ -0,0 +1,146 @@
+// Package autograd computes gradients of functions composed of tensor operations.
+// Every operation on a Variable records its result on the Tape of its operands. Backward walks the tape in reverse
+// and adds the gradient of every recorded Variable to the gradients of its operands, so after a call to Backward
+// every Variable that contributed to the result holds its gradient.
+// Operations panic on operands with incompatible sizes, like the operations of the maths package. A Tape is not
+// safe for concurrent use.
+package autograd
+
+import (
+	"fmt"
+
+	"github.com/rubenwo/cnn-go/pkg/cnn/maths"
+)
+
+// Tape records the variables created by operations in the order they were computed.
+type Tape struct {
+	variables []*Variable
+}
+
+func NewTape() *Tape {
+	return &Tape{}
+}
+
+// Variable is a tensor recorded on a tape.
+type Variable struct {
+	tape  *Tape
+	value *maths.Tensor
+	grad  *maths.Tensor
+
+	// requiresGrad is set for variables created by Variable and for the results of operations on them
+	requiresGrad bool
+	// backward adds the gradient of the result in grad to the gradients of the operands, it is nil for leaves
+	backward func(grad *maths.Tensor)
+}
+
+// Variable records value as a leaf of the tape, Backward computes its gradient.
+func (t *Tape) Variable(value *maths.Tensor) *Variable {
+	return t.record(value, true, nil)
+}
+
+// Constant records value as a leaf of the tape that no gradient is computed for.
+func (t *Tape) Constant(value *maths.Tensor) *Variable {
+	return t.record(value, false, nil)
+}
+
+// Scalar records v as a constant of size [1], which can be broadcast against any variable.
+func (t *Tape) Scalar(v float64) *Variable {
+	return t.Constant(maths.Scalar(v))
+}
+
+func (t *Tape) record(value *maths.Tensor, requiresGrad bool, backward func(grad *maths.Tensor)) *Variable {
+	v := &Variable{tape: t, value: value, requiresGrad: requiresGrad, backward: backward}
+	t.variables = append(t.variables, v)
+	return v
+}
+
+// ZeroGrads removes the gradients of all variables on the tape, so the tape can be used for another Backward.
+func (t *Tape) ZeroGrads() {
+	for _, v := range t.variables {
+		v.grad = nil
+	}
+}
+
+// Value returns the tensor held by v. It must not be modified while v is used in the tape.
+func (v *Variable) Value() *maths.Tensor { return v.value }
+
+// Grad returns the gradient computed for v by Backward, which has the same size as v. It is nil if v did not
+// contribute to the result or Backward has not been called.
+func (v *Variable) Grad() *maths.Tensor { return v.grad }
+
+func (v *Variable) RequiresGrad() bool { return v.requiresGrad }
+
+// Backward computes the gradients of the sum of the values of v with respect to all variables recorded before v.
+// For a single valued v these are the gradients of v itself.
+func (v *Variable) Backward() {
+	seed := maths.NewTensor(append([]int(nil), v.value.Dimensions()...), nil)
+	seed.Apply(func(float64, int) float64 { return 1 })
+	v.BackwardWith(seed)
+}
+
+// BackwardWith computes the gradients of the inner product of v and grad with respect to all variables recorded
+// before v: grad is the gradient of some function of v, which is propagated to the operands of v.
+// The gradients of leaves are added to those of earlier calls until ZeroGrads is called.
+func (v *Variable) BackwardWith(grad *maths.Tensor) {
+	if grad.Len() != v.value.Len() {
+		panic(fmt.Sprintf("gradient of size %v does not match variable of size %v", grad.Dimensions(), v.value.Dimensions()))
+	}
+
+	tape := v.tape.variables
+	for i := len(tape) - 1; i >= 0; i-- {
+		if tape[i] == v {
+			tape = tape[:i+1]
+			break
+		}
+	}
+	// The gradients of results of operations were propagated by an earlier call already
+	for _, u := range tape {
+		if u.backward != nil {
+			u.grad = nil
+		}
+	}
+
+	v.accumulate(grad)
+	for i := len(tape) - 1; i >= 0; i-- {
+		if u := tape[i]; u.grad != nil && u.backward != nil {
+			u.backward(u.grad)
+		}
+	}
+}
+
+// accumulate adds grad to the gradient of v
+func (v *Variable) accumulate(grad *maths.Tensor) {
+	if !v.requiresGrad {
+		return
+	}
+	if v.grad == nil {
+		v.grad = maths.NewTensor(append([]int(nil), v.value.Dimensions()...), append([]float64(nil), grad.Values()...))
+		return
+	}
+	v.grad = v.grad.Add(grad, 1)
+}
+
+// result records value as the result of an operation on operands. backward is only called if an operand requires
+// a gradient.
+func result(value *maths.Tensor, backward func(grad *maths.Tensor), operands ...*Variable) *Variable {
+	tape := operands[0].tape
+	requiresGrad := false
+	for _, operand := range operands {
+		if operand.tape != tape {
+			panic("operands of an autograd operation are recorded on different tapes")
+		}
+		requiresGrad = requiresGrad || operand.requiresGrad
+	}
+	if !requiresGrad {
+		backward = nil
+	}
+	return tape.record(value, requiresGrad, backward)
+}
+
+// must panics if err is set, the operations of this package panic on incompatible sizes
+func must(t *maths.Tensor, err error) *maths.Tensor {
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
@@ -0,0 +1,159 @@
+package cnn
+
+import (
+	"encoding/csv"
+	"errors"
+	"io"
+	"math"
+	"strconv"
+)
+
+var (
+	// ErrStopTraining can be returned by a Callback to stop training early. Fit returns a nil error in that case.
+	ErrStopTraining = errors.New("cnn: stop training")
+	// ErrNaNLoss is returned by TerminateOnNaN when the loss becomes NaN or infinite.
+	ErrNaNLoss = errors.New("cnn: loss is NaN or infinite")
+)
+
+// Callback is notified of the progress of Fit.
+// When a method returns an error, training stops and Fit returns that error, unless it is ErrStopTraining.
+// OnTrainEnd is always called once training has stopped.
+type Callback interface {
+	OnTrainBegin(n *Network) error
+	OnEpochBegin(n *Network, epoch int) error
+	OnBatchEnd(n *Network, metrics BatchMetrics) error
+	OnEpochEnd(n *Network, metrics EpochMetrics) error
+	OnTrainEnd(n *Network, history *History) error
+}
+
+// BatchMetrics are the training metrics of a single batch.
+type BatchMetrics struct {
+	Epoch int
+	// Batch is the number of completed batches, counted over all epochs
+	Batch        int
+	Size         int
+	Loss         float64
+	Accuracy     float64
+	LearningRate float64
+}
+
+// BaseCallback implements every method of Callback as a no-op. Embed it to only implement the methods you need.
+type BaseCallback struct{}
+
+func (BaseCallback) OnTrainBegin(n *Network) error                     { return nil }
+func (BaseCallback) OnEpochBegin(n *Network, epoch int) error          { return nil }
+func (BaseCallback) OnBatchEnd(n *Network, metrics BatchMetrics) error { return nil }
+func (BaseCallback) OnEpochEnd(n *Network, metrics EpochMetrics) error { return nil }
+func (BaseCallback) OnTrainEnd(n *Network, history *History) error     { return nil }
+
+// EarlyStopping stops training when the monitored loss has not improved by more than minDelta for patience
+// consecutive epochs. With patience 0 training stops at the first epoch that does not improve the loss.
+// The validation loss is monitored when Fit is given validation data, the training loss otherwise.
+// If restoreBestWeights is true the network is reset to the weights of the best epoch when training ends, including
+// the state of layer.Stateful layers like the running statistics of a BatchNormLayer.
+type EarlyStopping struct {
+	BaseCallback
+
+	patience           int
+	minDelta           float64
+	restoreBestWeights bool
+
+	bestLoss    float64
+	bestEpoch   int
+	bestWeights [][]float64 // a copy of the parameters and the state of the layers, see Network.snapshot
+	wait        int
+}
+
+func NewEarlyStopping(patience int, minDelta float64, restoreBestWeights bool) *EarlyStopping {
+	return &EarlyStopping{patience: patience, minDelta: minDelta, restoreBestWeights: restoreBestWeights}
+}
+
+func (e *EarlyStopping) OnTrainBegin(n *Network) error {
+	e.bestLoss = math.Inf(1)
+	e.bestEpoch = -1
+	e.bestWeights = nil
+	e.wait = 0
+	return nil
+}
+
+func (e *EarlyStopping) OnEpochEnd(n *Network, metrics EpochMetrics) error {
+	loss := metrics.Loss
+	if metrics.Validation != nil {
+		loss = metrics.Validation.Loss
+	}
+
+	if loss < e.bestLoss-e.minDelta {
+		e.bestLoss = loss
+		e.bestEpoch = metrics.Epoch
+		e.wait = 0
+		if e.restoreBestWeights {
+			e.bestWeights = n.snapshot()
+		}
+		return nil
+	}
+
+	e.wait++
+	if e.wait >= e.patience {
+		return ErrStopTraining
+	}
+	return nil
+}
+
+func (e *EarlyStopping) OnTrainEnd(n *Network, history *History) error {
+	if !e.restoreBestWeights || e.bestWeights == nil {
+		return nil
+	}
+	n.restore(e.bestWeights)
+	return nil
+}
+
+// BestEpoch returns the epoch with the lowest monitored loss, -1 if no epoch has completed.
+func (e *EarlyStopping) BestEpoch() int { return e.bestEpoch }
+
+// TerminateOnNaN stops training with ErrNaNLoss as soon as the loss of a batch is NaN or infinite.
+type TerminateOnNaN struct {
+	BaseCallback
+}
+
+func (TerminateOnNaN) OnBatchEnd(n *Network, metrics BatchMetrics) error {
+	if math.IsNaN(metrics.Loss) || math.IsInf(metrics.Loss, 0) {
+		return ErrNaNLoss
+	}
+	return nil
+}
+
+// CSVLogger writes the metrics of every epoch to w as comma separated values, starting with a header.
+type CSVLogger struct {
+	BaseCallback
+	w *csv.Writer
+}
+
+func NewCSVLogger(w io.Writer) *CSVLogger {
+	return &CSVLogger{w: csv.NewWriter(w)}
+}
+
+func (c *CSVLogger) OnTrainBegin(n *Network) error {
+	c.w.Write([]string{"epoch", "loss", "accuracy", "learning_rate", "val_loss", "val_accuracy", "seconds"})
+	c.w.Flush()
+	return c.w.Error()
+}
+
+func (c *CSVLogger) OnEpochEnd(n *Network, metrics EpochMetrics) error {
+	float := func(f float64) string { return strconv.FormatFloat(f, 'g', -1, 64) }
+
+	valLoss, valAccuracy := "", ""
+	if metrics.Validation != nil {
+		valLoss, valAccuracy = float(metrics.Validation.Loss), float(metrics.Validation.Accuracy)
+	}
+	c.w.Write([]string{
+		strconv.Itoa(metrics.Epoch),
+		float(metrics.Loss),
+		float(metrics.Accuracy),
+		float(metrics.LearningRate),
+		valLoss,
+		valAccuracy,
+		float(metrics.Duration.Seconds()),
+	})
+	c.w.Flush()
+	return c.w.Error()
+}
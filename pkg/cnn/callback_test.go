@@ -0,0 +1,191 @@
+package cnn
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"errors"
+	"math"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/rubenwo/cnn-go/pkg/cnn/layer"
+	"github.com/rubenwo/cnn-go/pkg/cnn/metrics"
+)
+
+func TestEarlyStoppingPatience(t *testing.T) {
+	tests := []struct {
+		patience int
+		losses   []float64
+		stop     int
+	}{
+		{patience: 0, losses: []float64{3, 2, 2}, stop: 2},
+		{patience: 1, losses: []float64{3, 2, 2}, stop: 2},
+		{patience: 2, losses: []float64{3, 2, 2, 1, 1, 1}, stop: 5},
+		{patience: 2, losses: []float64{3, 2, 2.5, 1, 1.5}, stop: -1},
+	}
+	for _, test := range tests {
+		e := NewEarlyStopping(test.patience, 0, false)
+		if err := e.OnTrainBegin(nil); err != nil {
+			t.Fatal(err)
+		}
+		stop := -1
+		for epoch, loss := range test.losses {
+			if err := e.OnEpochEnd(nil, EpochMetrics{Epoch: epoch, Loss: loss}); err == ErrStopTraining {
+				stop = epoch
+				break
+			}
+		}
+		if stop != test.stop {
+			t.Errorf("patience %d, losses %v: stopped at epoch %d, want %d", test.patience, test.losses, stop, test.stop)
+		}
+	}
+}
+
+func TestEarlyStoppingRestoresLayerState(t *testing.T) {
+	n := New([]int{4}, NewSGD(0.1), &metrics.CrossEntropyLoss{}, WithSeed(1))
+	n.AddFullyConnectedLayer(3).AddBatchNormLayer().AddSoftmaxLayer()
+	stats := n.layers[1].(layer.Stateful).State()
+
+	e := NewEarlyStopping(5, 0, true)
+	if err := e.OnTrainBegin(n); err != nil {
+		t.Fatal(err)
+	}
+	stats[0][0] = 0.5
+	want := n.snapshot()
+	if err := e.OnEpochEnd(n, EpochMetrics{Epoch: 0, Loss: 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	// A worse epoch changes the weights and the running statistics
+	for _, p := range n.parameters() {
+		p.Value.SetValue(0, 7)
+	}
+	stats[0][0], stats[1][0] = 3, 4
+	if err := e.OnEpochEnd(n, EpochMetrics{Epoch: 1, Loss: 2}); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.OnTrainEnd(n, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	for i, values := range n.snapshot() {
+		for j, v := range values {
+			if v != want[i][j] {
+				t.Fatalf("value %d of snapshot entry %d is %g after restoring, want %g", j, i, v, want[i][j])
+			}
+		}
+	}
+}
+
+// newCallbackNetwork returns a small network for the 8x8 inputs of testData
+func newCallbackNetwork() *Network {
+	n := New([]int{8, 8}, NewSGD(0.1), &metrics.CrossEntropyLoss{}, WithSeed(1))
+	n.AddFullyConnectedLayer(4).AddSoftmaxLayer()
+	return n
+}
+
+func TestFitStopsWhenCancelled(t *testing.T) {
+	inputs, labels := testData(20)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	recorder := &batchRecorder{}
+	history, err := newCallbackNetwork().Fit(ctx, inputs, labels, nil, nil, 3, 4, 0, cancelAfter{batch: 7, cancel: cancel}, recorder)
+	if err != context.Canceled {
+		t.Fatalf("Fit returned %v, want %v", err, context.Canceled)
+	}
+	// The first epoch has 5 batches, training stops after the second batch of the second epoch
+	if len(recorder.batches) != 7 || len(history.Epochs) != 1 {
+		t.Errorf("trained %d batches and %d epochs, want 7 and 1", len(recorder.batches), len(history.Epochs))
+	}
+
+	// A context that is already cancelled stops Fit before the first batch
+	recorder = &batchRecorder{}
+	history, err = newCallbackNetwork().Fit(ctx, inputs, labels, nil, nil, 3, 4, 0, recorder)
+	if err != context.Canceled {
+		t.Fatalf("Fit returned %v, want %v", err, context.Canceled)
+	}
+	if len(recorder.batches) != 0 || len(history.Epochs) != 0 {
+		t.Errorf("trained %d batches and %d epochs with a cancelled context", len(recorder.batches), len(history.Epochs))
+	}
+}
+
+func TestTerminateOnNaN(t *testing.T) {
+	for _, loss := range []float64{math.NaN(), math.Inf(1), math.Inf(-1)} {
+		if err := (TerminateOnNaN{}).OnBatchEnd(nil, BatchMetrics{Loss: loss}); err != ErrNaNLoss {
+			t.Errorf("loss %g returned %v, want %v", loss, err, ErrNaNLoss)
+		}
+	}
+	if err := (TerminateOnNaN{}).OnBatchEnd(nil, BatchMetrics{Loss: 1e300}); err != nil {
+		t.Errorf("a finite loss returned %v", err)
+	}
+
+	// A NaN input makes the loss of every batch NaN, training stops after the first one
+	inputs, labels := testData(8)
+	for i := range inputs {
+		inputs[i].SetValue(0, math.NaN())
+	}
+	recorder := &batchRecorder{}
+	history, err := newCallbackNetwork().Fit(context.Background(), inputs, labels, nil, nil, 2, 4, 0, TerminateOnNaN{}, recorder)
+	if !errors.Is(err, ErrNaNLoss) {
+		t.Fatalf("Fit returned %v, want %v", err, ErrNaNLoss)
+	}
+	if len(recorder.batches) != 1 || len(history.Epochs) != 0 {
+		t.Errorf("trained %d batches and %d epochs after a NaN loss", len(recorder.batches), len(history.Epochs))
+	}
+}
+
+func TestCSVLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewCSVLogger(&buf)
+	if err := logger.OnTrainBegin(nil); err != nil {
+		t.Fatal(err)
+	}
+	epochs := []EpochMetrics{
+		{Epoch: 0, Loss: 1.5, Accuracy: 0.25, LearningRate: 0.1, Duration: 1500 * time.Millisecond},
+		{Epoch: 1, Loss: 0.75, Accuracy: 0.5, LearningRate: 0.05, Duration: 2 * time.Second,
+			Validation: &EvaluationResult{Count: 10, Loss: 0.875, Accuracy: 0.4}},
+	}
+	for _, m := range epochs {
+		if err := logger.OnEpochEnd(nil, m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Epochs without validation leave the validation columns empty
+	const want = `epoch,loss,accuracy,learning_rate,val_loss,val_accuracy,seconds
+0,1.5,0.25,0.1,,,1.5
+1,0.75,0.5,0.05,0.875,0.4,2
+`
+	if got := buf.String(); got != want {
+		t.Errorf("CSVLogger wrote\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestCSVLoggerDuringFit(t *testing.T) {
+	inputs, labels := testData(12)
+	valInputs, valLabels := testData(4)
+	var buf bytes.Buffer
+	history, err := newCallbackNetwork().Fit(context.Background(), inputs, labels, valInputs, valLabels, 3, 4, 0, NewCSVLogger(&buf))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1+len(history.Epochs) || records[0][0] != "epoch" {
+		t.Fatalf("CSVLogger wrote %d records starting with %v, want a header and %d epochs", len(records),
+			records[0], len(history.Epochs))
+	}
+	for i, m := range history.Epochs {
+		record := records[i+1]
+		want := []float64{float64(m.Epoch), m.Loss, m.Accuracy, m.LearningRate, m.Validation.Loss, m.Validation.Accuracy}
+		for j, w := range want {
+			if v, err := strconv.ParseFloat(record[j], 64); err != nil || v != w {
+				t.Errorf("epoch %d: column %s is %q, want %g", i, records[0][j], record[j], w)
+			}
+		}
+	}
+}
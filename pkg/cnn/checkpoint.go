@@ -0,0 +1,396 @@
+package cnn
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/rubenwo/cnn-go/pkg/cnn/internal/codec"
+	"github.com/rubenwo/cnn-go/pkg/cnn/layer"
+	"github.com/rubenwo/cnn-go/pkg/cnn/maths"
+)
+
+// A checkpoint uses the same envelope as the model format (see model.go) with its own magic.
+// The payload contains the model, the state of the optimizer and scheduler, the state of the random number
+// generator and the progress of Fit.
+const (
+	checkpointMagic   = "CNNC"
+	checkpointVersion = 1
+
+	// BestCheckpoint is the name of the checkpoint with the highest validation accuracy in a checkpoint directory.
+	BestCheckpoint = "best.ckpt"
+)
+
+// CheckpointConfig configures the checkpoints Fit writes.
+// A checkpoint is written at the end of every epoch and, if Every > 0, every Every batches.
+type CheckpointConfig struct {
+	// Dir is the directory checkpoints are written to. An empty Dir disables checkpointing.
+	Dir string
+	// Every is the number of batches between checkpoints within an epoch, 0 to only write checkpoints at the
+	// end of an epoch.
+	Every int
+	// Keep is the number of most recent checkpoints that are kept, older checkpoints are removed.
+	// 0 keeps all checkpoints. The checkpoint with the best validation accuracy is always kept as BestCheckpoint.
+	Keep int
+}
+
+// SetCheckpointing enables writing checkpoints during Fit.
+func (n *Network) SetCheckpointing(config CheckpointConfig) {
+	n.checkpoints = config
+}
+
+// Resume continues the training run that wrote the checkpoint at path.
+// n has to be built with the same layers, optimizer and scheduler as the network that wrote the checkpoint,
+// and the other arguments have to be the same as the ones that were passed to Fit. Training then continues
+// exactly as if it was never interrupted.
+// The returned History includes the epochs that were completed before the checkpoint was written.
+// ctx and callbacks behave as they do for Fit.
+func (n *Network) Resume(ctx context.Context, path string, inputs, labels, valInputs, valLabels []maths.Tensor, epochs int, batchSize int, logRate int, callbacks ...Callback) (*History, error) {
+	if len(labels) != len(inputs) {
+		panic("length of labels is not equal to length of inputs")
+	}
+	if batchSize < 1 {
+		panic("batchSize must be at least 1")
+	}
+
+	p, err := n.loadCheckpoint(path)
+	if err != nil {
+		return nil, err
+	}
+	if p.order != nil && len(p.order) != len(inputs) {
+		return nil, fmt.Errorf("cnn: checkpoint was written while training on %d inputs, got %d", len(p.order), len(inputs))
+	}
+
+	return n.train(ctx, p, inputs, labels, valInputs, valLabels, epochs, batchSize, logRate, callbacks)
+}
+
+// LatestCheckpoint returns the path of the most recent checkpoint in dir.
+func LatestCheckpoint(dir string) (string, error) {
+	paths, err := checkpointPaths(dir)
+	if err != nil {
+		return "", err
+	}
+	if len(paths) == 0 {
+		return "", fmt.Errorf("cnn: no checkpoints in %s", dir)
+	}
+	return paths[len(paths)-1], nil
+}
+
+// checkpointPaths returns the paths of all checkpoints in dir from oldest to newest
+func checkpointPaths(dir string) ([]string, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "checkpoint-*.ckpt"))
+	if err != nil {
+		return nil, err
+	}
+	// The names are zero padded, so the lexical order is the order in which they were written
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// checkpoint writes a checkpoint if checkpointing is enabled, and saves it as the best checkpoint if best is true.
+func (n *Network) checkpoint(p *progress, best bool) error {
+	if n.checkpoints.Dir == "" {
+		return nil
+	}
+	if err := n.writeCheckpoint(p, best); err != nil {
+		return fmt.Errorf("cnn: writing checkpoint: %w", err)
+	}
+	return nil
+}
+
+func (n *Network) writeCheckpoint(p *progress, best bool) error {
+	if err := os.MkdirAll(n.checkpoints.Dir, 0755); err != nil {
+		return err
+	}
+
+	var payload bytes.Buffer
+	if err := n.marshalCheckpoint(codec.NewWriter(&payload), p); err != nil {
+		return err
+	}
+	var file bytes.Buffer
+	if err := writeEnvelope(&file, checkpointMagic, checkpointVersion, payload.Bytes()); err != nil {
+		return err
+	}
+
+	name := fmt.Sprintf("checkpoint-%06d-%09d.ckpt", p.epoch, p.schedule.Batch)
+	if err := writeFileAtomic(filepath.Join(n.checkpoints.Dir, name), file.Bytes()); err != nil {
+		return err
+	}
+	if best {
+		if err := writeFileAtomic(filepath.Join(n.checkpoints.Dir, BestCheckpoint), file.Bytes()); err != nil {
+			return err
+		}
+	}
+
+	if n.checkpoints.Keep <= 0 {
+		return nil
+	}
+	paths, err := checkpointPaths(n.checkpoints.Dir)
+	if err != nil {
+		return err
+	}
+	for len(paths) > n.checkpoints.Keep {
+		if err := os.Remove(paths[0]); err != nil {
+			return err
+		}
+		paths = paths[1:]
+	}
+	return nil
+}
+
+// writeFileAtomic writes data to a temporary file and renames it to path, so path never contains a partial file
+func writeFileAtomic(path string, data []byte) error {
+	f, err := ioutil.TempFile(filepath.Dir(path), ".tmp-checkpoint-")
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+func (n *Network) marshalCheckpoint(w *codec.Writer, p *progress) error {
+	var model bytes.Buffer
+	if err := n.marshal(codec.NewWriter(&model)); err != nil {
+		return err
+	}
+	optimizer, err := marshalOptional(n.optimizer)
+	if err != nil {
+		return err
+	}
+	var scheduler []byte
+	if n.scheduler != nil {
+		if scheduler, err = marshalOptional(n.scheduler); err != nil {
+			return err
+		}
+	}
+
+	w.Bytes(model.Bytes())
+	w.Bytes(optimizer)
+	w.Bytes(scheduler)
+	w.Float(n.LearningRate())
+	var randomState uint64
+	if source, ok := n.random.(statefulSource); ok {
+		randomState = source.State()
+	}
+	w.Uint64(randomState)
+
+	w.Int(p.epoch)
+	w.Int(p.position)
+	w.Bool(p.order != nil)
+	w.Ints(p.order)
+	w.Float(p.epochLoss)
+	w.Float(p.epochCorrect)
+	w.Int(int(p.epochElapsed))
+	w.Float(p.logLoss)
+	w.Float(p.logAccuracy)
+	w.Int(p.schedule.Epoch)
+	w.Int(p.schedule.Batch)
+	w.Float(p.schedule.TrainingLoss)
+	w.Float(p.schedule.ValidationLoss)
+	w.Bool(p.schedule.Validated)
+	w.Float(p.bestAccuracy)
+	writeHistory(w, p.history)
+	return w.Err()
+}
+
+// loadCheckpoint restores the network, optimizer, scheduler and random number generator from the checkpoint at path
+// and returns the progress of Fit at the moment the checkpoint was written. If the checkpoint can not be restored,
+// the network is left unchanged.
+func (n *Network) loadCheckpoint(path string) (*progress, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	_, payload, err := readEnvelope(bytes.NewReader(data), checkpointMagic, checkpointVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	r := codec.NewReader(bytes.NewReader(payload))
+	model := r.Bytes()
+	optimizer := r.Bytes()
+	scheduler := r.Bytes()
+	learningRate := r.Float()
+	randomState := r.Uint64()
+
+	p := &progress{}
+	p.epoch = r.Int()
+	p.position = r.Int()
+	hasOrder := r.Bool()
+	p.order = r.Ints()
+	if !hasOrder {
+		p.order = nil
+	}
+	p.epochLoss = r.Float()
+	p.epochCorrect = r.Float()
+	p.epochElapsed = time.Duration(r.Int())
+	p.logLoss = r.Float()
+	p.logAccuracy = r.Float()
+	p.schedule.Epoch = r.Int()
+	p.schedule.Batch = r.Int()
+	p.schedule.TrainingLoss = r.Float()
+	p.schedule.ValidationLoss = r.Float()
+	p.schedule.Validated = r.Bool()
+	p.bestAccuracy = r.Float()
+	p.history = readHistory(r)
+	if err := r.Err(); err != nil {
+		return nil, err
+	}
+
+	// A checkpoint is only resumed by the version that wrote it, so the model is in the current format
+	restored := &Network{}
+	if err := restored.unmarshal(model, modelVersion); err != nil {
+		return nil, err
+	}
+	if len(restored.layers) != len(n.layers) {
+		return nil, errors.New("cnn: the checkpoint was written by a network with different layers")
+	}
+	for i, l := range restored.layers {
+		if err := checkParameters(l.Parameters(), n.layers[i].Parameters()); err != nil {
+			return nil, fmt.Errorf("cnn: the checkpoint was written by a network with different layers: layer %d: %w", i, err)
+		}
+	}
+	if err := n.restoreTrainingState(optimizer, scheduler, restored.parameters()); err != nil {
+		return nil, err
+	}
+
+	n.inputDims = restored.inputDims
+	n.layers = restored.layers
+	n.loss = restored.loss
+	n.SetLearningRate(learningRate)
+	if source, ok := n.random.(statefulSource); ok {
+		source.SetState(randomState)
+	}
+	return p, nil
+}
+
+// restoreTrainingState restores the state of the optimizer and the scheduler and checks that the optimizer state
+// matches params. They are restored in place, so when that fails their previous state is restored and the error is
+// returned.
+func (n *Network) restoreTrainingState(optimizer, scheduler []byte, params []*layer.Parameter) error {
+	targets, data := []interface{}{n.optimizer}, [][]byte{optimizer}
+	if n.scheduler != nil {
+		targets, data = append(targets, n.scheduler), append(data, scheduler)
+	}
+	previous := make([][]byte, len(targets))
+	for i, target := range targets {
+		var err error
+		if previous[i], err = marshalOptional(target); err != nil {
+			return err
+		}
+	}
+
+	err := unmarshalOptional(n.optimizer, optimizer)
+	if c, ok := n.optimizer.(stateChecker); ok && err == nil {
+		err = c.checkState(params)
+	}
+	if err == nil && n.scheduler != nil {
+		err = unmarshalOptional(n.scheduler, scheduler)
+	}
+	if err != nil {
+		for i, target := range targets {
+			unmarshalOptional(target, previous[i])
+		}
+	}
+	return err
+}
+
+func writeHistory(w *codec.Writer, h *History) {
+	w.Int(int(h.Duration))
+	w.Int(len(h.Epochs))
+	for _, e := range h.Epochs {
+		w.Int(e.Epoch)
+		w.Float(e.Loss)
+		w.Float(e.Accuracy)
+		w.Float(e.LearningRate)
+		w.Int(int(e.Duration))
+		w.Bool(e.Validation != nil)
+		if e.Validation != nil {
+			w.Int(e.Validation.Count)
+			w.Float(e.Validation.Loss)
+			w.Float(e.Validation.Accuracy)
+		}
+	}
+	w.Int(len(h.Intervals))
+	for _, i := range h.Intervals {
+		w.Int(i.Epoch)
+		w.Int(i.Position)
+		w.Int(i.Size)
+		w.Float(i.Loss)
+		w.Float(i.Accuracy)
+		w.Float(i.LearningRate)
+	}
+}
+
+func readHistory(r *codec.Reader) *History {
+	h := &History{}
+	h.Duration = time.Duration(r.Int())
+	epochs := r.Int()
+	for i := 0; i < epochs && r.Err() == nil; i++ {
+		e := EpochMetrics{}
+		e.Epoch = r.Int()
+		e.Loss = r.Float()
+		e.Accuracy = r.Float()
+		e.LearningRate = r.Float()
+		e.Duration = time.Duration(r.Int())
+		if r.Bool() {
+			e.Validation = &EvaluationResult{}
+			e.Validation.Count = r.Int()
+			e.Validation.Loss = r.Float()
+			e.Validation.Accuracy = r.Float()
+		}
+		h.Epochs = append(h.Epochs, e)
+	}
+	intervals := r.Int()
+	for i := 0; i < intervals && r.Err() == nil; i++ {
+		m := IntervalMetrics{}
+		m.Epoch = r.Int()
+		m.Position = r.Int()
+		m.Size = r.Int()
+		m.Loss = r.Float()
+		m.Accuracy = r.Float()
+		m.LearningRate = r.Float()
+		h.Intervals = append(h.Intervals, m)
+	}
+	return h
+}
+
+// checkParameters returns an error if the parameters restored from a checkpoint do not have the dimensions of the
+// parameters of the network
+func checkParameters(restored, params []*layer.Parameter) error {
+	if len(restored) != len(params) {
+		return fmt.Errorf("%d parameters instead of %d", len(restored), len(params))
+	}
+	for i, p := range params {
+		if !equalDims(restored[i].Value.Dimensions(), p.Value.Dimensions()) {
+			return fmt.Errorf("parameter %d has dimensions %v instead of %v", i, restored[i].Value.Dimensions(), p.Value.Dimensions())
+		}
+	}
+	return nil
+}
+
+func equalDims(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
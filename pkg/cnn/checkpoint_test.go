@@ -0,0 +1,258 @@
+package cnn
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rubenwo/cnn-go/pkg/cnn/layer"
+	"github.com/rubenwo/cnn-go/pkg/cnn/metrics"
+)
+
+// newCheckpointNetwork returns a network whose first fully connected layer has hidden outputs
+func newCheckpointNetwork(hidden int) *Network {
+	n := New([]int{8, 8}, NewAdam(0.01, 0.9, 0.999, 1e-8), &metrics.CrossEntropyLoss{}, WithSeed(1))
+	n.AddFullyConnectedLayer(hidden).AddReLULayer().AddFullyConnectedLayer(4).AddSoftmaxLayer()
+	return n
+}
+
+func TestResumeRejectsDifferentLayers(t *testing.T) {
+	dir, err := ioutil.TempDir("", "checkpoints")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	inputs, labels := testData(32)
+	n := newCheckpointNetwork(8)
+	n.SetCheckpointing(CheckpointConfig{Dir: dir})
+	if _, err := n.Fit(context.Background(), inputs, labels, nil, nil, 1, 8, 0); err != nil {
+		t.Fatal(err)
+	}
+	path, err := LatestCheckpoint(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := newCheckpointNetwork(8).Resume(context.Background(), path, inputs, labels, nil, nil, 2, 8, 0); err != nil {
+		t.Errorf("resuming with the same layers: %v", err)
+	}
+	if _, err := newCheckpointNetwork(6).Resume(context.Background(), path, inputs, labels, nil, nil, 2, 8, 0); err == nil {
+		t.Error("resuming with differently shaped layers did not return an error")
+	}
+}
+
+// rejectingSGD is a SGD optimizer that rejects any restored state
+type rejectingSGD struct {
+	*SGD
+}
+
+func (rejectingSGD) checkState([]*layer.Parameter) error { return errors.New("rejected") }
+
+func TestResumeLeavesNetworkUnchangedOnError(t *testing.T) {
+	dir, err := ioutil.TempDir("", "checkpoints")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	inputs, labels := testData(32)
+	n := newCheckpointNetwork(8)
+	n.SetCheckpointing(CheckpointConfig{Dir: dir})
+	if _, err := n.Fit(context.Background(), inputs, labels, nil, nil, 1, 8, 0); err != nil {
+		t.Fatal(err)
+	}
+	path, err := LatestCheckpoint(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resumed := newCheckpointNetwork(8)
+	optimizer := rejectingSGD{NewMomentumSGD(0.5, 0.9, false)}
+	resumed.SetOptimizer(optimizer)
+	layers := append([]layer.Layer(nil), resumed.layers...)
+	state, _ := optimizer.MarshalBinary()
+	if _, err := resumed.Resume(context.Background(), path, inputs, labels, nil, nil, 2, 8, 0); err == nil {
+		t.Fatal("resuming with a rejected optimizer state did not return an error")
+	}
+	for i, l := range resumed.layers {
+		if l != layers[i] {
+			t.Errorf("layer %d was replaced", i)
+		}
+	}
+	if after, _ := optimizer.MarshalBinary(); !bytes.Equal(after, state) {
+		t.Error("the optimizer state was changed")
+	}
+}
+
+// cancelAfter cancels the context of Fit after batch batches
+type cancelAfter struct {
+	BaseCallback
+	batch  int
+	cancel context.CancelFunc
+}
+
+func (c cancelAfter) OnBatchEnd(n *Network, metrics BatchMetrics) error {
+	if metrics.Batch == c.batch {
+		c.cancel()
+	}
+	return nil
+}
+
+// newResumableNetwork returns a network with an optimizer and a scheduler that both have state
+func newResumableNetwork(dir string, every int) *Network {
+	n := newCheckpointNetwork(8)
+	n.SetScheduler(NewStepDecay(EveryBatch, 0.01, 0.5, 5))
+	n.SetCheckpointing(CheckpointConfig{Dir: dir, Every: every})
+	return n
+}
+
+// assertSameRun fails if the parameters, the optimizer state or the histories of two runs differ
+func assertSameRun(t *testing.T, got, want *Network, gotHistory, wantHistory *History) {
+	t.Helper()
+	gotParams, wantParams := got.parameters(), want.parameters()
+	for i := range wantParams {
+		gotValues, wantValues := gotParams[i].Value.Values(), wantParams[i].Value.Values()
+		for j := range wantValues {
+			if gotValues[j] != wantValues[j] {
+				t.Fatalf("parameter %d[%d] is %g, want %g", i, j, gotValues[j], wantValues[j])
+			}
+		}
+	}
+	gotState, _ := got.optimizer.(*Adam).MarshalBinary()
+	wantState, _ := want.optimizer.(*Adam).MarshalBinary()
+	if !bytes.Equal(gotState, wantState) {
+		t.Error("the optimizer states differ")
+	}
+	if got.LearningRate() != want.LearningRate() {
+		t.Errorf("learning rate is %g, want %g", got.LearningRate(), want.LearningRate())
+	}
+
+	if len(gotHistory.Epochs) != len(wantHistory.Epochs) || len(gotHistory.Intervals) != len(wantHistory.Intervals) {
+		t.Fatalf("history has %d epochs and %d intervals, want %d and %d", len(gotHistory.Epochs),
+			len(gotHistory.Intervals), len(wantHistory.Epochs), len(wantHistory.Intervals))
+	}
+	for i, w := range wantHistory.Epochs {
+		g := gotHistory.Epochs[i]
+		if g.Epoch != w.Epoch || g.Loss != w.Loss || g.Accuracy != w.Accuracy || g.LearningRate != w.LearningRate ||
+			g.Validation.Loss != w.Validation.Loss || g.Validation.Accuracy != w.Validation.Accuracy {
+			t.Errorf("epoch %d: got %+v, want %+v", i, g, w)
+		}
+	}
+	for i, w := range wantHistory.Intervals {
+		if gotHistory.Intervals[i] != w {
+			t.Errorf("interval %d: got %+v, want %+v", i, gotHistory.Intervals[i], w)
+		}
+	}
+}
+
+func TestResumeMatchesUninterruptedRun(t *testing.T) {
+	dir, err := ioutil.TempDir("", "checkpoints")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	inputs, labels := testData(40)
+	valInputs, valLabels := testData(12)
+	const epochs, batchSize, logRate = 3, 8, 12
+
+	// The uninterrupted run writes a checkpoint every 3 batches, there are 5 batches per epoch
+	reference := newResumableNetwork(filepath.Join(dir, "reference"), 3)
+	want, err := reference.Fit(context.Background(), inputs, labels, valInputs, valLabels, epochs, batchSize, logRate)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("cancelled", func(t *testing.T) {
+		interrupted := newResumableNetwork(filepath.Join(dir, "cancelled"), 0)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		_, err := interrupted.Fit(ctx, inputs, labels, valInputs, valLabels, epochs, batchSize, logRate, cancelAfter{batch: 7, cancel: cancel})
+		if err != context.Canceled {
+			t.Fatalf("Fit returned %v, want %v", err, context.Canceled)
+		}
+		path, err := LatestCheckpoint(filepath.Join(dir, "cancelled"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		resumed := newResumableNetwork("", 0)
+		got, err := resumed.Resume(context.Background(), path, inputs, labels, valInputs, valLabels, epochs, batchSize, logRate)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertSameRun(t, resumed, reference, got, want)
+	})
+
+	t.Run("every", func(t *testing.T) {
+		// Written after batch 6, the first batch of the second epoch
+		path := filepath.Join(dir, "reference", "checkpoint-000001-000000006.ckpt")
+		resumed := newResumableNetwork("", 0)
+		got, err := resumed.Resume(context.Background(), path, inputs, labels, valInputs, valLabels, epochs, batchSize, logRate)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertSameRun(t, resumed, reference, got, want)
+	})
+}
+
+func TestCheckpointRotation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "checkpoints")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	inputs, labels := testData(40)
+	valInputs, valLabels := testData(12)
+	n := newCheckpointNetwork(8)
+	n.SetCheckpointing(CheckpointConfig{Dir: dir, Every: 2, Keep: 3})
+	history, err := n.Fit(context.Background(), inputs, labels, valInputs, valLabels, 4, 8, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the 3 most recent checkpoints are kept. There are 5 batches per epoch, so the last checkpoints are written
+	// after batch 16 and 18 and at the end of the last epoch.
+	paths, err := checkpointPaths(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"checkpoint-000003-000000016.ckpt", "checkpoint-000003-000000018.ckpt", "checkpoint-000004-000000020.ckpt"}
+	if len(paths) != len(want) {
+		t.Fatalf("the checkpoints are %v, want %v", paths, want)
+	}
+	for i, path := range paths {
+		if filepath.Base(path) != want[i] {
+			t.Fatalf("the checkpoints are %v, want %v", paths, want)
+		}
+	}
+	latest, err := newCheckpointNetwork(8).loadCheckpoint(paths[2])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if latest.epoch != 4 || latest.position != 0 {
+		t.Errorf("the latest checkpoint is at epoch %d position %d, want the end of epoch 4", latest.epoch, latest.position)
+	}
+
+	// The best checkpoint is written at the end of the first epoch with the highest validation accuracy
+	bestEpoch := 0
+	for i, e := range history.Epochs {
+		if e.Validation.Accuracy > history.Epochs[bestEpoch].Validation.Accuracy {
+			bestEpoch = i
+		}
+	}
+	best, err := newCheckpointNetwork(8).loadCheckpoint(filepath.Join(dir, BestCheckpoint))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if best.epoch != bestEpoch+1 || best.bestAccuracy != history.Epochs[bestEpoch].Validation.Accuracy {
+		t.Errorf("the best checkpoint is at epoch %d with accuracy %g, want epoch %d with accuracy %g",
+			best.epoch, best.bestAccuracy, bestEpoch+1, history.Epochs[bestEpoch].Validation.Accuracy)
+	}
+}
@@ -0,0 +1,217 @@
+// Package gradcheck compares the gradients computed by layers and loss functions with central finite differences.
+// A layer is checked on the scalar function <output, w> for fixed random weights w, so every element of the
+// output contributes to the gradients. A loss function is checked on the sum of its loss values, like the
+// network uses it.
+//
+// In a test:
+//
+//	gradcheck.Layer(layer.NewReLULayer([]int{4}), *input, gradcheck.DefaultConfig).Check(t)
+package gradcheck
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"strings"
+
+	"github.com/rubenwo/cnn-go/pkg/cnn/layer"
+	"github.com/rubenwo/cnn-go/pkg/cnn/maths"
+	"github.com/rubenwo/cnn-go/pkg/cnn/metrics"
+)
+
+type Config struct {
+	// Epsilon is the distance a value is moved in both directions to compute its finite difference
+	Epsilon float64
+	// Tolerance is the largest relative error that is accepted
+	Tolerance float64
+	// Seed seeds the random weights of the layer outputs
+	Seed int64
+}
+
+var DefaultConfig = Config{Epsilon: 1e-6, Tolerance: 1e-5, Seed: 1}
+
+// Element is the comparison of the gradient of a single value.
+type Element struct {
+	// Tensor names the tensor the value is part of: "input", "input <j>" for the j-th input of a batch,
+	// "parameter <i>" in the order of layer.Layer.Parameters, or "predicted"
+	Tensor string
+	Index  int
+
+	Analytic, Numeric float64
+	// RelativeError is |Analytic - Numeric| / max(|Analytic|, |Numeric|, 1). Gradients smaller than 1 are
+	// compared by their absolute error, so values that should be 0 do not produce large errors.
+	RelativeError float64
+}
+
+func (e Element) String() string {
+	return fmt.Sprintf("%s[%d]: analytic %g, numeric %g, relative error %g", e.Tensor, e.Index, e.Analytic, e.Numeric, e.RelativeError)
+}
+
+type Report struct {
+	Elements  []Element
+	Tolerance float64
+}
+
+// Worst returns the element with the largest relative error. A NaN error counts as the largest.
+func (r *Report) Worst() Element {
+	var worst Element
+	for _, e := range r.Elements {
+		if e.RelativeError > worst.RelativeError || math.IsNaN(e.RelativeError) && !math.IsNaN(worst.RelativeError) {
+			worst = e
+		}
+	}
+	return worst
+}
+
+// Failures returns the elements with a relative error above the tolerance.
+func (r *Report) Failures() []Element {
+	var failures []Element
+	for _, e := range r.Elements {
+		if !(e.RelativeError <= r.Tolerance) {
+			failures = append(failures, e)
+		}
+	}
+	return failures
+}
+
+// Err returns an error describing the failures, or nil if there are none.
+func (r *Report) Err() error {
+	failures := r.Failures()
+	if len(failures) == 0 {
+		return nil
+	}
+	lines := make([]string, 0, len(failures))
+	for _, e := range failures {
+		lines = append(lines, e.String())
+	}
+	return fmt.Errorf("gradcheck: %d of %d gradients exceed tolerance %g:\n%s", len(failures), len(r.Elements), r.Tolerance, strings.Join(lines, "\n"))
+}
+
+// TB is the part of testing.TB used by Check.
+type TB interface {
+	Helper()
+	Errorf(format string, args ...interface{})
+}
+
+// Check reports every failure to tb.
+func (r *Report) Check(tb TB) {
+	tb.Helper()
+	for _, e := range r.Failures() {
+		tb.Errorf("gradcheck: %s exceeds tolerance %g", e, r.Tolerance)
+	}
+}
+
+// Layer compares the input and parameter gradients of l at input. The forward pass is run in Training mode.
+// Stochastic layers get a generator seeded with config.Seed for every forward pass, so they draw the same random
+// numbers every time. The parameters of l are moved during the check and restored afterwards.
+func Layer(l layer.Layer, input maths.Tensor, config Config) *Report {
+	forward := func(input maths.Tensor) (maths.Tensor, layer.Cache) {
+		if s, ok := l.(layer.Stochastic); ok {
+			return s.ForwardPropagationRandom(input, layer.Training, rand.New(maths.NewSource(config.Seed)))
+		}
+		return l.ForwardPropagation(input, layer.Training)
+	}
+
+	in := maths.NewTensor(append([]int(nil), input.Dimensions()...), append([]float64(nil), input.Values()...))
+	output, cache := forward(*in)
+
+	random := rand.New(maths.NewSource(config.Seed))
+	weights := maths.NewTensor(append([]int(nil), output.Dimensions()...), nil)
+	weights.Apply(func(float64, int) float64 { return random.NormFloat64() })
+
+	parameters := l.Parameters()
+	grads := make([]*maths.Tensor, len(parameters))
+	for i, p := range parameters {
+		grads[i] = maths.NewTensor(append([]int(nil), p.Value.Dimensions()...), nil)
+	}
+	inputGradient := l.BackwardPropagation(*weights, cache, grads)
+
+	objective := func() float64 {
+		output, _ := forward(*in)
+		return output.InnerProduct(weights)
+	}
+	report := &Report{Tolerance: config.Tolerance}
+	report.compare("input", in, &inputGradient, objective, config.Epsilon)
+	for i, p := range parameters {
+		report.compare(fmt.Sprintf("parameter %d", i), p.Value, grads[i], objective, config.Epsilon)
+	}
+	return report
+}
+
+// Batch compares the input and parameter gradients of l for a whole batch of inputs, through
+// ForwardPropagationBatch and BackwardPropagationBatch in Training mode. The objective is the sum of <output, w>
+// over the outputs of the batch, with different random weights w for every output.
+// The parameters of l are moved during the check and restored afterwards.
+func Batch(l layer.BatchLayer, inputs []maths.Tensor, config Config) *Report {
+	in := make([]maths.Tensor, len(inputs))
+	for j, input := range inputs {
+		in[j] = *maths.NewTensor(append([]int(nil), input.Dimensions()...), append([]float64(nil), input.Values()...))
+	}
+	outputs, cache := l.ForwardPropagationBatch(in, layer.Training)
+
+	random := rand.New(maths.NewSource(config.Seed))
+	weights := make([]maths.Tensor, len(outputs))
+	for j, output := range outputs {
+		weights[j] = *maths.NewTensor(append([]int(nil), output.Dimensions()...), nil)
+		weights[j].Apply(func(float64, int) float64 { return random.NormFloat64() })
+	}
+
+	parameters := l.Parameters()
+	grads := make([]*maths.Tensor, len(parameters))
+	for i, p := range parameters {
+		grads[i] = maths.NewTensor(append([]int(nil), p.Value.Dimensions()...), nil)
+	}
+	inputGradients := l.BackwardPropagationBatch(weights, cache, grads)
+
+	objective := func() float64 {
+		outputs, _ := l.ForwardPropagationBatch(in, layer.Training)
+		sum := 0.0
+		for j := range outputs {
+			sum += outputs[j].InnerProduct(&weights[j])
+		}
+		return sum
+	}
+	report := &Report{Tolerance: config.Tolerance}
+	for j := range in {
+		report.compare(fmt.Sprintf("input %d", j), &in[j], &inputGradients[j], objective, config.Epsilon)
+	}
+	for i, p := range parameters {
+		report.compare(fmt.Sprintf("parameter %d", i), p.Value, grads[i], objective, config.Epsilon)
+	}
+	return report
+}
+
+// Loss compares the derivative of loss with respect to predicted.
+func Loss(loss metrics.LossFunction, target, predicted []float64, config Config) *Report {
+	p := maths.NewTensor([]int{len(predicted)}, append([]float64(nil), predicted...))
+	derivative := loss.CalculateLossDerivative(target, p.Values())
+
+	objective := func() float64 {
+		values := loss.CalculateLoss(target, p.Values())
+		return maths.SumFloat64Slice(values.Values())
+	}
+	report := &Report{Tolerance: config.Tolerance}
+	report.compare("predicted", p, &derivative, objective, config.Epsilon)
+	return report
+}
+
+// compare adds the comparison of every value of x to the report. analytic holds the gradient of objective with
+// respect to x.
+func (r *Report) compare(name string, x, analytic *maths.Tensor, objective func() float64, epsilon float64) {
+	if analytic.Len() != x.Len() {
+		panic(fmt.Sprintf("gradcheck: gradient of %s has %d values, expected %d", name, analytic.Len(), x.Len()))
+	}
+	for i := 0; i < x.Len(); i++ {
+		value := x.At(i)
+		x.SetValue(i, value+epsilon)
+		plus := objective()
+		x.SetValue(i, value-epsilon)
+		minus := objective()
+		x.SetValue(i, value)
+
+		e := Element{Tensor: name, Index: i, Analytic: analytic.At(i), Numeric: (plus - minus) / (2 * epsilon)}
+		scale := math.Max(1, math.Max(math.Abs(e.Analytic), math.Abs(e.Numeric)))
+		e.RelativeError = math.Abs(e.Analytic-e.Numeric) / scale
+		r.Elements = append(r.Elements, e)
+	}
+}
@@ -0,0 +1,98 @@
+package cnn
+
+import (
+	"fmt"
+	"github.com/rubenwo/cnn-go/pkg/cnn/metrics"
+	"io"
+	"time"
+)
+
+// History is the record of a training run returned by Fit.
+type History struct {
+	// Epochs contains the metrics of every completed epoch
+	Epochs []EpochMetrics
+	// Intervals contains the training metrics of every log interval
+	Intervals []IntervalMetrics
+	// Duration is the wall time spent training, including validation
+	Duration time.Duration
+}
+
+// EpochMetrics are the metrics of a single epoch.
+type EpochMetrics struct {
+	Epoch int
+	// Loss and Accuracy are averaged over all training examples of the epoch
+	Loss     float64
+	Accuracy float64
+	// LearningRate is the learning rate at the end of the epoch, before the scheduler is stepped
+	LearningRate float64
+	// Validation is nil when Fit was not given validation data
+	Validation *EvaluationResult
+	Duration   time.Duration
+}
+
+// IntervalMetrics are the training metrics of the last Size examples, recorded every log interval.
+type IntervalMetrics struct {
+	Epoch int
+	// Position is the index of the last example of the interval within the epoch
+	Position     int
+	Size         int
+	Loss         float64
+	Accuracy     float64
+	LearningRate float64
+}
+
+// EvaluationResult is the result of running the network over a labeled dataset.
+type EvaluationResult struct {
+	Count    int
+	Loss     float64
+	Accuracy float64
+	// Evaluation holds the classification metrics of the predictions. It is nil for results restored from a
+	// checkpoint.
+	Evaluation *metrics.Evaluation
+}
+
+// Reporter is notified of the progress of Fit, for example to print it.
+type Reporter interface {
+	EpochStarted(epoch int)
+	IntervalCompleted(metrics IntervalMetrics)
+	EpochCompleted(metrics EpochMetrics)
+}
+
+// TextReporter writes the progress of Fit as human readable text.
+type TextReporter struct {
+	w          io.Writer
+	totalCount int
+}
+
+// NewTextReporter returns a Reporter writing to w. totalCount is the number of training examples, it is only used
+// for the messages.
+func NewTextReporter(w io.Writer, totalCount int) *TextReporter {
+	return &TextReporter{w: w, totalCount: totalCount}
+}
+
+func (r *TextReporter) EpochStarted(epoch int) {
+	fmt.Fprintf(r.w, "Starting epoch: %d\n", epoch)
+}
+
+func (r *TextReporter) IntervalCompleted(m IntervalMetrics) {
+	fmt.Fprintf(r.w, "Input: %d / %d, average loss for last %d iterations was %f\n", m.Position, r.totalCount, m.Size, m.Loss)
+	fmt.Fprintf(r.w, "Accuracy for the last %d iterations was %.2f\n", m.Size, m.Accuracy)
+	fmt.Fprintf(r.w, "Using learning rate of %f\n", m.LearningRate)
+}
+
+func (r *TextReporter) EpochCompleted(m EpochMetrics) {
+	if m.Validation != nil {
+		r.Validated(*m.Validation)
+	}
+	fmt.Fprintf(r.w, "Completed epoch: %d in %s, average loss %f, accuracy %.2f\n", m.Epoch, m.Duration.Round(time.Millisecond), m.Loss, m.Accuracy)
+}
+
+// Validated writes the result of a validation run
+func (r *TextReporter) Validated(result EvaluationResult) {
+	fmt.Fprintf(r.w, "Validated network with %d inputs\n", result.Count)
+	fmt.Fprintf(r.w, "Validation average loss: %f\n", result.Loss)
+	fmt.Fprintf(r.w, "Validation accuracy: %.2f\n", result.Accuracy)
+	if result.Evaluation != nil {
+		fmt.Fprintf(r.w, "Validation macro F1: %.2f, Cohen's kappa: %.2f\n", result.Evaluation.MacroF1, result.Evaluation.Kappa)
+	}
+}
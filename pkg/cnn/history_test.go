@@ -0,0 +1,137 @@
+package cnn
+
+import (
+	"bytes"
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/rubenwo/cnn-go/pkg/cnn/metrics"
+)
+
+// batchRecorder records the metrics of every batch
+type batchRecorder struct {
+	BaseCallback
+	batches []BatchMetrics
+}
+
+func (r *batchRecorder) OnBatchEnd(n *Network, m BatchMetrics) error {
+	r.batches = append(r.batches, m)
+	return nil
+}
+
+func TestFitHistory(t *testing.T) {
+	inputs, labels := testData(12)
+	valInputs, valLabels := testData(6)
+	n := New([]int{8, 8}, NewSGD(0.1), &metrics.CrossEntropyLoss{}, WithSeed(1))
+	n.AddFullyConnectedLayer(4).AddSoftmaxLayer()
+	n.SetScheduler(NewStepDecay(EveryEpoch, 0.1, 0.5, 1))
+
+	const epochs, batchSize, logRate = 3, 5, 4
+	recorder := &batchRecorder{}
+	history, err := n.Fit(context.Background(), inputs, labels, valInputs, valLabels, epochs, batchSize, logRate, recorder)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(history.Epochs) != epochs {
+		t.Fatalf("%d epochs in the history, want %d", len(history.Epochs), epochs)
+	}
+	// Every epoch has batches of 5, 5 and 2 examples
+	for i, m := range history.Epochs {
+		if m.Epoch != i {
+			t.Errorf("epoch %d is recorded as epoch %d", i, m.Epoch)
+		}
+		var loss, accuracy float64
+		for _, batch := range recorder.batches[3*i : 3*i+3] {
+			loss += batch.Loss * float64(batch.Size)
+			accuracy += batch.Accuracy * float64(batch.Size)
+		}
+		if math.Abs(m.Loss-loss/12) > 1e-12 || math.Abs(m.Accuracy-accuracy/12) > 1e-12 {
+			t.Errorf("epoch %d: loss %g and accuracy %g, the batches average to %g and %g", i, m.Loss, m.Accuracy,
+				loss/12, accuracy/12)
+		}
+		if want := 0.1 * math.Pow(0.5, float64(i)); math.Abs(m.LearningRate-want) > 1e-12 {
+			t.Errorf("epoch %d: learning rate %g, want %g", i, m.LearningRate, want)
+		}
+		if m.Validation == nil || m.Validation.Count != len(valInputs) || m.Validation.Evaluation == nil {
+			t.Errorf("epoch %d: validation %+v, want a result of %d inputs", i, m.Validation, len(valInputs))
+		}
+		if m.Duration <= 0 || m.Duration > history.Duration {
+			t.Errorf("epoch %d: duration %s of a run of %s", i, m.Duration, history.Duration)
+		}
+	}
+
+	// The network does not change after the last epoch, so validating it again gives the same result
+	result, err := n.Validate(valInputs, valLabels)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if last := history.Epochs[epochs-1].Validation; last.Loss != result.Loss || last.Accuracy != result.Accuracy {
+		t.Errorf("last validation loss %g and accuracy %g, validating again gives %g and %g", last.Loss,
+			last.Accuracy, result.Loss, result.Accuracy)
+	}
+
+	// The positions 0, 4 and 8 of every epoch end a log interval
+	if len(history.Intervals) != 3*epochs {
+		t.Fatalf("%d intervals in the history, want %d", len(history.Intervals), 3*epochs)
+	}
+	for i, m := range history.Intervals {
+		if m.Epoch != i/3 || m.Position != 4*(i%3) || m.Size != logRate {
+			t.Errorf("interval %d: epoch %d, position %d and size %d", i, m.Epoch, m.Position, m.Size)
+		}
+	}
+}
+
+func TestFitHistoryWithoutValidation(t *testing.T) {
+	inputs, labels := testData(8)
+	n := New([]int{8, 8}, NewSGD(0.1), &metrics.CrossEntropyLoss{}, WithSeed(1))
+	n.AddFullyConnectedLayer(4).AddSoftmaxLayer()
+	history, err := n.Fit(context.Background(), inputs, labels, nil, nil, 2, 4, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history.Epochs) != 2 || len(history.Intervals) != 0 {
+		t.Fatalf("%d epochs and %d intervals in the history, want 2 and 0", len(history.Epochs), len(history.Intervals))
+	}
+	for _, m := range history.Epochs {
+		if m.Validation != nil {
+			t.Errorf("epoch %d has a validation result without validation data", m.Epoch)
+		}
+	}
+}
+
+func TestTextReporter(t *testing.T) {
+	var buf bytes.Buffer
+	r := NewTextReporter(&buf, 1000)
+	r.EpochStarted(2)
+	r.IntervalCompleted(IntervalMetrics{Epoch: 2, Position: 100, Size: 50, Loss: 0.25, Accuracy: 0.875, LearningRate: 0.01})
+	r.EpochCompleted(EpochMetrics{Epoch: 2, Loss: 0.5, Accuracy: 0.75, Duration: 1234567 * time.Microsecond})
+	r.EpochCompleted(EpochMetrics{
+		Epoch:      3,
+		Loss:       0.125,
+		Accuracy:   0.9,
+		Validation: &EvaluationResult{Count: 20, Loss: 0.3, Accuracy: 0.85, Evaluation: &metrics.Evaluation{MacroF1: 0.8, Kappa: 0.7}},
+		Duration:   2 * time.Second,
+	})
+	r.Validated(EvaluationResult{Count: 10, Loss: 1.5, Accuracy: 0.5})
+
+	const want = `Starting epoch: 2
+Input: 100 / 1000, average loss for last 50 iterations was 0.250000
+Accuracy for the last 50 iterations was 0.88
+Using learning rate of 0.010000
+Completed epoch: 2 in 1.235s, average loss 0.500000, accuracy 0.75
+Validated network with 20 inputs
+Validation average loss: 0.300000
+Validation accuracy: 0.85
+Validation macro F1: 0.80, Cohen's kappa: 0.70
+Completed epoch: 3 in 2s, average loss 0.125000, accuracy 0.90
+Validated network with 10 inputs
+Validation average loss: 1.500000
+Validation accuracy: 0.50
+`
+	if got := buf.String(); got != want {
+		t.Errorf("TextReporter wrote\n%s\nwant\n%s", got, want)
+	}
+}
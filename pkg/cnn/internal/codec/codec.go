@@ -0,0 +1,158 @@
+// Package codec contains the little-endian binary encoding used to persist networks.
+// Writer and Reader keep the first error that occurs, so a sequence of calls only needs to be checked once
+// using Err.
+package codec
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+
+	"github.com/rubenwo/cnn-go/pkg/cnn/maths"
+)
+
+// maxLength protects Reader against allocating absurd amounts of memory for corrupt input.
+const maxLength = 1 << 31
+
+type Writer struct {
+	w   io.Writer
+	err error
+}
+
+func NewWriter(w io.Writer) *Writer { return &Writer{w: w} }
+
+func (w *Writer) Err() error { return w.err }
+
+func (w *Writer) Uint64(v uint64) {
+	if w.err != nil {
+		return
+	}
+	var buf [8]byte
+	binary.LittleEndian.PutUint64(buf[:], v)
+	_, w.err = w.w.Write(buf[:])
+}
+
+func (w *Writer) Int(v int)       { w.Uint64(uint64(int64(v))) }
+func (w *Writer) Float(v float64) { w.Uint64(math.Float64bits(v)) }
+func (w *Writer) Bool(v bool) {
+	if v {
+		w.Uint64(1)
+	} else {
+		w.Uint64(0)
+	}
+}
+
+func (w *Writer) Ints(v []int) {
+	w.Int(len(v))
+	for _, i := range v {
+		w.Int(i)
+	}
+}
+
+func (w *Writer) Floats(v []float64) {
+	w.Int(len(v))
+	for _, f := range v {
+		w.Float(f)
+	}
+}
+
+func (w *Writer) Bytes(b []byte) {
+	w.Int(len(b))
+	if w.err != nil {
+		return
+	}
+	_, w.err = w.w.Write(b)
+}
+
+func (w *Writer) String(s string) { w.Bytes([]byte(s)) }
+
+// Tensor writes the dimensions and values of t
+func (w *Writer) Tensor(t *maths.Tensor) {
+	w.Ints(t.Dimensions())
+	w.Floats(t.Values())
+}
+
+type Reader struct {
+	r   io.Reader
+	err error
+}
+
+func NewReader(r io.Reader) *Reader { return &Reader{r: r} }
+
+func (r *Reader) Err() error { return r.err }
+
+func (r *Reader) Uint64() uint64 {
+	if r.err != nil {
+		return 0
+	}
+	var buf [8]byte
+	if _, err := io.ReadFull(r.r, buf[:]); err != nil {
+		r.err = err
+		return 0
+	}
+	return binary.LittleEndian.Uint64(buf[:])
+}
+
+func (r *Reader) Int() int       { return int(int64(r.Uint64())) }
+func (r *Reader) Float() float64 { return math.Float64frombits(r.Uint64()) }
+func (r *Reader) Bool() bool     { return r.Uint64() != 0 }
+
+// length reads a length prefix and validates it
+func (r *Reader) length() int {
+	n := r.Int()
+	if r.err == nil && (n < 0 || n > maxLength) {
+		r.err = errors.New("codec: invalid length")
+	}
+	if r.err != nil {
+		return 0
+	}
+	return n
+}
+
+// Length reads a count written with Writer.Int and validates it like the length of a slice
+func (r *Reader) Length() int { return r.length() }
+
+func (r *Reader) Ints() []int {
+	v := make([]int, r.length())
+	for i := range v {
+		v[i] = r.Int()
+	}
+	return v
+}
+
+func (r *Reader) Floats() []float64 {
+	v := make([]float64, r.length())
+	for i := range v {
+		v[i] = r.Float()
+	}
+	return v
+}
+
+func (r *Reader) Bytes() []byte {
+	b := make([]byte, r.length())
+	if r.err != nil {
+		return nil
+	}
+	if _, err := io.ReadFull(r.r, b); err != nil {
+		r.err = err
+		return nil
+	}
+	return b
+}
+
+func (r *Reader) String() string { return string(r.Bytes()) }
+
+// Tensor reads a tensor written by Writer.Tensor
+func (r *Reader) Tensor() *maths.Tensor {
+	dims := r.Ints()
+	values := r.Floats()
+	if r.err != nil {
+		return nil
+	}
+	if maths.ProductIntSlice(dims) != len(values) {
+		r.err = errors.New("codec: tensor dimensions do not match its values")
+		return nil
+	}
+	return maths.NewTensor(dims, values)
+}
@@ -0,0 +1,453 @@
+package layer
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/rubenwo/cnn-go/pkg/cnn/internal/codec"
+	"github.com/rubenwo/cnn-go/pkg/cnn/maths"
+	"math"
+)
+
+// elementwise implements the parts shared by the activation layers that apply a function to every value of their
+// input independently. In Training mode their cache is the input.
+type elementwise struct {
+	outputDims []int
+}
+
+// forward applies f to every value of input
+func (e *elementwise) forward(input maths.Tensor, mode Mode, f func(x float64) float64) (maths.Tensor, Cache) {
+	output := maths.NewTensor(e.outputDims, nil)
+	e.forwardInto(input, output, f)
+	if mode == Training {
+		return *output, input
+	}
+	return *output, nil
+}
+
+// forwardInto applies f to every value of input and stores the results in output
+func (e *elementwise) forwardInto(input maths.Tensor, output *maths.Tensor, f func(x float64) float64) {
+	out := output.Values()
+	for i, x := range input.Values() {
+		out[i] = f(x)
+	}
+}
+
+// backward multiplies every value of gradient by the derivative of the activation function at the input
+func (e *elementwise) backward(gradient maths.Tensor, cache Cache, derivative func(x float64) float64) maths.Tensor {
+	in := cache.(maths.Tensor)
+	input := in.Values()
+	values := gradient.Values()
+	inputGradient := make([]float64, len(values))
+	for i, g := range values {
+		inputGradient[i] = g * derivative(input[i])
+	}
+	return *maths.NewTensor(e.outputDims, inputGradient)
+}
+
+func (e *elementwise) Parameters() []*Parameter { return nil }
+
+func (e *elementwise) OutputDims() []int {
+	return e.outputDims
+}
+
+// marshal and unmarshalActivation persist the dimensions of an activation layer and its alpha, for the layers that
+// have one
+func (e *elementwise) marshal(alpha ...float64) ([]byte, error) {
+	var buf bytes.Buffer
+	w := codec.NewWriter(&buf)
+	w.Ints(e.outputDims)
+	for _, a := range alpha {
+		w.Float(a)
+	}
+	return buf.Bytes(), w.Err()
+}
+
+func unmarshalActivation(data []byte, alpha ...*float64) ([]int, error) {
+	r := codec.NewReader(bytes.NewReader(data))
+	inputDims := r.Ints()
+	for _, a := range alpha {
+		*a = r.Float()
+	}
+	return inputDims, r.Err()
+}
+
+// SigmoidLayer applies the logistic function 1 / (1 + e^-x) to every value.
+type SigmoidLayer struct {
+	elementwise
+}
+
+func NewSigmoidLayer(inputDims []int) *SigmoidLayer {
+	return &SigmoidLayer{elementwise{outputDims: inputDims}}
+}
+
+func (s *SigmoidLayer) ForwardPropagation(input maths.Tensor, mode Mode) (maths.Tensor, Cache) {
+	return s.forward(input, mode, maths.Sigmoid)
+}
+
+func (s *SigmoidLayer) ForwardPropagationInto(input maths.Tensor, output *maths.Tensor) {
+	s.forwardInto(input, output, maths.Sigmoid)
+}
+
+func (s *SigmoidLayer) BackwardPropagation(gradient maths.Tensor, cache Cache, grads []*maths.Tensor) maths.Tensor {
+	return s.backward(gradient, cache, func(x float64) float64 {
+		y := maths.Sigmoid(x)
+		return y * (1 - y)
+	})
+}
+
+func (s *SigmoidLayer) MarshalBinary() ([]byte, error) { return s.marshal() }
+
+func (s *SigmoidLayer) UnmarshalBinary(data []byte) error {
+	inputDims, err := unmarshalActivation(data)
+	if err != nil {
+		return err
+	}
+	*s = *NewSigmoidLayer(inputDims)
+	return nil
+}
+
+// TanhLayer applies the hyperbolic tangent to every value.
+type TanhLayer struct {
+	elementwise
+}
+
+func NewTanhLayer(inputDims []int) *TanhLayer {
+	return &TanhLayer{elementwise{outputDims: inputDims}}
+}
+
+func (t *TanhLayer) ForwardPropagation(input maths.Tensor, mode Mode) (maths.Tensor, Cache) {
+	return t.forward(input, mode, math.Tanh)
+}
+
+func (t *TanhLayer) ForwardPropagationInto(input maths.Tensor, output *maths.Tensor) {
+	t.forwardInto(input, output, math.Tanh)
+}
+
+func (t *TanhLayer) BackwardPropagation(gradient maths.Tensor, cache Cache, grads []*maths.Tensor) maths.Tensor {
+	return t.backward(gradient, cache, func(x float64) float64 {
+		y := math.Tanh(x)
+		return 1 - y*y
+	})
+}
+
+func (t *TanhLayer) MarshalBinary() ([]byte, error) { return t.marshal() }
+
+func (t *TanhLayer) UnmarshalBinary(data []byte) error {
+	inputDims, err := unmarshalActivation(data)
+	if err != nil {
+		return err
+	}
+	*t = *NewTanhLayer(inputDims)
+	return nil
+}
+
+// LeakyReLULayer applies x for x > 0 and alpha * x otherwise, so negative inputs keep a small gradient.
+type LeakyReLULayer struct {
+	elementwise
+	alpha float64
+}
+
+// NewLeakyReLULayer creates a leaky ReLU with slope alpha for negative inputs, commonly 0.01.
+func NewLeakyReLULayer(alpha float64, inputDims []int) *LeakyReLULayer {
+	return &LeakyReLULayer{elementwise: elementwise{outputDims: inputDims}, alpha: alpha}
+}
+
+func (l *LeakyReLULayer) function(x float64) float64 {
+	if x > 0 {
+		return x
+	}
+	return l.alpha * x
+}
+
+func (l *LeakyReLULayer) ForwardPropagation(input maths.Tensor, mode Mode) (maths.Tensor, Cache) {
+	return l.forward(input, mode, l.function)
+}
+
+func (l *LeakyReLULayer) ForwardPropagationInto(input maths.Tensor, output *maths.Tensor) {
+	l.forwardInto(input, output, l.function)
+}
+
+func (l *LeakyReLULayer) BackwardPropagation(gradient maths.Tensor, cache Cache, grads []*maths.Tensor) maths.Tensor {
+	return l.backward(gradient, cache, func(x float64) float64 {
+		if x > 0 {
+			return 1
+		}
+		return l.alpha
+	})
+}
+
+func (l *LeakyReLULayer) MarshalBinary() ([]byte, error) { return l.marshal(l.alpha) }
+
+func (l *LeakyReLULayer) UnmarshalBinary(data []byte) error {
+	var alpha float64
+	inputDims, err := unmarshalActivation(data, &alpha)
+	if err != nil {
+		return err
+	}
+	*l = *NewLeakyReLULayer(alpha, inputDims)
+	return nil
+}
+
+// ELULayer applies the exponential linear unit: x for x > 0 and alpha * (e^x - 1) otherwise.
+type ELULayer struct {
+	elementwise
+	alpha float64
+}
+
+// NewELULayer creates an ELU that saturates at -alpha for negative inputs, commonly 1.
+func NewELULayer(alpha float64, inputDims []int) *ELULayer {
+	if alpha < 0 {
+		panic(fmt.Sprintf("ELU alpha %g is negative", alpha))
+	}
+	return &ELULayer{elementwise: elementwise{outputDims: inputDims}, alpha: alpha}
+}
+
+func (l *ELULayer) function(x float64) float64 {
+	return elu(x, l.alpha)
+}
+
+func (l *ELULayer) ForwardPropagation(input maths.Tensor, mode Mode) (maths.Tensor, Cache) {
+	return l.forward(input, mode, l.function)
+}
+
+func (l *ELULayer) ForwardPropagationInto(input maths.Tensor, output *maths.Tensor) {
+	l.forwardInto(input, output, l.function)
+}
+
+func (l *ELULayer) BackwardPropagation(gradient maths.Tensor, cache Cache, grads []*maths.Tensor) maths.Tensor {
+	return l.backward(gradient, cache, func(x float64) float64 { return eluDerivative(x, l.alpha) })
+}
+
+func (l *ELULayer) MarshalBinary() ([]byte, error) { return l.marshal(l.alpha) }
+
+func (l *ELULayer) UnmarshalBinary(data []byte) error {
+	var alpha float64
+	inputDims, err := unmarshalActivation(data, &alpha)
+	if err != nil {
+		return err
+	}
+	if alpha < 0 {
+		return fmt.Errorf("elu layer: invalid alpha %g", alpha)
+	}
+	*l = *NewELULayer(alpha, inputDims)
+	return nil
+}
+
+func elu(x, alpha float64) float64 {
+	if x > 0 {
+		return x
+	}
+	return alpha * math.Expm1(x)
+}
+
+func eluDerivative(x, alpha float64) float64 {
+	if x > 0 {
+		return 1
+	}
+	return alpha * math.Exp(x)
+}
+
+// The constants of SELU, which make the activations converge to mean 0 and variance 1 (Klambauer et al.)
+const (
+	seluAlpha = 1.6732632423543772848170429916717
+	seluScale = 1.0507009873554804934193349852946
+)
+
+// SELULayer applies the scaled exponential linear unit: scale * ELU(x) with fixed alpha and scale. Combined with
+// LeCunNormal initialized weights the activations of a deep network stay normalized.
+type SELULayer struct {
+	elementwise
+}
+
+func NewSELULayer(inputDims []int) *SELULayer {
+	return &SELULayer{elementwise{outputDims: inputDims}}
+}
+
+func (s *SELULayer) function(x float64) float64 {
+	return seluScale * elu(x, seluAlpha)
+}
+
+func (s *SELULayer) ForwardPropagation(input maths.Tensor, mode Mode) (maths.Tensor, Cache) {
+	return s.forward(input, mode, s.function)
+}
+
+func (s *SELULayer) ForwardPropagationInto(input maths.Tensor, output *maths.Tensor) {
+	s.forwardInto(input, output, s.function)
+}
+
+func (s *SELULayer) BackwardPropagation(gradient maths.Tensor, cache Cache, grads []*maths.Tensor) maths.Tensor {
+	return s.backward(gradient, cache, func(x float64) float64 { return seluScale * eluDerivative(x, seluAlpha) })
+}
+
+func (s *SELULayer) MarshalBinary() ([]byte, error) { return s.marshal() }
+
+func (s *SELULayer) UnmarshalBinary(data []byte) error {
+	inputDims, err := unmarshalActivation(data)
+	if err != nil {
+		return err
+	}
+	*s = *NewSELULayer(inputDims)
+	return nil
+}
+
+// GELULayer applies the Gaussian error linear unit x * P(X <= x) for a standard normal X, computed exactly with the
+// error function.
+type GELULayer struct {
+	elementwise
+}
+
+func NewGELULayer(inputDims []int) *GELULayer {
+	return &GELULayer{elementwise{outputDims: inputDims}}
+}
+
+func (g *GELULayer) function(x float64) float64 {
+	return x * normalCDF(x)
+}
+
+func (g *GELULayer) ForwardPropagation(input maths.Tensor, mode Mode) (maths.Tensor, Cache) {
+	return g.forward(input, mode, g.function)
+}
+
+func (g *GELULayer) ForwardPropagationInto(input maths.Tensor, output *maths.Tensor) {
+	g.forwardInto(input, output, g.function)
+}
+
+func (g *GELULayer) BackwardPropagation(gradient maths.Tensor, cache Cache, grads []*maths.Tensor) maths.Tensor {
+	return g.backward(gradient, cache, func(x float64) float64 {
+		// The derivative of x * cdf(x) is cdf(x) + x * pdf(x)
+		return normalCDF(x) + x*math.Exp(-x*x/2)/math.Sqrt(2*math.Pi)
+	})
+}
+
+func (g *GELULayer) MarshalBinary() ([]byte, error) { return g.marshal() }
+
+func (g *GELULayer) UnmarshalBinary(data []byte) error {
+	inputDims, err := unmarshalActivation(data)
+	if err != nil {
+		return err
+	}
+	*g = *NewGELULayer(inputDims)
+	return nil
+}
+
+// normalCDF returns the cumulative distribution function of the standard normal distribution at x
+func normalCDF(x float64) float64 {
+	return (1 + math.Erf(x/math.Sqrt2)) / 2
+}
+
+// SwishLayer applies x * maths.Sigmoid(x), also known as SiLU.
+type SwishLayer struct {
+	elementwise
+}
+
+func NewSwishLayer(inputDims []int) *SwishLayer {
+	return &SwishLayer{elementwise{outputDims: inputDims}}
+}
+
+func (s *SwishLayer) function(x float64) float64 {
+	return x * maths.Sigmoid(x)
+}
+
+func (s *SwishLayer) ForwardPropagation(input maths.Tensor, mode Mode) (maths.Tensor, Cache) {
+	return s.forward(input, mode, s.function)
+}
+
+func (s *SwishLayer) ForwardPropagationInto(input maths.Tensor, output *maths.Tensor) {
+	s.forwardInto(input, output, s.function)
+}
+
+func (s *SwishLayer) BackwardPropagation(gradient maths.Tensor, cache Cache, grads []*maths.Tensor) maths.Tensor {
+	return s.backward(gradient, cache, func(x float64) float64 {
+		y := maths.Sigmoid(x)
+		return y + x*y*(1-y)
+	})
+}
+
+func (s *SwishLayer) MarshalBinary() ([]byte, error) { return s.marshal() }
+
+func (s *SwishLayer) UnmarshalBinary(data []byte) error {
+	inputDims, err := unmarshalActivation(data)
+	if err != nil {
+		return err
+	}
+	*s = *NewSwishLayer(inputDims)
+	return nil
+}
+
+// SoftplusLayer applies log(1 + e^x), a smooth approximation of ReLU. It is computed as
+// max(x, 0) + log(1 + e^-|x|), which does not overflow for large x.
+type SoftplusLayer struct {
+	elementwise
+}
+
+func NewSoftplusLayer(inputDims []int) *SoftplusLayer {
+	return &SoftplusLayer{elementwise{outputDims: inputDims}}
+}
+
+func (s *SoftplusLayer) function(x float64) float64 {
+	return math.Max(x, 0) + math.Log1p(math.Exp(-math.Abs(x)))
+}
+
+func (s *SoftplusLayer) ForwardPropagation(input maths.Tensor, mode Mode) (maths.Tensor, Cache) {
+	return s.forward(input, mode, s.function)
+}
+
+func (s *SoftplusLayer) ForwardPropagationInto(input maths.Tensor, output *maths.Tensor) {
+	s.forwardInto(input, output, s.function)
+}
+
+func (s *SoftplusLayer) BackwardPropagation(gradient maths.Tensor, cache Cache, grads []*maths.Tensor) maths.Tensor {
+	return s.backward(gradient, cache, maths.Sigmoid)
+}
+
+func (s *SoftplusLayer) MarshalBinary() ([]byte, error) { return s.marshal() }
+
+func (s *SoftplusLayer) UnmarshalBinary(data []byte) error {
+	inputDims, err := unmarshalActivation(data)
+	if err != nil {
+		return err
+	}
+	*s = *NewSoftplusLayer(inputDims)
+	return nil
+}
+
+// HardSigmoidLayer applies the piecewise linear approximation of the sigmoid x/6 + 1/2, clamped to [0, 1].
+type HardSigmoidLayer struct {
+	elementwise
+}
+
+func NewHardSigmoidLayer(inputDims []int) *HardSigmoidLayer {
+	return &HardSigmoidLayer{elementwise{outputDims: inputDims}}
+}
+
+func (h *HardSigmoidLayer) function(x float64) float64 {
+	return math.Min(math.Max(x/6+0.5, 0), 1)
+}
+
+func (h *HardSigmoidLayer) ForwardPropagation(input maths.Tensor, mode Mode) (maths.Tensor, Cache) {
+	return h.forward(input, mode, h.function)
+}
+
+func (h *HardSigmoidLayer) ForwardPropagationInto(input maths.Tensor, output *maths.Tensor) {
+	h.forwardInto(input, output, h.function)
+}
+
+func (h *HardSigmoidLayer) BackwardPropagation(gradient maths.Tensor, cache Cache, grads []*maths.Tensor) maths.Tensor {
+	return h.backward(gradient, cache, func(x float64) float64 {
+		if x > -3 && x < 3 {
+			return 1.0 / 6
+		}
+		return 0
+	})
+}
+
+func (h *HardSigmoidLayer) MarshalBinary() ([]byte, error) { return h.marshal() }
+
+func (h *HardSigmoidLayer) UnmarshalBinary(data []byte) error {
+	inputDims, err := unmarshalActivation(data)
+	if err != nil {
+		return err
+	}
+	*h = *NewHardSigmoidLayer(inputDims)
+	return nil
+}
@@ -0,0 +1,39 @@
+package layer_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/rubenwo/cnn-go/pkg/cnn/gradcheck"
+	"github.com/rubenwo/cnn-go/pkg/cnn/layer"
+	"github.com/rubenwo/cnn-go/pkg/cnn/maths"
+)
+
+func TestActivationGradients(t *testing.T) {
+	dims := []int{4, 2}
+	// The values avoid the kinks at 0 (ReLU, leaky ReLU, PReLU, ELU, SELU) and at -3 and 3 (hard sigmoid) and
+	// include values in the saturated ranges. The two channels hold positive and negative values for PReLU.
+	input := *maths.NewTensor(dims, []float64{-4.5, 0.3, -0.7, 3.7, 1.6, -0.25, -2.1, 0.9})
+
+	activations := []layer.Layer{
+		layer.NewReLULayer(dims),
+		layer.NewSigmoidLayer(dims),
+		layer.NewTanhLayer(dims),
+		layer.NewLeakyReLULayer(0.01, dims),
+		layer.NewELULayer(1, dims),
+		layer.NewELULayer(0.5, dims),
+		layer.NewSELULayer(dims),
+		layer.NewGELULayer(dims),
+		layer.NewSwishLayer(dims),
+		layer.NewSoftplusLayer(dims),
+		layer.NewHardSigmoidLayer(dims),
+		layer.NewPReLULayer(dims),
+		layer.NewSoftmaxLayer(dims),
+		layer.NewLogSoftmaxLayer(dims),
+	}
+	for _, activation := range activations {
+		t.Run(fmt.Sprintf("%T", activation), func(t *testing.T) {
+			gradcheck.Layer(activation, input, gradcheck.DefaultConfig).Check(t)
+		})
+	}
+}
@@ -1,209 +1,324 @@
 package layer
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
+	"github.com/rubenwo/cnn-go/pkg/cnn/internal/codec"
 	"github.com/rubenwo/cnn-go/pkg/cnn/maths"
 	"image"
 	"image/color"
 	"image/png"
-	"math"
+	"math/rand"
 	"os"
-	"runtime"
+	"sync"
 )
 
 type ConvolutionLayer struct {
 	filters              maths.Tensor
+	filterGradients      maths.Tensor
+	biases               maths.Tensor
+	biasGradients        maths.Tensor
 	filterDimensionSizes []int
+	inputDims            []int
 	ccMapSize            []int
 	outputDimensions     []int
-	recentInput          maths.Tensor
 
-	iteration int
+	strides       []int
+	dilation      []int
+	paddingBefore []int
+	paddingAfter  []int
+	samePadding   bool
+	bias          bool
+	initializer   Initializer
+
+	// inputIndices[o*filterLen+k] is the index of the input value that is multiplied with value k of a filter to
+	// compute position o of a cross-correlation map, or -1 if that value lies in the zero padding
+	inputIndices []int
+	// columns holds *[]float64 buffers for the lowered input, which inference reuses instead of allocating one for
+	// every forward pass
+	columns sync.Pool
 
-	jobs    chan job
-	results chan result
+	iteration int
 }
 
-func NewConvolutionLayer(filterDimensionSizes []int, depth int, inputDims []int) *ConvolutionLayer {
-	conv := &ConvolutionLayer{}
-
-	conv.filterDimensionSizes = filterDimensionSizes
-	for len(conv.filterDimensionSizes) < len(inputDims) {
-		conv.filterDimensionSizes = append(conv.filterDimensionSizes, 1)
-	}
-
-	//Calculate the size of the cross correlation map resultant from applying a given filter
-	conv.ccMapSize = maths.SubtractIntSlices(inputDims, maths.AddIntToAll(conv.filterDimensionSizes, -1))
-
-	conv.filters = *maths.NewTensor(append(conv.filterDimensionSizes, depth), nil)
-
-	randLimits := math.Sqrt(2) / math.Sqrt(float64(maths.ProductIntSlice(inputDims)))
-	conv.filters = *conv.filters.Randomize()
-	conv.filters = *conv.filters.MulScalar(randLimits)
-
-	conv.outputDimensions = append(conv.ccMapSize, depth)
+// ConvolutionOption configures a ConvolutionLayer, see NewConvolutionLayer.
+// Options taking a value per dimension apply to the first dimensions of the input, the remaining dimensions
+// use the default.
+type ConvolutionOption func(c *ConvolutionLayer)
 
-	conv.jobs = make(chan job, 1000)
-	conv.results = make(chan result, 1000)
+// WithStrides sets the step size of the filters in every dimension. The default is 1.
+func WithStrides(strides ...int) ConvolutionOption {
+	return func(c *ConvolutionLayer) { c.strides = strides }
+}
 
-	for i := 0; i < runtime.NumCPU(); i++ {
-		go worker(conv.jobs, conv.results)
+// WithPadding adds padding[i] zeros to both sides of dimension i of the input. The default is no padding.
+func WithPadding(padding ...int) ConvolutionOption {
+	return func(c *ConvolutionLayer) {
+		c.paddingBefore = padding
+		c.paddingAfter = padding
+		c.samePadding = false
 	}
+}
 
-	n, err := conv.SaveFiltersAsImages("./filters")
-	if err != nil {
-		panic(err)
-	}
-	fmt.Printf("Saved %d filters to images\n", n)
-	return conv
+// WithSamePadding pads the input with zeros so the size of the output is the size of the input divided by the
+// stride, rounded up. When the padding of a dimension is odd, the extra zero is added after the input.
+func WithSamePadding() ConvolutionOption {
+	return func(c *ConvolutionLayer) { c.samePadding = true }
 }
 
-type job struct {
-	i int
-	f func(i int) float64
+// WithDilation sets the spacing between the values of a filter in every dimension. The default is 1.
+func WithDilation(dilation ...int) ConvolutionOption {
+	return func(c *ConvolutionLayer) { c.dilation = dilation }
 }
 
-type result struct {
-	i int
-	v float64
+// WithBias adds a learnable bias to every filter.
+func WithBias() ConvolutionOption {
+	return func(c *ConvolutionLayer) { c.bias = true }
 }
 
-func worker(jobs <-chan job, results chan<- result) {
-	for j := range jobs {
-		results <- result{i: j.i, v: j.f(j.i)}
-	}
+// WithFilterInitializer sets the initializer of the filters. The default is HeNormal.
+func WithFilterInitializer(initializer Initializer) ConvolutionOption {
+	return func(c *ConvolutionLayer) { c.initializer = initializer }
 }
 
-// crossCorrelationMap creates a cross-correlation map based on a filter.
-// ccMapSize is passed so we don't have to recalculate it every time.
-// base is the input where the filter needs to be applied to.
-func (c *ConvolutionLayer) crossCorrelationMap(base, filter *maths.Tensor, ccMapSize, padding []int) *maths.Tensor {
-	ccMapValues := make([]float64, maths.ProductIntSlice(ccMapSize))
-
-	numOps := 0
-	// "slide" the filter over the base.
-	// For every 'region' where the filter can come, calculate the inner product of that part of base with the filter.
-	// assign this product to the cross-correlation map.
-	rii := maths.NewRegionsIteratorIterator(base, filter.Dimensions(), padding)
-	for rii.HasNext() {
-		ccMapValues[numOps] = rii.Next().InnerProduct(filter)
-		numOps++
+// NewConvolutionLayer creates a layer applying depth filters of size filterDimensionSizes to inputs of size
+// inputDims. Without options the filters move with a stride of 1 and no padding ("valid" padding).
+// When filterDimensionSizes has fewer dimensions than the input, the last dimension of the input holds the
+// channels and every filter spans all channels: a [kh, kw] filter on an [h, w, c] input is stored as a
+// [kh, kw, c] filter and the output has size [h', w', depth]. Missing spatial filter dimensions are 1.
+// When filterDimensionSizes has as many dimensions as the input there are no channels.
+func NewConvolutionLayer(filterDimensionSizes []int, depth int, inputDims []int, options ...ConvolutionOption) *ConvolutionLayer {
+	conv := &ConvolutionLayer{}
+	for _, option := range options {
+		option(conv)
 	}
 
-	// assert numOps != len(ccMapValues)
-	if numOps != len(ccMapValues) {
-		panic("number of InnerProduct operations is not equal to len(ccMapValues)")
+	spatial := len(inputDims)
+	if len(filterDimensionSizes) < len(inputDims) {
+		spatial--
+	}
+	if len(filterDimensionSizes) > spatial {
+		panic(fmt.Sprintf("convolution filter of size %v has more dimensions than input of size %v", filterDimensionSizes, inputDims))
 	}
 
-	// Return a tensor with the cross-correlation map
-	return maths.NewTensor(ccMapSize, ccMapValues)
-}
+	conv.inputDims = inputDims
+	conv.filterDimensionSizes = extendDims(filterDimensionSizes, spatial, 1)
+	conv.strides = extendDims(conv.strides, spatial, 1)
+	conv.dilation = extendDims(conv.dilation, spatial, 1)
+	conv.paddingBefore = extendDims(conv.paddingBefore, spatial, 0)
+	conv.paddingAfter = extendDims(conv.paddingAfter, spatial, 0)
 
-// crossCorrelationMap creates a cross-correlation map based on a filter.
-// ccMapSize is passed so we don't have to recalculate it every time.
-// base is the input where the filter needs to be applied to.
-func (c *ConvolutionLayer) crossCorrelationMapParallel(base, filter *maths.Tensor, ccMapSize, padding []int) *maths.Tensor {
-	ccMapValues := make([]float64, maths.ProductIntSlice(ccMapSize))
-
-	// We append all regions to slice so we can process each region in parallel. Which might be faster if the regions
-	// are large enough
-	var regions []*maths.ValuesIterator
-	rii := maths.NewRegionsIteratorIterator(base, filter.Dimensions(), padding)
-	for rii.HasNext() {
-		regions = append(regions, rii.Next())
+	for i := 0; i < spatial; i++ {
+		if conv.strides[i] < 1 || conv.dilation[i] < 1 {
+			panic("strides and dilation of a convolution layer must be at least 1")
+		}
+		if conv.paddingBefore[i] < 0 {
+			panic("padding of a convolution layer must not be negative")
+		}
+		if conv.samePadding {
+			// The padding needed to fit ceil(input / stride) positions of the filter
+			outputSize := (inputDims[i] + conv.strides[i] - 1) / conv.strides[i]
+			padding := (outputSize-1)*conv.strides[i] + conv.dilation[i]*(conv.filterDimensionSizes[i]-1) + 1 - inputDims[i]
+			if padding < 0 {
+				padding = 0
+			}
+			conv.paddingBefore[i] = padding / 2
+			conv.paddingAfter[i] = padding - padding/2
+		}
 	}
 
-	// assert regions is not nil
-	if regions == nil {
-		panic("regions is nil, something went wrong")
+	//Calculate the size of the cross correlation map resultant from applying a given filter
+	conv.ccMapSize = make([]int, spatial)
+	for i := 0; i < spatial; i++ {
+		span := conv.dilation[i]*(conv.filterDimensionSizes[i]-1) + 1
+		conv.ccMapSize[i] = (inputDims[i]+conv.paddingBefore[i]+conv.paddingAfter[i]-span)/conv.strides[i] + 1
+		if conv.ccMapSize[i] < 1 {
+			panic(fmt.Sprintf("convolution filter of size %v does not fit input of size %v", conv.filterDimensionSizes, inputDims))
+		}
 	}
 
-	// length of ccMapValues needs to be the same length of regions, else something went wrong
-	if len(ccMapValues) != len(regions) {
-		panic(fmt.Sprintf("len(ccMapValues)=%d != len(regions)=%d", len(ccMapValues), len(regions)))
+	filterDims := append([]int{}, conv.filterDimensionSizes...)
+	if spatial < len(inputDims) {
+		filterDims = append(filterDims, conv.channels())
 	}
+	conv.filters = *maths.NewTensor(append(filterDims, depth), nil)
 
-	// process each regions Inner Product in parallel using n = runtime.NumCPU() workers
-	for i := range ccMapValues {
-		// Send job to worker
-		c.jobs <- job{i: i, f: func(i int) float64 { return regions[i].InnerProduct(filter) }}
+	if conv.initializer == nil {
+		conv.initializer = HeNormal{}
 	}
-	for range ccMapValues {
-		// receive result and set result in ccMapValues
-		res := <-c.results
-		ccMapValues[res.i] = res.v
+	conv.InitializeParameters(newRandom())
+	conv.filterGradients = *conv.filters.Zeroes()
+	if conv.bias {
+		conv.biases = *maths.NewTensor([]int{depth}, nil)
+		conv.biasGradients = *conv.biases.Zeroes()
 	}
 
-	// Return a tensor with the cross-correlation map
-	return maths.NewTensor(ccMapSize, ccMapValues)
+	conv.outputDimensions = append(conv.ccMapSize[:len(conv.ccMapSize):len(conv.ccMapSize)], depth)
+	conv.computeInputIndices()
+	return conv
+}
+
+// InitializeParameters draws new filters using the initializer of the layer.
+func (c *ConvolutionLayer) InitializeParameters(random *rand.Rand) {
+	// Every output value is computed from a filter spanning all channels, every input value is used by every
+	// filter at each of the positions of a filter
+	filterSize := maths.ProductIntSlice(c.filterDimensionSizes)
+	depth := c.filters.Dimensions()[len(c.filters.Dimensions())-1]
+	c.initializer.Initialize(&c.filters, filterSize*c.channels(), filterSize*depth, random)
 }
 
-func (c *ConvolutionLayer) ForwardPropagation(input maths.Tensor) maths.Tensor {
-	c.recentInput = input // might want to rewrite this because it blocks parallel batches
-	var output *maths.Tensor
-
-	// Iterate through each filter, appending result to output tensor.
-	// A filter is a "sub-tensor" of the filters tensor.
-	for iter := maths.NewRegionsIterator(&c.filters, c.filterDimensionSizes, []int{}); iter.HasNext(); {
-		// Compute the cross-correlation map from the input tensor with a filter.
-		// The size of the cross-correlation map has been computed before-hand.
-		// No padding
-		newMap := c.crossCorrelationMap(&input, iter.Next(), c.ccMapSize, []int{})
-		if output == nil {
-			output = newMap
+// extendDims returns a copy of dims extended to length n with value
+func extendDims(dims []int, n int, value int) []int {
+	extended := make([]int, n)
+	for i := range extended {
+		if i < len(dims) {
+			extended[i] = dims[i]
 		} else {
-			output = output.AppendTensor(newMap, len(c.filters.Dimensions()))
+			extended[i] = value
 		}
 	}
+	return extended
+}
 
-	if output == nil {
-		panic("ConvolutionLayer.ForwardPropagation did not work. output == nil")
+// channels returns the number of input channels, 1 if the input has no channel dimension
+func (c *ConvolutionLayer) channels() int {
+	if len(c.inputDims) > len(c.filterDimensionSizes) {
+		return c.inputDims[len(c.filterDimensionSizes)]
 	}
-	return *output
+	return 1
 }
 
-func (c *ConvolutionLayer) BackwardPropagation(gradient maths.Tensor, lr float64) maths.Tensor {
-	var filterGradients *maths.Tensor
-	inputGradients := c.recentInput.Zeroes()
+// filterLen returns the number of values of a single filter
+func (c *ConvolutionLayer) filterLen() int {
+	return maths.ProductIntSlice(c.filterDimensionSizes) * c.channels()
+}
 
-	// We can think of gradient as a series of "gradient filters" which we apply to the recent input.
-	// This is the size of each of those filters.
-	outputGradientSize := gradient.FirstDimsCopy(len(gradient.Dimensions()) - 1)
+// nextCoords increments coords, which index a tensor of size dims, by one position. The first dimension varies
+// the fastest, like the values of a Tensor.
+func nextCoords(coords, dims []int) {
+	for i := range coords {
+		coords[i]++
+		if coords[i] < dims[i] {
+			return
+		}
+		coords[i] = 0
+	}
+}
 
-	//Iterate through each output grad, appending result to filter grad tensor.
-	//Simultaneously, iterate through our original filters, altering them via gradient descent
-	iterGradient := maths.NewRegionsIterator(&gradient, outputGradientSize, []int{})
-	iterFilter := maths.NewRegionsIterator(&c.filters, c.filterDimensionSizes, []int{})
+func (c *ConvolutionLayer) computeInputIndices() {
+	spatialLen := maths.ProductIntSlice(c.filterDimensionSizes)
+	filterLen := c.filterLen()
+	mapLen := maths.ProductIntSlice(c.ccMapSize)
+	channelLen := maths.ProductIntSlice(c.inputDims[:len(c.filterDimensionSizes)])
+	c.inputIndices = make([]int, mapLen*filterLen)
+
+	position := make([]int, len(c.ccMapSize))
+	offset := make([]int, len(c.filterDimensionSizes))
+	for o := 0; o < mapLen; o++ {
+		for k := 0; k < spatialLen; k++ {
+			index := 0
+			for d := len(c.filterDimensionSizes) - 1; d >= 0; d-- {
+				coord := position[d]*c.strides[d] - c.paddingBefore[d] + offset[d]*c.dilation[d]
+				if coord < 0 || coord >= c.inputDims[d] {
+					index = -1
+					break
+				}
+				index = index*c.inputDims[d] + coord
+			}
+			// The channels are the last dimension of both the filter and the input
+			for channel := 0; channel < c.channels(); channel++ {
+				if index < 0 {
+					c.inputIndices[o*filterLen+channel*spatialLen+k] = -1
+				} else {
+					c.inputIndices[o*filterLen+channel*spatialLen+k] = index + channel*channelLen
+				}
+			}
+			nextCoords(offset, c.filterDimensionSizes)
+		}
+		nextCoords(position, c.ccMapSize)
+	}
+}
 
-	for iterGradient.HasNext() && iterFilter.HasNext() {
-		outputLayer := iterGradient.Next()
-		filterLayer := iterFilter.Next()
+// ForwardPropagation computes the cross-correlation of the input with every filter. In Training mode the cache
+// is the input lowered by maths.Im2Col.
+func (c *ConvolutionLayer) ForwardPropagation(input maths.Tensor, mode Mode) (maths.Tensor, Cache) {
+	output := maths.NewTensor(c.outputDimensions, nil)
+	if mode != Training {
+		c.ForwardPropagationInto(input, output)
+		return *output, nil
+	}
+	columns := make([]float64, maths.ProductIntSlice(c.ccMapSize)*c.filterLen())
+	c.forward(input, columns, output)
+	return *output, columns
+}
 
-		// Calculate derivation filters
-		newMap := c.crossCorrelationMap(&c.recentInput, outputLayer, c.filterDimensionSizes, []int{})
-		// Append or assign new map to filter grad tensor
-		if filterGradients == nil {
-			filterGradients = newMap
-		} else {
-			filterGradients = filterGradients.AppendTensor(newMap, len(gradient.Dimensions()))
+// ForwardPropagationInto computes the output of ForwardPropagation in Inference mode into output, lowering the
+// input into a buffer that is reused by later calls.
+func (c *ConvolutionLayer) ForwardPropagationInto(input maths.Tensor, output *maths.Tensor) {
+	length := maths.ProductIntSlice(c.ccMapSize) * c.filterLen()
+	columns, ok := c.columns.Get().(*[]float64)
+	if !ok || len(*columns) != length {
+		buffer := make([]float64, length)
+		columns = &buffer
+	}
+	c.forward(input, *columns, output)
+	c.columns.Put(columns)
+}
+
+// forward lowers input into columns and computes the cross-correlation maps into output
+func (c *ConvolutionLayer) forward(input maths.Tensor, columns []float64, output *maths.Tensor) {
+	filterLen := c.filterLen()
+	mapLen := maths.ProductIntSlice(c.ccMapSize)
+	depth := c.outputDimensions[len(c.outputDimensions)-1]
+
+	// Every row of columns holds the input values a filter is applied to for one position of the
+	// cross-correlation map, so all maps are computed at once as filters (depth x filterLen) * columns^T.
+	// The maps are stacked along the last dimension of the output.
+	maths.Im2Col(columns, input.Values(), c.inputIndices)
+
+	out := output.Values()
+	filters := maths.NewMatrix(depth, filterLen, c.filters.Values())
+	maths.Gemm(false, true, 1, filters, maths.NewMatrix(mapLen, filterLen, columns), 0, maths.NewMatrix(depth, mapLen, out))
+
+	if c.bias {
+		for f := 0; f < depth; f++ {
+			bias := c.biases.At(f)
+			for o := f * mapLen; o < (f+1)*mapLen; o++ {
+				out[o] += bias
+			}
 		}
+	}
+}
 
-		// Calculate derivation input
-		// derivation input = derivation  outputs * flipped filters
-		// To return the correct sized tensor, this requires some padding - which happens to be (filter sizes - 1)
-		padding := maths.AddIntToAll(filterLayer.Dimensions(), -1)
-		flippedFilter := filterLayer.Flip()
-		currentInputGradient := c.crossCorrelationMap(outputLayer, flippedFilter, inputGradients.Dimensions(), padding)
+func (c *ConvolutionLayer) BackwardPropagation(gradient maths.Tensor, cache Cache, grads []*maths.Tensor) maths.Tensor {
+	columns := cache.([]float64)
 
-		inputGradients = inputGradients.Add(currentInputGradient, 1)
-	}
+	filterLen := c.filterLen()
+	mapLen := maths.ProductIntSlice(c.ccMapSize)
+	depth := c.outputDimensions[len(c.outputDimensions)-1]
+
+	filters := maths.NewMatrix(depth, filterLen, c.filters.Values())
+	gradients := maths.NewMatrix(depth, mapLen, gradient.Values())
 
-	if filterGradients == nil {
-		panic("BackwardPropagation did not work correctly in convolution layer. filterGradients == nil")
+	// The filter gradients are gradient * columns, they are accumulated and applied by the optimizer once the
+	// batch is done.
+	maths.Gemm(false, false, 1, gradients, maths.NewMatrix(mapLen, filterLen, columns), 1, maths.NewMatrix(depth, filterLen, grads[0].Values()))
+	if c.bias {
+		biasGradients := grads[1].Values()
+		for f := 0; f < depth; f++ {
+			for _, g := range gradient.Values()[f*mapLen : (f+1)*mapLen] {
+				biasGradients[f] += g
+			}
+		}
 	}
 
-	// Gradient descent on filters
-	c.filters = *c.filters.Add(filterGradients, -1*lr)
+	// The gradient of columns is gradient^T * filters, every value of it belongs to the input value it was copied
+	// from by Im2Col.
+	columnGradients := make([]float64, mapLen*filterLen)
+	maths.Gemm(true, false, 1, gradients, filters, 0, maths.NewMatrix(mapLen, filterLen, columnGradients))
+	inputGradients := make([]float64, maths.ProductIntSlice(c.inputDims))
+	maths.Col2Im(inputGradients, columnGradients, c.inputIndices)
 
 	// Save each filter as an image. This allows for visualisation of the changes to the filter
 	//if c.iteration < 100 {
@@ -216,23 +331,124 @@ func (c *ConvolutionLayer) BackwardPropagation(gradient maths.Tensor, lr float64
 	//	}
 	//}
 	//c.iteration++
-	return *inputGradients
+	return *maths.NewTensor(c.inputDims, inputGradients)
+}
+
+func (c *ConvolutionLayer) Parameters() []*Parameter {
+	params := []*Parameter{{Value: &c.filters, Gradient: &c.filterGradients}}
+	if c.bias {
+		params = append(params, &Parameter{Value: &c.biases, Gradient: &c.biasGradients})
+	}
+	return params
 }
 
 func (c *ConvolutionLayer) OutputDims() []int { return c.outputDimensions }
 
+func (c *ConvolutionLayer) MarshalBinary() ([]byte, error) {
+	var buf bytes.Buffer
+	w := codec.NewWriter(&buf)
+	w.Ints(c.filterDimensionSizes)
+	w.Ints(c.ccMapSize)
+	w.Ints(c.outputDimensions)
+	w.Tensor(&c.filters)
+	w.Ints(c.inputDims)
+	w.Ints(c.strides)
+	w.Ints(c.dilation)
+	w.Ints(c.paddingBefore)
+	w.Ints(c.paddingAfter)
+	w.Bool(c.bias)
+	if c.bias {
+		w.Tensor(&c.biases)
+	}
+	return buf.Bytes(), w.Err()
+}
+
+// convolutionOptionsVersion is the first version of the model format that stores the strides, padding, dilation and
+// biases of a convolution layer
+const convolutionOptionsVersion = 2
+
+func (c *ConvolutionLayer) UnmarshalBinary(data []byte) error {
+	return c.UnmarshalBinaryVersion(data, convolutionOptionsVersion)
+}
+
+func (c *ConvolutionLayer) UnmarshalBinaryVersion(data []byte, version uint32) error {
+	r := codec.NewReader(bytes.NewReader(data))
+	c.filterDimensionSizes = r.Ints()
+	c.ccMapSize = r.Ints()
+	c.outputDimensions = r.Ints()
+	filters := r.Tensor()
+	if err := r.Err(); err != nil {
+		return err
+	}
+	if len(c.filterDimensionSizes) != len(c.ccMapSize) || len(c.outputDimensions) != len(c.ccMapSize)+1 {
+		return errors.New("convolution layer: invalid dimensions")
+	}
+	if version < convolutionOptionsVersion {
+		c.inputDims = maths.AddIntSlices(c.ccMapSize, maths.AddIntToAll(c.filterDimensionSizes, -1))
+		c.strides = extendDims(nil, len(c.ccMapSize), 1)
+		c.dilation = extendDims(nil, len(c.ccMapSize), 1)
+		c.paddingBefore = extendDims(nil, len(c.ccMapSize), 0)
+		c.paddingAfter = extendDims(nil, len(c.ccMapSize), 0)
+		c.bias = false
+	} else {
+		c.inputDims = r.Ints()
+		c.strides = r.Ints()
+		c.dilation = r.Ints()
+		c.paddingBefore = r.Ints()
+		c.paddingAfter = r.Ints()
+		c.bias = r.Bool()
+		if c.bias {
+			biases := r.Tensor()
+			if err := r.Err(); err != nil {
+				return err
+			}
+			if biases.Len() != c.outputDimensions[len(c.outputDimensions)-1] {
+				return errors.New("convolution layer: biases do not match the number of filters")
+			}
+			c.biases = *biases
+			c.biasGradients = *c.biases.Zeroes()
+		}
+		if err := r.Err(); err != nil {
+			return err
+		}
+		for _, dims := range [][]int{c.strides, c.dilation, c.paddingBefore, c.paddingAfter} {
+			if len(dims) != len(c.ccMapSize) {
+				return errors.New("convolution layer: invalid dimensions")
+			}
+		}
+		if len(c.inputDims) != len(c.ccMapSize) && len(c.inputDims) != len(c.ccMapSize)+1 {
+			return errors.New("convolution layer: invalid dimensions")
+		}
+		for i := range c.ccMapSize {
+			if c.strides[i] < 1 || c.dilation[i] < 1 || c.paddingBefore[i] < 0 || c.paddingAfter[i] < 0 {
+				return errors.New("convolution layer: invalid strides, dilation or padding")
+			}
+		}
+	}
+
+	if filters.Len() != c.filterLen()*c.outputDimensions[len(c.outputDimensions)-1] {
+		return errors.New("convolution layer: filters do not match the filter dimensions")
+	}
+	c.filters = *filters
+	c.filterGradients = *c.filters.Zeroes()
+	c.computeInputIndices()
+	return nil
+}
+
 // SaveFiltersAsImages saves the filters to images relative to 'path'
 // returns the amount of images saved.
 // saves as grayscale for now
 func (c *ConvolutionLayer) SaveFiltersAsImages(path string) (int, error) {
 	numFilters := 0
-	for iter := maths.NewRegionsIterator(&c.filters, c.filterDimensionSizes, []int{}); iter.HasNext(); {
-		t := iter.Next() // grab a filter
+	// Every channel of every filter is saved as a separate image
+	spatialLen := maths.ProductIntSlice(c.filterDimensionSizes)
+	for start := 0; start < c.filters.Len(); start += spatialLen {
+		t := c.filters.Values()[start : start+spatialLen] // grab a filter
 
-		pixels := make([]uint8, len(t.Values())) // allocate pixels
+		pixels := make([]uint8, len(t)) // allocate pixels
 
 		for p := 0; p < len(pixels); p++ {
-			c := 255 - uint8(t.At(p)*255)
+			c := 255 - uint8(t[p]*255)
 			pixels[p] = c
 		}
 		gray := image.NewGray(image.Rect(0, 0, c.filterDimensionSizes[0], c.filterDimensionSizes[1]))
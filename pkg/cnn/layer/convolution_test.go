@@ -0,0 +1,175 @@
+package layer_test
+
+import (
+	"bytes"
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/rubenwo/cnn-go/pkg/cnn/gradcheck"
+	"github.com/rubenwo/cnn-go/pkg/cnn/internal/codec"
+	"github.com/rubenwo/cnn-go/pkg/cnn/layer"
+	"github.com/rubenwo/cnn-go/pkg/cnn/maths"
+)
+
+func TestConvolutionGradients(t *testing.T) {
+	tests := []struct {
+		name      string
+		inputDims []int
+		options   []layer.ConvolutionOption
+	}{
+		{name: "valid", inputDims: []int{6, 5, 2}},
+		{name: "single channel", inputDims: []int{6, 5}},
+		{name: "strides", inputDims: []int{7, 6, 2}, options: []layer.ConvolutionOption{layer.WithStrides(2, 3)}},
+		{name: "padding", inputDims: []int{5, 5, 2}, options: []layer.ConvolutionOption{layer.WithPadding(1, 2)}},
+		{name: "same padding", inputDims: []int{5, 4, 2}, options: []layer.ConvolutionOption{layer.WithSamePadding(), layer.WithStrides(2)}},
+		{name: "dilation", inputDims: []int{7, 7, 2}, options: []layer.ConvolutionOption{layer.WithDilation(2, 2)}},
+		{name: "bias", inputDims: []int{5, 5, 3}, options: []layer.ConvolutionOption{layer.WithBias()}},
+	}
+	random := rand.New(rand.NewSource(1))
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			conv := layer.NewConvolutionLayer([]int{3, 2}, 3, test.inputDims, test.options...)
+			gradcheck.Layer(conv, randomTensor(random, test.inputDims...), gradcheck.DefaultConfig).Check(t)
+		})
+	}
+}
+
+// convolutionConfig describes a 2D convolution of an [h, w, c] input with [kh, kw] filters
+type convolutionConfig struct {
+	inputDims, filter          []int
+	depth                      int
+	strides, padding, dilation []int
+}
+
+func (c convolutionConfig) layer() *layer.ConvolutionLayer {
+	return layer.NewConvolutionLayer(c.filter, c.depth, c.inputDims,
+		layer.WithStrides(c.strides...), layer.WithPadding(c.padding...), layer.WithDilation(c.dilation...), layer.WithBias())
+}
+
+// forEachProduct calls fn for every product of an input value and a filter value that contributes to an output
+// value of the convolution, with the coordinates of the three values
+func (c convolutionConfig) forEachProduct(outputDims []int, fn func(input, filter, output []int)) {
+	for y := 0; y < outputDims[0]; y++ {
+		for x := 0; x < outputDims[1]; x++ {
+			for f := 0; f < c.depth; f++ {
+				for i := 0; i < c.filter[0]; i++ {
+					for j := 0; j < c.filter[1]; j++ {
+						row := y*c.strides[0] - c.padding[0] + i*c.dilation[0]
+						col := x*c.strides[1] - c.padding[1] + j*c.dilation[1]
+						if row < 0 || row >= c.inputDims[0] || col < 0 || col >= c.inputDims[1] {
+							continue
+						}
+						for channel := 0; channel < c.inputDims[2]; channel++ {
+							fn([]int{row, col, channel}, []int{i, j, channel, f}, []int{y, x, f})
+						}
+					}
+				}
+			}
+		}
+	}
+}
+
+func assertClose(t *testing.T, name string, got, want maths.Tensor) {
+	t.Helper()
+	if got.Len() != want.Len() {
+		t.Fatalf("%s has %d values, want %d", name, got.Len(), want.Len())
+	}
+	for i := 0; i < want.Len(); i++ {
+		if math.Abs(got.At(i)-want.At(i)) > 1e-9 {
+			t.Fatalf("%s[%d] is %g, want %g", name, i, got.At(i), want.At(i))
+		}
+	}
+}
+
+// TestConvolutionMatchesDirect compares the lowered convolution with a direct cross-correlation
+func TestConvolutionMatchesDirect(t *testing.T) {
+	configs := []convolutionConfig{
+		{inputDims: []int{6, 5, 2}, filter: []int{3, 2}, depth: 3, strides: []int{1, 1}, padding: []int{0, 0}, dilation: []int{1, 1}},
+		{inputDims: []int{9, 8, 3}, filter: []int{3, 3}, depth: 4, strides: []int{2, 3}, padding: []int{1, 2}, dilation: []int{1, 1}},
+		{inputDims: []int{9, 7, 1}, filter: []int{2, 3}, depth: 2, strides: []int{1, 2}, padding: []int{2, 0}, dilation: []int{3, 2}},
+	}
+	random := rand.New(rand.NewSource(1))
+	for _, config := range configs {
+		conv := config.layer()
+		parameters := conv.Parameters()
+		filters, biases := parameters[0].Value, parameters[1].Value
+		biases.Apply(func(float64, int) float64 { return random.NormFloat64() })
+		input := randomTensor(random, config.inputDims...)
+
+		output, cache := conv.ForwardPropagation(input, layer.Training)
+		want := maths.NewTensor(conv.OutputDims(), nil)
+		want.Apply(func(_ float64, i int) float64 { return biases.At(i / (want.Len() / config.depth)) })
+		config.forEachProduct(conv.OutputDims(), func(in, filter, out []int) {
+			want.Set(out, want.AtCoords(out)+input.AtCoords(in)*filters.AtCoords(filter))
+		})
+		assertClose(t, "output", output, *want)
+
+		gradient := randomTensor(random, conv.OutputDims()...)
+		grads := []*maths.Tensor{filters.Zeroes(), biases.Zeroes()}
+		inputGradient := conv.BackwardPropagation(gradient, cache, grads)
+
+		wantInput := input.Zeroes()
+		wantFilters := filters.Zeroes()
+		wantBiases := biases.Zeroes()
+		config.forEachProduct(conv.OutputDims(), func(in, filter, out []int) {
+			g := gradient.AtCoords(out)
+			wantInput.Set(in, wantInput.AtCoords(in)+g*filters.AtCoords(filter))
+			wantFilters.Set(filter, wantFilters.AtCoords(filter)+g*input.AtCoords(in))
+		})
+		for i := 0; i < gradient.Len(); i++ {
+			f := i / (gradient.Len() / config.depth)
+			wantBiases.SetValue(f, wantBiases.At(f)+gradient.At(i))
+		}
+		assertClose(t, "input gradient", inputGradient, *wantInput)
+		assertClose(t, "filter gradient", *grads[0], *wantFilters)
+		assertClose(t, "bias gradient", *grads[1], *wantBiases)
+	}
+}
+
+func TestConvolutionUnmarshalVersion1(t *testing.T) {
+	conv := layer.NewConvolutionLayer([]int{3, 2}, 2, []int{6, 5})
+	filters := conv.Parameters()[0].Value
+
+	// Version 1 of the model format stored the filter sizes, the map size, the output size and the filters
+	var data bytes.Buffer
+	w := codec.NewWriter(&data)
+	w.Ints([]int{3, 2})
+	w.Ints(conv.OutputDims()[:2])
+	w.Ints(conv.OutputDims())
+	w.Tensor(filters)
+
+	loaded := &layer.ConvolutionLayer{}
+	if err := loaded.UnmarshalBinaryVersion(data.Bytes(), 1); err != nil {
+		t.Fatal(err)
+	}
+	input := randomTensor(rand.New(rand.NewSource(1)), 6, 5)
+	want, _ := conv.ForwardPropagation(input, layer.Inference)
+	got, _ := loaded.ForwardPropagation(input, layer.Inference)
+	assertClose(t, "output", got, want)
+
+	if err := (&layer.ConvolutionLayer{}).UnmarshalBinary(data.Bytes()); err == nil {
+		t.Error("a version 1 encoding was decoded as the current version")
+	}
+}
+
+func benchmarkConvolution(b *testing.B, backward bool) {
+	conv := layer.NewConvolutionLayer([]int{3, 3}, 32, []int{28, 28, 16}, layer.WithSamePadding())
+	input := randomTensor(rand.New(rand.NewSource(1)), 28, 28, 16)
+	output, cache := conv.ForwardPropagation(input, layer.Training)
+	parameters := conv.Parameters()
+	grads := []*maths.Tensor{parameters[0].Value.Zeroes()}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if backward {
+			conv.BackwardPropagation(output, cache, grads)
+		} else {
+			conv.ForwardPropagationInto(input, &output)
+		}
+	}
+}
+
+func BenchmarkConvolutionForward(b *testing.B)  { benchmarkConvolution(b, false) }
+func BenchmarkConvolutionBackward(b *testing.B) { benchmarkConvolution(b, true) }
@@ -0,0 +1,162 @@
+package layer
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/rubenwo/cnn-go/pkg/cnn/internal/codec"
+	"github.com/rubenwo/cnn-go/pkg/cnn/maths"
+	"math/rand"
+)
+
+// DropoutLayer sets every value to 0 with probability rate during training and scales the other values by
+// 1 / (1 - rate), so the expected value of every output equals its input (inverted dropout). In Inference mode the
+// input is passed on unchanged.
+type DropoutLayer struct {
+	rate       float64
+	outputDims []int
+}
+
+func NewDropoutLayer(rate float64, inputDims []int) *DropoutLayer {
+	checkDropoutRate(rate)
+	return &DropoutLayer{
+		rate:       rate,
+		outputDims: inputDims}
+}
+
+// ForwardPropagation drops values using the global math/rand source, see ForwardPropagationRandom.
+func (d *DropoutLayer) ForwardPropagation(input maths.Tensor, mode Mode) (maths.Tensor, Cache) {
+	return d.ForwardPropagationRandom(input, mode, nil)
+}
+
+// ForwardPropagationRandom drops values using random. In Training mode the cache is the factor every value was
+// multiplied by.
+func (d *DropoutLayer) ForwardPropagationRandom(input maths.Tensor, mode Mode, random *rand.Rand) (maths.Tensor, Cache) {
+	return dropout(input, mode, d.rate, 1, random)
+}
+
+func (d *DropoutLayer) BackwardPropagation(gradient maths.Tensor, cache Cache, grads []*maths.Tensor) maths.Tensor {
+	return *gradient.MulElem(cache.(*maths.Tensor))
+}
+
+func (d *DropoutLayer) Parameters() []*Parameter { return nil }
+
+func (d *DropoutLayer) OutputDims() []int {
+	return d.outputDims
+}
+
+func (d *DropoutLayer) MarshalBinary() ([]byte, error) {
+	return marshalDropout(d.rate, d.outputDims)
+}
+
+func (d *DropoutLayer) UnmarshalBinary(data []byte) error {
+	rate, inputDims, err := unmarshalDropout(data)
+	if err != nil {
+		return err
+	}
+	*d = *NewDropoutLayer(rate, inputDims)
+	return nil
+}
+
+// SpatialDropoutLayer drops entire feature maps, the values sharing the index of the last dimension, instead of
+// single values. Neighbouring values of a feature map are strongly correlated, so dropping single values of the
+// output of a convolution layer hardly regularizes it. Like DropoutLayer the remaining feature maps are scaled by
+// 1 / (1 - rate) during training and the input is passed on unchanged in Inference mode.
+type SpatialDropoutLayer struct {
+	rate       float64
+	outputDims []int
+}
+
+func NewSpatialDropoutLayer(rate float64, inputDims []int) *SpatialDropoutLayer {
+	checkDropoutRate(rate)
+	return &SpatialDropoutLayer{
+		rate:       rate,
+		outputDims: inputDims}
+}
+
+// ForwardPropagation drops feature maps using the global math/rand source, see ForwardPropagationRandom.
+func (s *SpatialDropoutLayer) ForwardPropagation(input maths.Tensor, mode Mode) (maths.Tensor, Cache) {
+	return s.ForwardPropagationRandom(input, mode, nil)
+}
+
+// ForwardPropagationRandom drops feature maps using random. In Training mode the cache is the factor every value
+// was multiplied by.
+func (s *SpatialDropoutLayer) ForwardPropagationRandom(input maths.Tensor, mode Mode, random *rand.Rand) (maths.Tensor, Cache) {
+	// The values of a feature map are stored one after the other
+	mapLen := input.Len() / s.outputDims[len(s.outputDims)-1]
+	return dropout(input, mode, s.rate, mapLen, random)
+}
+
+func (s *SpatialDropoutLayer) BackwardPropagation(gradient maths.Tensor, cache Cache, grads []*maths.Tensor) maths.Tensor {
+	return *gradient.MulElem(cache.(*maths.Tensor))
+}
+
+func (s *SpatialDropoutLayer) Parameters() []*Parameter { return nil }
+
+func (s *SpatialDropoutLayer) OutputDims() []int {
+	return s.outputDims
+}
+
+func (s *SpatialDropoutLayer) MarshalBinary() ([]byte, error) {
+	return marshalDropout(s.rate, s.outputDims)
+}
+
+func (s *SpatialDropoutLayer) UnmarshalBinary(data []byte) error {
+	rate, inputDims, err := unmarshalDropout(data)
+	if err != nil {
+		return err
+	}
+	*s = *NewSpatialDropoutLayer(rate, inputDims)
+	return nil
+}
+
+func checkDropoutRate(rate float64) {
+	// NaN fails both comparisons
+	if !(rate >= 0 && rate < 1) {
+		panic(fmt.Sprintf("dropout rate %g is not in [0, 1)", rate))
+	}
+}
+
+// dropout keeps groups of groupLen consecutive values of input with probability 1 - rate and scales them by
+// 1 / (1 - rate), the other groups are set to 0. random may be nil to use the global math/rand source.
+func dropout(input maths.Tensor, mode Mode, rate float64, groupLen int, random *rand.Rand) (maths.Tensor, Cache) {
+	if mode != Training {
+		return input, nil
+	}
+	draw := rand.Float64
+	if random != nil {
+		draw = random.Float64
+	}
+
+	mask := input.Zeroes()
+	scale := 1 / (1 - rate)
+	for start := 0; start < mask.Len(); start += groupLen {
+		if draw() < rate {
+			continue
+		}
+		for i := start; i < start+groupLen; i++ {
+			mask.SetValue(i, scale)
+		}
+	}
+	return *input.MulElem(mask), mask
+}
+
+func marshalDropout(rate float64, dims []int) ([]byte, error) {
+	var buf bytes.Buffer
+	w := codec.NewWriter(&buf)
+	w.Float(rate)
+	w.Ints(dims)
+	return buf.Bytes(), w.Err()
+}
+
+func unmarshalDropout(data []byte) (float64, []int, error) {
+	r := codec.NewReader(bytes.NewReader(data))
+	rate := r.Float()
+	dims := r.Ints()
+	if err := r.Err(); err != nil {
+		return 0, nil, err
+	}
+	if !(rate >= 0 && rate < 1) {
+		return 0, nil, fmt.Errorf("dropout layer: invalid rate %g", rate)
+	}
+	return rate, dims, nil
+}
@@ -0,0 +1,132 @@
+package layer_test
+
+import (
+	"bytes"
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/rubenwo/cnn-go/pkg/cnn/internal/codec"
+	"github.com/rubenwo/cnn-go/pkg/cnn/layer"
+	"github.com/rubenwo/cnn-go/pkg/cnn/maths"
+)
+
+// dropoutLayer is implemented by DropoutLayer and SpatialDropoutLayer
+type dropoutLayer interface {
+	layer.Layer
+	ForwardPropagationRandom(input maths.Tensor, mode layer.Mode, random *rand.Rand) (maths.Tensor, layer.Cache)
+}
+
+func TestDropoutInferenceIsIdentity(t *testing.T) {
+	input := randomTensor(rand.New(rand.NewSource(1)), 4, 3, 2)
+	for _, l := range []dropoutLayer{layer.NewDropoutLayer(0.5, []int{4, 3, 2}), layer.NewSpatialDropoutLayer(0.5, []int{4, 3, 2})} {
+		output, _ := l.ForwardPropagationRandom(input, layer.Inference, rand.New(rand.NewSource(1)))
+		for i := 0; i < input.Len(); i++ {
+			if output.At(i) != input.At(i) {
+				t.Fatalf("%T: inference output %v, want the input %v", l, output.Values(), input.Values())
+			}
+		}
+	}
+}
+
+func TestDropoutMask(t *testing.T) {
+	const rate = 0.25
+	input := randomTensor(rand.New(rand.NewSource(1)), 10, 10, 8)
+	dims := input.Dimensions()
+	tests := []struct {
+		layer dropoutLayer
+		// group is the number of consecutive values that are dropped together
+		group int
+	}{
+		{layer: layer.NewDropoutLayer(rate, dims), group: 1},
+		// The values of a feature map, which share the index of the last dimension, are dropped together
+		{layer: layer.NewSpatialDropoutLayer(rate, dims), group: 100},
+	}
+	for _, test := range tests {
+		output, cache := test.layer.ForwardPropagationRandom(input, layer.Training, rand.New(rand.NewSource(2)))
+
+		dropped := 0
+		for start := 0; start < input.Len(); start += test.group {
+			kept := output.At(start) != 0
+			if !kept {
+				dropped++
+			}
+			for i := start; i < start+test.group; i++ {
+				want := 0.0
+				if kept {
+					want = input.At(i) / (1 - rate)
+				}
+				if math.Abs(output.At(i)-want) > 1e-12 {
+					t.Fatalf("%T: output[%d] is %g, want %g", test.layer, i, output.At(i), want)
+				}
+			}
+		}
+		if groups := input.Len() / test.group; dropped == 0 || dropped == groups {
+			t.Errorf("%T: dropped %d of %d groups with rate %g", test.layer, dropped, groups, rate)
+		}
+
+		// The backward pass multiplies the gradient by the same mask
+		gradient := randomTensor(rand.New(rand.NewSource(3)), dims...)
+		inputGradient := test.layer.BackwardPropagation(gradient, cache, nil)
+		for i := 0; i < input.Len(); i++ {
+			want := gradient.At(i) * output.At(i) / input.At(i)
+			if math.Abs(inputGradient.At(i)-want) > 1e-12 {
+				t.Fatalf("%T: input gradient[%d] is %g, want %g", test.layer, i, inputGradient.At(i), want)
+			}
+		}
+	}
+}
+
+func TestDropoutRate(t *testing.T) {
+	// The fraction of dropped values of a large input is close to the rate
+	input := maths.NewTensor([]int{100000}, nil)
+	input.Apply(func(float64, int) float64 { return 1 })
+	for _, rate := range []float64{0, 0.1, 0.5, 0.9} {
+		output, _ := layer.NewDropoutLayer(rate, input.Dimensions()).
+			ForwardPropagationRandom(*input, layer.Training, rand.New(rand.NewSource(1)))
+		dropped := 0
+		for _, v := range output.Values() {
+			if v == 0 {
+				dropped++
+			}
+		}
+		if fraction := float64(dropped) / float64(input.Len()); math.Abs(fraction-rate) > 0.01 {
+			t.Errorf("rate %g dropped a fraction %g of the values", rate, fraction)
+		}
+	}
+}
+
+func TestDropoutRejectsInvalidRates(t *testing.T) {
+	constructors := map[string]func(rate float64){
+		"dropout":         func(rate float64) { layer.NewDropoutLayer(rate, []int{4}) },
+		"spatial dropout": func(rate float64) { layer.NewSpatialDropoutLayer(rate, []int{2, 2}) },
+	}
+	for name, constructor := range constructors {
+		for _, rate := range []float64{-0.1, 1, 1.5, math.NaN()} {
+			func() {
+				defer func() {
+					if recover() == nil {
+						t.Errorf("%s with rate %g did not panic", name, rate)
+					}
+				}()
+				constructor(rate)
+			}()
+		}
+	}
+
+	for _, rate := range []float64{-0.1, 1, math.NaN()} {
+		var buf bytes.Buffer
+		w := codec.NewWriter(&buf)
+		w.Float(rate)
+		w.Ints([]int{4})
+		if err := w.Err(); err != nil {
+			t.Fatal(err)
+		}
+		if err := new(layer.DropoutLayer).UnmarshalBinary(buf.Bytes()); err == nil {
+			t.Errorf("loading a dropout layer with rate %g did not return an error", rate)
+		}
+		if err := new(layer.SpatialDropoutLayer).UnmarshalBinary(buf.Bytes()); err == nil {
+			t.Errorf("loading a spatial dropout layer with rate %g did not return an error", rate)
+		}
+	}
+}
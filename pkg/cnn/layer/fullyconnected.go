@@ -1,75 +1,149 @@
 package layer
 
 import (
+	"bytes"
+	"errors"
+	"github.com/rubenwo/cnn-go/pkg/cnn/internal/codec"
 	"github.com/rubenwo/cnn-go/pkg/cnn/maths"
+	"math/rand"
 )
 
 type FullyConnectedLayer struct {
 	weights maths.Tensor
-	biases  []float64
+	biases  maths.Tensor
 
-	inputDims  []int
-	outputDims []int
+	weightsGradient maths.Tensor
+	biasesGradient  maths.Tensor
 
-	recentOutput []float64
-	recentInput  maths.Tensor
+	inputDims   []int
+	outputDims  []int
+	initializer Initializer
 }
 
-func NewFullyConnectedLayer(outputLength int, inputDims []int) *FullyConnectedLayer {
+// FullyConnectedOption configures a FullyConnectedLayer, see NewFullyConnectedLayer.
+type FullyConnectedOption func(d *FullyConnectedLayer)
+
+// WithWeightInitializer sets the initializer of the weights. The default is XavierNormal.
+func WithWeightInitializer(initializer Initializer) FullyConnectedOption {
+	return func(d *FullyConnectedLayer) { d.initializer = initializer }
+}
+
+// NewFullyConnectedLayer creates a layer connecting every value of an input of size inputDims to outputLength
+// outputs. The biases start at 0.
+func NewFullyConnectedLayer(outputLength int, inputDims []int, options ...FullyConnectedOption) *FullyConnectedLayer {
 	dense := &FullyConnectedLayer{}
+	for _, option := range options {
+		option(dense)
+	}
 	dense.inputDims = inputDims
-	dense.recentInput = *maths.NewTensor(inputDims, nil)
-	dense.recentOutput = make([]float64, outputLength)
 	dense.outputDims = []int{outputLength}
 
 	dense.weights = *maths.NewTensor(append(inputDims, outputLength), nil)
-	dense.weights = *dense.weights.Randomize()
+	if dense.initializer == nil {
+		dense.initializer = XavierNormal{}
+	}
+	dense.InitializeParameters(newRandom())
+
+	dense.biases = *maths.NewTensor(dense.outputDims, nil)
 
-	dense.biases = make([]float64, outputLength)
+	dense.weightsGradient = *dense.weights.Zeroes()
+	dense.biasesGradient = *dense.biases.Zeroes()
 
 	return dense
 }
 
-func (d *FullyConnectedLayer) ForwardPropagation(input maths.Tensor) maths.Tensor {
-	d.recentInput = input
+// InitializeParameters draws new weights using the initializer of the layer.
+func (d *FullyConnectedLayer) InitializeParameters(random *rand.Rand) {
+	d.initializer.Initialize(&d.weights, maths.ProductIntSlice(d.inputDims), d.outputDims[0], random)
+}
 
-	i := maths.NewRegionsIterator(&d.weights, d.inputDims, []int{})
-	for i.HasNext() {
-		d.recentOutput[i.CoordIterator.GetCurrentCount()] = i.Next().InnerProduct(&input)
+// ForwardPropagation computes weights * input + biases. In Training mode the cache is the input.
+func (d *FullyConnectedLayer) ForwardPropagation(input maths.Tensor, mode Mode) (maths.Tensor, Cache) {
+	output := maths.NewTensor(d.outputDims, nil)
+	d.ForwardPropagationInto(input, output)
+	if mode == Training {
+		return *output, input
 	}
-	d.recentOutput = func(l, r []float64) []float64 {
-		ret := make([]float64, len(l))
-		for i := 0; i < len(ret); i++ {
-			ret[i] = l[i] + r[i]
-		}
-		return ret
-	}(d.recentOutput, d.biases)
+	return *output, nil
+}
 
-	return *maths.NewTensor([]int{len(d.recentOutput)}, d.recentOutput)
+func (d *FullyConnectedLayer) ForwardPropagationInto(input maths.Tensor, output *maths.Tensor) {
+	// The weights of every output are stored one after the other, so the weights are an outputs x inputs matrix
+	out := maths.NewVector(output.Len(), output.Values())
+	copy(out.Values(), d.biases.Values())
+	maths.Gemv(false, 1, d.weightsMatrix(d.weights.Values()), maths.NewVector(input.Len(), input.Values()), 1, out)
 }
 
-func (d *FullyConnectedLayer) BackwardPropagation(gradient maths.Tensor, lr float64) maths.Tensor {
-	var weightsGradient *maths.Tensor
-	for i := 0; i < len(gradient.Values()); i++ {
-		newGrads := d.recentInput.MulScalar(gradient.Values()[i])
-		if weightsGradient == nil {
-			weightsGradient = newGrads
-		} else {
-			weightsGradient = weightsGradient.AppendTensor(newGrads, len(d.weights.Dimensions()))
-		}
-	}
+func (d *FullyConnectedLayer) BackwardPropagation(gradient maths.Tensor, cache Cache, grads []*maths.Tensor) maths.Tensor {
+	input := cache.(maths.Tensor)
+	g := maths.NewVector(gradient.Len(), gradient.Values())
 
-	inputGradient := maths.NewTensor(d.inputDims, nil)
-	j := maths.NewRegionsIterator(&d.weights, d.inputDims, []int{})
-	for j.HasNext() {
-		newGrads := j.Next().MulScalar(gradient.Values()[j.CoordIterator.GetCurrentCount()-1])
-		inputGradient = inputGradient.Add(newGrads, 1)
-	}
+	// weights gradient += gradient * input^T, biases gradient += gradient
+	maths.Ger(1, g, maths.NewVector(input.Len(), input.Values()), d.weightsMatrix(grads[0].Values()))
+	maths.Axpy(1, g, maths.NewVector(grads[1].Len(), grads[1].Values()))
+
+	// input gradient = weights^T * gradient
+	inputGradient := maths.NewVector(input.Len(), nil)
+	maths.Gemv(true, 1, d.weightsMatrix(d.weights.Values()), g, 0, inputGradient)
+	return *maths.NewTensor(d.inputDims, inputGradient.Values())
+}
 
-	d.weights = *d.weights.Add(weightsGradient, -1.0*lr)
-	d.biases = maths.AddFloat64Slices(d.biases, maths.MulFloat64ToSlice(gradient.Values(), -1.0*lr))
+// weightsMatrix returns values, the weights or their gradients, as an outputs x inputs matrix
+func (d *FullyConnectedLayer) weightsMatrix(values []float64) *maths.Matrix {
+	return maths.NewMatrix(d.outputDims[0], len(values)/d.outputDims[0], values)
+}
 
-	return *inputGradient
+func (d *FullyConnectedLayer) Parameters() []*Parameter {
+	return []*Parameter{
+		{Value: &d.weights, Gradient: &d.weightsGradient},
+		{Value: &d.biases, Gradient: &d.biasesGradient},
+	}
 }
 
 func (d *FullyConnectedLayer) OutputDims() []int { return d.outputDims }
+
+func (d *FullyConnectedLayer) MarshalBinary() ([]byte, error) {
+	var buf bytes.Buffer
+	w := codec.NewWriter(&buf)
+	w.Ints(d.inputDims)
+	w.Int(d.outputDims[0])
+	w.Tensor(&d.weights)
+	w.Tensor(&d.biases)
+	return buf.Bytes(), w.Err()
+}
+
+func (d *FullyConnectedLayer) UnmarshalBinary(data []byte) error {
+	r := codec.NewReader(bytes.NewReader(data))
+	inputDims := r.Ints()
+	outputLength := r.Int()
+	weights := r.Tensor()
+	biases := r.Tensor()
+	if err := r.Err(); err != nil {
+		return err
+	}
+
+	if len(inputDims) == 0 || outputLength < 1 {
+		return errors.New("fully connected layer: invalid dimensions")
+	}
+	for _, dim := range inputDims {
+		if dim < 1 {
+			return errors.New("fully connected layer: invalid dimensions")
+		}
+	}
+	if weights.Len() != maths.ProductIntSlice(inputDims)*outputLength || biases.Len() != outputLength {
+		return errors.New("fully connected layer: weights do not match the layer dimensions")
+	}
+
+	// The layer is built from the stored weights instead of through the constructor, which would draw random
+	// weights only to replace them
+	*d = FullyConnectedLayer{
+		weights:     *weights,
+		biases:      *biases,
+		inputDims:   inputDims,
+		outputDims:  []int{outputLength},
+		initializer: XavierNormal{},
+	}
+	d.weightsGradient = *d.weights.Zeroes()
+	d.biasesGradient = *d.biases.Zeroes()
+	return nil
+}
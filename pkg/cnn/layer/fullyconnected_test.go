@@ -0,0 +1,17 @@
+package layer_test
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/rubenwo/cnn-go/pkg/cnn/gradcheck"
+	"github.com/rubenwo/cnn-go/pkg/cnn/layer"
+)
+
+func TestFullyConnectedGradients(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+	for _, inputDims := range [][]int{{5}, {3, 2, 2}} {
+		dense := layer.NewFullyConnectedLayer(4, inputDims)
+		gradcheck.Layer(dense, randomTensor(random, inputDims...), gradcheck.DefaultConfig).Check(t)
+	}
+}
@@ -0,0 +1,156 @@
+package layer
+
+import (
+	"fmt"
+	"github.com/rubenwo/cnn-go/pkg/cnn/maths"
+	"math"
+	"math/rand"
+)
+
+// Initializer sets the initial values of the weights of a layer. fanIn is the number of inputs every output of the
+// layer is computed from, fanOut the number of outputs every input contributes to.
+// The weights of every output are stored one after the other, so t can be seen as a matrix with a row per output;
+// Orthogonal makes use of this.
+type Initializer interface {
+	Initialize(t *maths.Tensor, fanIn, fanOut int, random *rand.Rand)
+}
+
+// HeNormal draws weights from a normal distribution with standard deviation sqrt(2 / fanIn), which keeps the
+// variance of the activations constant through ReLU layers (He et al., also known as Kaiming initialization).
+type HeNormal struct{}
+
+func (HeNormal) Initialize(t *maths.Tensor, fanIn, fanOut int, random *rand.Rand) {
+	normal(t, math.Sqrt(2/float64(fanIn)), random)
+}
+
+// HeUniform draws weights uniformly from [-limit, limit] with limit sqrt(6 / fanIn), the same variance as HeNormal.
+type HeUniform struct{}
+
+func (HeUniform) Initialize(t *maths.Tensor, fanIn, fanOut int, random *rand.Rand) {
+	uniform(t, math.Sqrt(6/float64(fanIn)), random)
+}
+
+// XavierNormal draws weights from a normal distribution with standard deviation sqrt(2 / (fanIn + fanOut)),
+// suitable for layers followed by tanh, sigmoid or softmax (Glorot and Bengio).
+type XavierNormal struct{}
+
+func (XavierNormal) Initialize(t *maths.Tensor, fanIn, fanOut int, random *rand.Rand) {
+	normal(t, math.Sqrt(2/float64(fanIn+fanOut)), random)
+}
+
+// XavierUniform draws weights uniformly from [-limit, limit] with limit sqrt(6 / (fanIn + fanOut)).
+type XavierUniform struct{}
+
+func (XavierUniform) Initialize(t *maths.Tensor, fanIn, fanOut int, random *rand.Rand) {
+	uniform(t, math.Sqrt(6/float64(fanIn+fanOut)), random)
+}
+
+// LeCunNormal draws weights from a normal distribution with standard deviation sqrt(1 / fanIn), suitable for
+// SELU activations.
+type LeCunNormal struct{}
+
+func (LeCunNormal) Initialize(t *maths.Tensor, fanIn, fanOut int, random *rand.Rand) {
+	normal(t, math.Sqrt(1/float64(fanIn)), random)
+}
+
+// LeCunUniform draws weights uniformly from [-limit, limit] with limit sqrt(3 / fanIn).
+type LeCunUniform struct{}
+
+func (LeCunUniform) Initialize(t *maths.Tensor, fanIn, fanOut int, random *rand.Rand) {
+	uniform(t, math.Sqrt(3/float64(fanIn)), random)
+}
+
+// TruncatedNormal draws weights from a normal distribution, redrawing values more than 2 standard deviations from
+// the mean. A StdDev of 0 is treated as sqrt(1 / fanIn), like LeCunNormal, so the zero value does not set every
+// weight to Mean. A negative StdDev panics.
+type TruncatedNormal struct {
+	Mean, StdDev float64
+}
+
+func (n TruncatedNormal) Initialize(t *maths.Tensor, fanIn, fanOut int, random *rand.Rand) {
+	stdDev := n.StdDev
+	if stdDev < 0 {
+		panic(fmt.Sprintf("truncated normal standard deviation %g is negative", stdDev))
+	}
+	if stdDev == 0 {
+		stdDev = math.Sqrt(1 / float64(fanIn))
+	}
+	t.Apply(func(float64, int) float64 {
+		for {
+			v := random.NormFloat64()
+			if math.Abs(v) <= 2 {
+				return n.Mean + v*stdDev
+			}
+		}
+	})
+}
+
+// Constant sets every weight to Value.
+type Constant struct {
+	Value float64
+}
+
+func (c Constant) Initialize(t *maths.Tensor, fanIn, fanOut int, random *rand.Rand) {
+	t.Apply(func(float64, int) float64 { return c.Value })
+}
+
+// Orthogonal sets the weights to a random orthogonal matrix multiplied by Gain, with a row per output. If there
+// are more outputs than inputs the columns are orthonormal instead of the rows. A Gain of 0 is treated as 1.
+type Orthogonal struct {
+	Gain float64
+}
+
+func (o Orthogonal) Initialize(t *maths.Tensor, fanIn, fanOut int, random *rand.Rand) {
+	dims := t.Dimensions()
+	rows := dims[len(dims)-1]
+	cols := t.Len() / rows
+	gain := o.Gain
+	if gain == 0 {
+		gain = 1
+	}
+
+	// Orthonormalize the shorter side: n vectors of length m
+	n, m := rows, cols
+	if rows > cols {
+		n, m = cols, rows
+	}
+	vectors := make([]*maths.Vector, n)
+	for i := range vectors {
+		vectors[i] = maths.NewVector(m, nil)
+		for {
+			values := vectors[i].Values()
+			for j := range values {
+				values[j] = random.NormFloat64()
+			}
+			// Modified Gram-Schmidt, redraw in the unlikely case the vector depends on the previous ones
+			for _, previous := range vectors[:i] {
+				maths.Axpy(-maths.Dot(previous, vectors[i]), previous, vectors[i])
+			}
+			if norm := maths.Norm2(vectors[i]); norm > 1e-6 {
+				maths.Scale(1/norm, vectors[i])
+				break
+			}
+		}
+	}
+
+	t.Apply(func(_ float64, idx int) float64 {
+		row, col := idx/cols, idx%cols
+		if rows > cols {
+			return gain * vectors[col].At(row)
+		}
+		return gain * vectors[row].At(col)
+	})
+}
+
+func normal(t *maths.Tensor, stdDev float64, random *rand.Rand) {
+	t.Apply(func(float64, int) float64 { return random.NormFloat64() * stdDev })
+}
+
+func uniform(t *maths.Tensor, limit float64, random *rand.Rand) {
+	t.Apply(func(float64, int) float64 { return (2*random.Float64() - 1) * limit })
+}
+
+// newRandom returns a generator for initializers seeded from the global math/rand source
+func newRandom() *rand.Rand {
+	return rand.New(rand.NewSource(rand.Int63()))
+}
@@ -0,0 +1,164 @@
+package layer_test
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/rubenwo/cnn-go/pkg/cnn/layer"
+	"github.com/rubenwo/cnn-go/pkg/cnn/maths"
+)
+
+// meanAndVariance returns the mean and the population variance of values
+func meanAndVariance(values []float64) (mean, variance float64) {
+	for _, v := range values {
+		mean += v
+	}
+	mean /= float64(len(values))
+	for _, v := range values {
+		variance += (v - mean) * (v - mean)
+	}
+	return mean, variance / float64(len(values))
+}
+
+func TestInitializerVariance(t *testing.T) {
+	const fanIn, fanOut = 200, 50
+	tests := []struct {
+		initializer layer.Initializer
+		variance    float64
+		// limit is the largest magnitude of a uniformly drawn weight, 0 for normal distributions
+		limit float64
+	}{
+		{initializer: layer.HeNormal{}, variance: 2.0 / fanIn},
+		{initializer: layer.HeUniform{}, variance: 2.0 / fanIn, limit: math.Sqrt(6.0 / fanIn)},
+		{initializer: layer.XavierNormal{}, variance: 2.0 / (fanIn + fanOut)},
+		{initializer: layer.XavierUniform{}, variance: 2.0 / (fanIn + fanOut), limit: math.Sqrt(6.0 / (fanIn + fanOut))},
+		{initializer: layer.LeCunNormal{}, variance: 1.0 / fanIn},
+		{initializer: layer.LeCunUniform{}, variance: 1.0 / fanIn, limit: math.Sqrt(3.0 / fanIn)},
+	}
+	for _, test := range tests {
+		weights := maths.NewTensor([]int{fanIn, fanOut}, nil)
+		test.initializer.Initialize(weights, fanIn, fanOut, rand.New(rand.NewSource(1)))
+
+		// The variance of the sample variance of 10000 values is well below 5%
+		mean, variance := meanAndVariance(weights.Values())
+		if math.Abs(mean) > 0.05*math.Sqrt(test.variance) || math.Abs(variance-test.variance) > 0.05*test.variance {
+			t.Errorf("%T: mean %g and variance %g, want 0 and %g", test.initializer, mean, variance, test.variance)
+		}
+		for _, w := range weights.Values() {
+			if test.limit > 0 && math.Abs(w) > test.limit {
+				t.Fatalf("%T: weight %g is outside [-%g, %g]", test.initializer, w, test.limit, test.limit)
+			}
+		}
+	}
+}
+
+func TestOrthogonal(t *testing.T) {
+	const gain = 2
+	// The weights of an output are stored one after the other, the last dimension is the number of outputs
+	for _, dims := range [][]int{{8, 5}, {3, 2, 4}, {3, 7}, {4, 4}} {
+		weights := maths.NewTensor(dims, nil)
+		layer.Orthogonal{Gain: gain}.Initialize(weights, 0, 0, rand.New(rand.NewSource(1)))
+
+		rows := dims[len(dims)-1]
+		cols := weights.Len() / rows
+		at := func(row, col int) float64 { return weights.At(row*cols + col) }
+		// Of the rows and the columns, the shorter ones are orthonormal up to the gain
+		n, m := rows, cols
+		vector := func(i, j int) float64 { return at(i, j) }
+		if rows > cols {
+			n, m = cols, rows
+			vector = func(i, j int) float64 { return at(j, i) }
+		}
+		for i := 0; i < n; i++ {
+			for j := 0; j < n; j++ {
+				dot := 0.0
+				for k := 0; k < m; k++ {
+					dot += vector(i, k) * vector(j, k)
+				}
+				want := 0.0
+				if i == j {
+					want = gain * gain
+				}
+				if math.Abs(dot-want) > 1e-9 {
+					t.Errorf("%v: product of vectors %d and %d is %g, want %g", dims, i, j, dot, want)
+				}
+			}
+		}
+	}
+}
+
+// fanRecorder is an Initializer that records the fans it is called with
+type fanRecorder struct {
+	fanIn, fanOut int
+}
+
+func (r *fanRecorder) Initialize(t *maths.Tensor, fanIn, fanOut int, random *rand.Rand) {
+	r.fanIn, r.fanOut = fanIn, fanOut
+}
+
+func TestLayerFans(t *testing.T) {
+	tests := []struct {
+		name   string
+		new    func(initializer layer.Initializer)
+		fanIn  int
+		fanOut int
+	}{
+		// Every output is computed from a 3x2 filter spanning the 5 input channels, every input value is used by
+		// the 4 filters at each of the 6 positions of a filter
+		{name: "convolution", new: func(initializer layer.Initializer) {
+			layer.NewConvolutionLayer([]int{3, 2}, 4, []int{7, 6, 5}, layer.WithFilterInitializer(initializer))
+		}, fanIn: 3 * 2 * 5, fanOut: 3 * 2 * 4},
+		// An input without channels has a single channel, strides do not change the fans
+		{name: "convolution without channels", new: func(initializer layer.Initializer) {
+			layer.NewConvolutionLayer([]int{3, 3}, 8, []int{7, 6}, layer.WithStrides(2, 2), layer.WithFilterInitializer(initializer))
+		}, fanIn: 3 * 3, fanOut: 3 * 3 * 8},
+		{name: "fully connected", new: func(initializer layer.Initializer) {
+			layer.NewFullyConnectedLayer(5, []int{3, 2}, layer.WithWeightInitializer(initializer))
+		}, fanIn: 3 * 2, fanOut: 5},
+	}
+	for _, test := range tests {
+		recorder := &fanRecorder{}
+		test.new(recorder)
+		if recorder.fanIn != test.fanIn || recorder.fanOut != test.fanOut {
+			t.Errorf("%s: fan in %d and fan out %d, want %d and %d", test.name, recorder.fanIn, recorder.fanOut,
+				test.fanIn, test.fanOut)
+		}
+	}
+}
+
+func TestTruncatedNormal(t *testing.T) {
+	const fanIn = 100
+	tests := []struct {
+		initializer layer.TruncatedNormal
+		stdDev      float64
+	}{
+		{initializer: layer.TruncatedNormal{}, stdDev: math.Sqrt(1.0 / fanIn)},
+		{initializer: layer.TruncatedNormal{Mean: 1, StdDev: 0.5}, stdDev: 0.5},
+	}
+	for _, test := range tests {
+		weights := maths.NewTensor([]int{fanIn, 50}, nil)
+		test.initializer.Initialize(weights, fanIn, 50, rand.New(rand.NewSource(1)))
+
+		for _, w := range weights.Values() {
+			if math.Abs(w-test.initializer.Mean) > 2*test.stdDev {
+				t.Fatalf("%+v: weight %g is more than 2 standard deviations from the mean", test.initializer, w)
+			}
+		}
+		// Truncating at 2 standard deviations reduces the standard deviation to about 0.88 of the untruncated one
+		mean, variance := meanAndVariance(weights.Values())
+		stdDev := math.Sqrt(variance)
+		if math.Abs(mean-test.initializer.Mean) > 0.1*test.stdDev || math.Abs(stdDev-0.88*test.stdDev) > 0.05*test.stdDev {
+			t.Errorf("%+v: mean %g and standard deviation %g", test.initializer, mean, stdDev)
+		}
+	}
+}
+
+func TestTruncatedNormalRejectsNegativeStdDev(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("a negative standard deviation did not panic")
+		}
+	}()
+	layer.TruncatedNormal{StdDev: -1}.Initialize(maths.NewTensor([]int{4}, nil), 4, 1, rand.New(rand.NewSource(1)))
+}
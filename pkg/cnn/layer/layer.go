@@ -2,14 +2,100 @@ package layer
 
 import (
 	"github.com/rubenwo/cnn-go/pkg/cnn/maths"
+	"math/rand"
 )
 
+// Mode tells a layer whether it is used for training or for inference.
+type Mode int
+
+const (
+	Inference Mode = iota
+	Training
+)
+
+// Cache holds whatever a layer records during a forward pass in Training mode to compute the matching backward pass.
+// Its contents are specific to the layer that returned it.
+type Cache interface{}
+
 type Layer interface {
-	ForwardPropagation(input maths.Tensor) maths.Tensor
-	BackwardPropagation(gradient maths.Tensor, lr float64) maths.Tensor
+	// ForwardPropagation computes the output of the layer for input. In Training mode the returned Cache has to be
+	// passed to BackwardPropagation. In Inference mode the returned Cache is nil.
+	// ForwardPropagation does not modify the layer, so it is safe for concurrent use as long as the parameters
+	// are not being updated.
+	ForwardPropagation(input maths.Tensor, mode Mode) (maths.Tensor, Cache)
+	// BackwardPropagation returns the gradient with respect to the input of the forward pass that returned cache.
+	// The gradients with respect to the parameters of the layer are added to grads, which has one tensor for every
+	// parameter, in the order of Parameters(). BackwardPropagation does not modify the layer itself, so it is safe
+	// for concurrent use with different grads.
+	BackwardPropagation(gradient maths.Tensor, cache Cache, grads []*maths.Tensor) maths.Tensor
+	// Parameters returns the trainable parameters of the layer, always in the same order.
+	// Layers without trainable parameters return nil.
+	Parameters() []*Parameter
 
 	OutputDims() []int
 
 	//Copy() Layer
 	//Mutate()
 }
+
+// Parameter is a trainable tensor of a layer together with the gradient that has been accumulated for it over a
+// batch.
+// Optimizers update the values of Value in place.
+type Parameter struct {
+	Value    *maths.Tensor
+	Gradient *maths.Tensor
+}
+
+// Initializable is implemented by layers with randomly initialized parameters. Their constructors initialize them
+// from the global math/rand source, a network initializes them again with its own random number generator when the
+// layer is added, so the initial weights follow from the seed of the network.
+type Initializable interface {
+	InitializeParameters(random *rand.Rand)
+}
+
+// Stochastic is implemented by layers whose output in Training mode is random, like DropoutLayer.
+// ForwardPropagationRandom is ForwardPropagation drawing its random numbers from random, which makes training
+// reproducible. A network passes every example its own generator, so workers never share one.
+type Stochastic interface {
+	ForwardPropagationRandom(input maths.Tensor, mode Mode, random *rand.Rand) (maths.Tensor, Cache)
+}
+
+// BatchLayer is implemented by layers whose output in Training mode depends on the other examples of the batch,
+// like BatchNormLayer. Networks train them on a whole batch at once. Their ForwardPropagation and
+// BackwardPropagation treat a single input as a batch of one.
+type BatchLayer interface {
+	Layer
+	// ForwardPropagationBatch computes the outputs for all inputs of a batch. Like ForwardPropagation it does not
+	// modify the layer.
+	ForwardPropagationBatch(inputs []maths.Tensor, mode Mode) ([]maths.Tensor, Cache)
+	// BackwardPropagationBatch returns the gradients with respect to the inputs of the forward pass that returned
+	// cache, like BackwardPropagation.
+	BackwardPropagationBatch(gradients []maths.Tensor, cache Cache, grads []*maths.Tensor) []maths.Tensor
+}
+
+// Stateful is implemented by layers with state besides their parameters that changes during training, like the
+// running statistics of BatchNormLayer. ForwardPropagation does not modify the layer, in Training mode it records
+// the change in the Cache instead; a network applies it with UpdateState once the forward pass of the layer is done.
+type Stateful interface {
+	// UpdateState applies the change of the state recorded in cache by a forward pass in Training mode.
+	UpdateState(cache Cache)
+	// State returns the state of the layer. Like the values of Parameters it can be read and overwritten in place,
+	// which is how a network takes and restores a snapshot of the layer.
+	State() [][]float64
+}
+
+// BufferedLayer is implemented by layers that can compute their Inference mode output into a tensor provided by the
+// caller, which lets a network reuse the outputs of its layers between predictions instead of allocating them.
+type BufferedLayer interface {
+	Layer
+	// ForwardPropagationInto computes the output of ForwardPropagation in Inference mode into output, which has the
+	// size OutputDims and may hold values of an earlier call. Like ForwardPropagation it does not modify the layer.
+	ForwardPropagationInto(input maths.Tensor, output *maths.Tensor)
+}
+
+// VersionedUnmarshaler is implemented by layers whose encoding changed between versions of the model format.
+// UnmarshalBinaryVersion decodes data written by MarshalBinary in the given version of the format, UnmarshalBinary
+// only decodes the current version.
+type VersionedUnmarshaler interface {
+	UnmarshalBinaryVersion(data []byte, version uint32) error
+}
@@ -0,0 +1,14 @@
+package layer_test
+
+import (
+	"math/rand"
+
+	"github.com/rubenwo/cnn-go/pkg/cnn/maths"
+)
+
+// randomTensor returns a tensor of size dims with normally distributed values
+func randomTensor(random *rand.Rand, dims ...int) maths.Tensor {
+	t := maths.NewTensor(dims, nil)
+	t.Apply(func(float64, int) float64 { return random.NormFloat64() })
+	return *t
+}
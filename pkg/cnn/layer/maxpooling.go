@@ -1,6 +1,8 @@
 package layer
 
 import (
+	"bytes"
+	"github.com/rubenwo/cnn-go/pkg/cnn/internal/codec"
 	"github.com/rubenwo/cnn-go/pkg/cnn/maths"
 	"math"
 )
@@ -9,10 +11,8 @@ type MaxPoolingLayer struct {
 	strides []int
 	sizes   []int
 
-	outputTensor maths.Tensor
-	inputTensor  maths.Tensor
-
-	maxIndices []int
+	inputDims  []int
+	outputDims []int
 }
 
 func NewMaxPoolingLayer(strides, sizes, inputDims []int) *MaxPoolingLayer {
@@ -26,19 +26,18 @@ func NewMaxPoolingLayer(strides, sizes, inputDims []int) *MaxPoolingLayer {
 		m.sizes = append(m.sizes, 1)
 	}
 
-	m.inputTensor = *maths.NewTensor(inputDims, nil)
+	m.inputDims = inputDims
 
-	outputDims := make([]int, len(inputDims))
-	for i := 0; i < len(outputDims); i++ {
-		outputDims[i] = int(math.Ceil((float64(inputDims[i]) - float64(m.sizes[i]) + 1) / float64(m.strides[i])))
+	m.outputDims = make([]int, len(inputDims))
+	for i := 0; i < len(m.outputDims); i++ {
+		m.outputDims[i] = int(math.Ceil((float64(inputDims[i]) - float64(m.sizes[i]) + 1) / float64(m.strides[i])))
 	}
-
-	m.outputTensor = *maths.NewTensor(outputDims, nil)
-	m.maxIndices = make([]int, m.outputTensor.Len())
 	return m
 }
 
-func (m *MaxPoolingLayer) ForwardPropagation(input maths.Tensor) maths.Tensor {
+// ForwardPropagation returns the maximum of every region. In Training mode the cache holds the index of the
+// maximum within every region.
+func (m *MaxPoolingLayer) ForwardPropagation(input maths.Tensor, mode Mode) (maths.Tensor, Cache) {
 	//Apply max function across input
 
 	// At the pooling layer, forward propagation results in an N×N pooling block being reduced to a
@@ -47,35 +46,79 @@ func (m *MaxPoolingLayer) ForwardPropagation(input maths.Tensor) maths.Tensor {
 	// To keep track of the “winning unit” its index noted during the forward pass and used for gradient routing
 	// during backpropagation.
 
+	output := maths.NewTensor(m.outputDims, nil)
+	var maxIndices []int
+	if mode == Training {
+		maxIndices = make([]int, output.Len())
+	}
+	m.forward(input, output, maxIndices)
+
+	if maxIndices == nil {
+		return *output, nil
+	}
+	return *output, maxIndices
+}
+
+func (m *MaxPoolingLayer) ForwardPropagationInto(input maths.Tensor, output *maths.Tensor) {
+	m.forward(input, output, nil)
+}
+
+// forward stores the maximum of every region in output and, unless maxIndices is nil, its index within the region
+// in maxIndices
+func (m *MaxPoolingLayer) forward(input maths.Tensor, output *maths.Tensor, maxIndices []int) {
 	for iter := maths.NewRegionsIteratorWithStrides(&input, m.sizes, []int{}, m.strides); iter.HasNext(); {
 		nextRegion := iter.Next()
 		maxIndex := nextRegion.MaxValueIndex()
 
-		m.maxIndices[iter.CoordIterator.GetCurrentCount()-1] = maxIndex
-		m.outputTensor.SetValue(iter.CoordIterator.GetCurrentCount()-1, nextRegion.At(maxIndex))
+		if maxIndices != nil {
+			maxIndices[iter.CoordIterator.GetCurrentCount()-1] = maxIndex
+		}
+		output.SetValue(iter.CoordIterator.GetCurrentCount()-1, nextRegion.At(maxIndex))
 	}
-
-	return m.outputTensor
 }
-func (m *MaxPoolingLayer) BackwardPropagation(gradient maths.Tensor, lr float64) maths.Tensor {
-	inputGradients := m.inputTensor.Zeroes() // Creates a new tensor with the same dimensions, but zero-valued
-
+func (m *MaxPoolingLayer) BackwardPropagation(gradient maths.Tensor, cache Cache, grads []*maths.Tensor) maths.Tensor {
+	maxIndices := cache.([]int)
+	inputGradients := maths.NewTensor(m.inputDims, nil)
 
 	// the error is just assigned to where it comes from - the “winning unit” because other units in the previous
-	// layer’s pooling blocks did not contribute to it hence all the other assigned values of zero
+	// layer’s pooling blocks did not contribute to it hence all the other assigned values of zero. Regions overlap
+	// when the strides are smaller than the sizes, so a unit can win several regions and its errors are summed.
 	for iter := maths.NewRegionsIteratorWithStrides(inputGradients, m.sizes, []int{}, m.strides); iter.HasNext(); {
 		iter.Next()
 
-		maxIndex := m.maxIndices[iter.CoordIterator.GetCurrentCount()-1]
+		maxIndex := maxIndices[iter.CoordIterator.GetCurrentCount()-1]
 		maxCoords := maths.HornerToCoords(maxIndex, m.sizes)
 
 		regionStart := iter.CoordIterator.GetCurrentCoords()
 		coordsOfMax := maths.AddIntSlices(regionStart, maxCoords)
 
-		inputGradients.Set(coordsOfMax, gradient.At(iter.CoordIterator.GetCurrentCount()-1))
+		inputGradients.Set(coordsOfMax, inputGradients.AtCoords(coordsOfMax)+gradient.At(iter.CoordIterator.GetCurrentCount()-1))
 	}
 
 	return *inputGradients
 }
 
-func (m *MaxPoolingLayer) OutputDims() []int { return m.outputTensor.Dimensions() }
+func (m *MaxPoolingLayer) Parameters() []*Parameter { return nil }
+
+func (m *MaxPoolingLayer) OutputDims() []int { return m.outputDims }
+
+func (m *MaxPoolingLayer) MarshalBinary() ([]byte, error) {
+	var buf bytes.Buffer
+	w := codec.NewWriter(&buf)
+	w.Ints(m.strides)
+	w.Ints(m.sizes)
+	w.Ints(m.inputDims)
+	return buf.Bytes(), w.Err()
+}
+
+func (m *MaxPoolingLayer) UnmarshalBinary(data []byte) error {
+	r := codec.NewReader(bytes.NewReader(data))
+	strides := r.Ints()
+	sizes := r.Ints()
+	inputDims := r.Ints()
+	if err := r.Err(); err != nil {
+		return err
+	}
+	*m = *NewMaxPoolingLayer(strides, sizes, inputDims)
+	return nil
+}
@@ -0,0 +1,26 @@
+package layer_test
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/rubenwo/cnn-go/pkg/cnn/gradcheck"
+	"github.com/rubenwo/cnn-go/pkg/cnn/layer"
+)
+
+func TestMaxPoolingGradients(t *testing.T) {
+	tests := []struct {
+		strides, sizes, inputDims []int
+	}{
+		{strides: []int{2, 2}, sizes: []int{2, 2}, inputDims: []int{6, 6, 2}},
+		// Overlapping regions, the maximum of a value can be routed to from several outputs
+		{strides: []int{1, 1}, sizes: []int{2, 3}, inputDims: []int{5, 5, 1}},
+		{strides: []int{3}, sizes: []int{3}, inputDims: []int{9}},
+	}
+	// Normally distributed values have no ties, which would make the maximum not differentiable
+	random := rand.New(rand.NewSource(1))
+	for _, test := range tests {
+		m := layer.NewMaxPoolingLayer(test.strides, test.sizes, test.inputDims)
+		gradcheck.Layer(m, randomTensor(random, test.inputDims...), gradcheck.DefaultConfig).Check(t)
+	}
+}
@@ -0,0 +1,411 @@
+package layer
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/rubenwo/cnn-go/pkg/cnn/internal/codec"
+	"github.com/rubenwo/cnn-go/pkg/cnn/maths"
+	"math"
+)
+
+// NormalizationOption configures a BatchNormLayer or LayerNormLayer.
+type NormalizationOption func(c *normalizationConfig)
+
+type normalizationConfig struct {
+	epsilon  float64
+	momentum float64
+}
+
+// WithEpsilon sets the value added to the variance before taking its square root. The default is 1e-5.
+func WithEpsilon(epsilon float64) NormalizationOption {
+	return func(c *normalizationConfig) { c.epsilon = epsilon }
+}
+
+// WithMomentum sets the fraction of the running mean and variance of a BatchNormLayer that is kept at every batch.
+// The default is 0.9. LayerNormLayer ignores it.
+func WithMomentum(momentum float64) NormalizationOption {
+	return func(c *normalizationConfig) { c.momentum = momentum }
+}
+
+func newNormalizationConfig(options []NormalizationOption) normalizationConfig {
+	c := normalizationConfig{epsilon: 1e-5, momentum: 0.9}
+	for _, option := range options {
+		option(&c)
+	}
+	if c.epsilon <= 0 {
+		panic(fmt.Sprintf("normalization epsilon %g is not positive", c.epsilon))
+	}
+	if c.momentum < 0 || c.momentum >= 1 {
+		panic(fmt.Sprintf("batch normalization momentum %g is not in [0, 1)", c.momentum))
+	}
+	return c
+}
+
+// BatchNormLayer normalizes every channel to mean 0 and variance 1 over the batch, then scales it by gamma and
+// shifts it by beta, which are learned. The last dimension of the input is the channel dimension: a dense output
+// has a channel per value, the output of a convolution layer a channel per filter, whose statistics are taken over
+// all positions.
+// In Inference mode the layer uses a running average of the mean and variance of the batches it was trained on,
+// which a network updates through UpdateState.
+type BatchNormLayer struct {
+	normalizationConfig
+
+	gamma maths.Tensor
+	beta  maths.Tensor
+
+	gammaGradient maths.Tensor
+	betaGradient  maths.Tensor
+
+	runningMean     []float64
+	runningVariance []float64
+
+	outputDims []int
+}
+
+func NewBatchNormLayer(inputDims []int, options ...NormalizationOption) *BatchNormLayer {
+	b := &BatchNormLayer{normalizationConfig: newNormalizationConfig(options)}
+	b.outputDims = inputDims
+
+	channels := inputDims[len(inputDims)-1]
+	b.gamma = *maths.NewTensor([]int{channels}, nil)
+	b.gamma.Apply(func(float64, int) float64 { return 1 })
+	b.beta = *maths.NewTensor([]int{channels}, nil)
+	b.gammaGradient = *b.gamma.Zeroes()
+	b.betaGradient = *b.beta.Zeroes()
+
+	b.runningMean = make([]float64, channels)
+	b.runningVariance = make([]float64, channels)
+	for c := range b.runningVariance {
+		b.runningVariance[c] = 1
+	}
+	return b
+}
+
+// batchNormCache holds the normalized inputs, the standard deviation of every channel and the statistics of the batch
+// the running statistics are updated with
+type batchNormCache struct {
+	normalized [][]float64
+	stdDev     []float64
+
+	mean, unbiasedVariance []float64
+}
+
+// ForwardPropagation normalizes input as a batch of one, see ForwardPropagationBatch.
+func (b *BatchNormLayer) ForwardPropagation(input maths.Tensor, mode Mode) (maths.Tensor, Cache) {
+	outputs, cache := b.ForwardPropagationBatch([]maths.Tensor{input}, mode)
+	return outputs[0], cache
+}
+
+// ForwardPropagationInto normalizes input with the running statistics into output, like ForwardPropagation in
+// Inference mode.
+func (b *BatchNormLayer) ForwardPropagationInto(input maths.Tensor, output *maths.Tensor) {
+	mapLen := output.Len() / b.gamma.Len()
+	out := output.Values()
+	for i, v := range input.Values() {
+		c := i / mapLen
+		normalized := (v - b.runningMean[c]) / math.Sqrt(b.runningVariance[c]+b.epsilon)
+		out[i] = b.gamma.At(c)*normalized + b.beta.At(c)
+	}
+}
+
+// ForwardPropagationBatch normalizes inputs with the statistics of the batch in Training mode, the cache then holds
+// them for UpdateState. In Inference mode it uses the running statistics.
+func (b *BatchNormLayer) ForwardPropagationBatch(inputs []maths.Tensor, mode Mode) ([]maths.Tensor, Cache) {
+	channels := b.gamma.Len()
+	mapLen := maths.ProductIntSlice(b.outputDims) / channels
+
+	mean, variance := b.runningMean, b.runningVariance
+	var unbiasedVariance []float64
+	if mode == Training {
+		mean, variance = make([]float64, channels), make([]float64, channels)
+		count := float64(len(inputs) * mapLen)
+		for _, input := range inputs {
+			values := input.Values()
+			for i, v := range values {
+				mean[i/mapLen] += v / count
+			}
+		}
+		for _, input := range inputs {
+			values := input.Values()
+			for i, v := range values {
+				d := v - mean[i/mapLen]
+				variance[i/mapLen] += d * d / count
+			}
+		}
+
+		// The running variance is an estimate of the variance of the whole data set, so it uses the unbiased
+		// variance of the batch
+		correction := 1.0
+		if count > 1 {
+			correction = count / (count - 1)
+		}
+		unbiasedVariance = make([]float64, channels)
+		for c := range unbiasedVariance {
+			unbiasedVariance[c] = variance[c] * correction
+		}
+	}
+
+	stdDev := make([]float64, channels)
+	for c := range stdDev {
+		stdDev[c] = math.Sqrt(variance[c] + b.epsilon)
+	}
+
+	outputs := make([]maths.Tensor, len(inputs))
+	normalized := make([][]float64, len(inputs))
+	for j, input := range inputs {
+		values := input.Values()
+		normalized[j] = make([]float64, len(values))
+		output := make([]float64, len(values))
+		for i, v := range values {
+			c := i / mapLen
+			normalized[j][i] = (v - mean[c]) / stdDev[c]
+			output[i] = b.gamma.At(c)*normalized[j][i] + b.beta.At(c)
+		}
+		outputs[j] = *maths.NewTensor(b.outputDims, output)
+	}
+
+	if mode == Training {
+		return outputs, &batchNormCache{normalized: normalized, stdDev: stdDev, mean: mean, unbiasedVariance: unbiasedVariance}
+	}
+	return outputs, nil
+}
+
+func (b *BatchNormLayer) BackwardPropagation(gradient maths.Tensor, cache Cache, grads []*maths.Tensor) maths.Tensor {
+	return b.BackwardPropagationBatch([]maths.Tensor{gradient}, cache, grads)[0]
+}
+
+func (b *BatchNormLayer) BackwardPropagationBatch(gradients []maths.Tensor, cache Cache, grads []*maths.Tensor) []maths.Tensor {
+	bc := cache.(*batchNormCache)
+	channels := b.gamma.Len()
+	mapLen := maths.ProductIntSlice(b.outputDims) / channels
+	count := float64(len(gradients) * mapLen)
+
+	// With n = (x - mean) / stdDev and y = gamma * n + beta:
+	// dx = gamma / (count * stdDev) * (count * dy - sum(dy) - n * sum(dy * n)), summed over the channel
+	sum := make([]float64, channels)
+	sumNormalized := make([]float64, channels)
+	for j, gradient := range gradients {
+		for i, g := range gradient.Values() {
+			c := i / mapLen
+			sum[c] += g
+			sumNormalized[c] += g * bc.normalized[j][i]
+		}
+	}
+	for c := 0; c < channels; c++ {
+		grads[0].SetValue(c, grads[0].At(c)+sumNormalized[c])
+		grads[1].SetValue(c, grads[1].At(c)+sum[c])
+	}
+
+	inputGradients := make([]maths.Tensor, len(gradients))
+	for j, gradient := range gradients {
+		values := gradient.Values()
+		inputGradient := make([]float64, len(values))
+		for i, g := range values {
+			c := i / mapLen
+			inputGradient[i] = b.gamma.At(c) / (count * bc.stdDev[c]) * (count*g - sum[c] - bc.normalized[j][i]*sumNormalized[c])
+		}
+		inputGradients[j] = *maths.NewTensor(b.outputDims, inputGradient)
+	}
+	return inputGradients
+}
+
+// UpdateState moves the running statistics towards the statistics of the batch that returned cache.
+func (b *BatchNormLayer) UpdateState(cache Cache) {
+	bc := cache.(*batchNormCache)
+	for c := range b.runningMean {
+		b.runningMean[c] = b.momentum*b.runningMean[c] + (1-b.momentum)*bc.mean[c]
+		b.runningVariance[c] = b.momentum*b.runningVariance[c] + (1-b.momentum)*bc.unbiasedVariance[c]
+	}
+}
+
+// State returns the running mean and variance.
+func (b *BatchNormLayer) State() [][]float64 { return [][]float64{b.runningMean, b.runningVariance} }
+
+func (b *BatchNormLayer) Parameters() []*Parameter {
+	return []*Parameter{
+		{Value: &b.gamma, Gradient: &b.gammaGradient},
+		{Value: &b.beta, Gradient: &b.betaGradient},
+	}
+}
+
+func (b *BatchNormLayer) OutputDims() []int { return b.outputDims }
+
+func (b *BatchNormLayer) MarshalBinary() ([]byte, error) {
+	var buf bytes.Buffer
+	w := codec.NewWriter(&buf)
+	w.Ints(b.outputDims)
+	w.Float(b.epsilon)
+	w.Float(b.momentum)
+	w.Tensor(&b.gamma)
+	w.Tensor(&b.beta)
+	w.Floats(b.runningMean)
+	w.Floats(b.runningVariance)
+	return buf.Bytes(), w.Err()
+}
+
+func (b *BatchNormLayer) UnmarshalBinary(data []byte) error {
+	r := codec.NewReader(bytes.NewReader(data))
+	inputDims := r.Ints()
+	epsilon := r.Float()
+	momentum := r.Float()
+	gamma := r.Tensor()
+	beta := r.Tensor()
+	runningMean := r.Floats()
+	runningVariance := r.Floats()
+	if err := r.Err(); err != nil {
+		return err
+	}
+	if len(inputDims) == 0 || epsilon <= 0 || momentum < 0 || momentum >= 1 {
+		return errors.New("batch normalization layer: invalid configuration")
+	}
+
+	*b = *NewBatchNormLayer(inputDims, WithEpsilon(epsilon), WithMomentum(momentum))
+	channels := b.gamma.Len()
+	if gamma.Len() != channels || beta.Len() != channels || len(runningMean) != channels || len(runningVariance) != channels {
+		return errors.New("batch normalization layer: parameters do not match the number of channels")
+	}
+	b.gamma = *gamma
+	b.beta = *beta
+	b.runningMean = runningMean
+	b.runningVariance = runningVariance
+	return nil
+}
+
+// LayerNormLayer normalizes every example to mean 0 and variance 1 over all its values, then scales every value by
+// gamma and shifts it by beta, which are learned and have the size of the input. Unlike BatchNormLayer it does not
+// depend on the other examples of the batch, so it behaves the same in Training and Inference mode.
+type LayerNormLayer struct {
+	normalizationConfig
+
+	gamma maths.Tensor
+	beta  maths.Tensor
+
+	gammaGradient maths.Tensor
+	betaGradient  maths.Tensor
+
+	outputDims []int
+}
+
+func NewLayerNormLayer(inputDims []int, options ...NormalizationOption) *LayerNormLayer {
+	l := &LayerNormLayer{normalizationConfig: newNormalizationConfig(options)}
+	l.outputDims = inputDims
+
+	l.gamma = *maths.NewTensor(inputDims, nil)
+	l.gamma.Apply(func(float64, int) float64 { return 1 })
+	l.beta = *maths.NewTensor(inputDims, nil)
+	l.gammaGradient = *l.gamma.Zeroes()
+	l.betaGradient = *l.beta.Zeroes()
+	return l
+}
+
+// layerNormCache holds the normalized input and its standard deviation
+type layerNormCache struct {
+	normalized []float64
+	stdDev     float64
+}
+
+// ForwardPropagation normalizes input. In Training mode the cache is the normalized input and its standard
+// deviation.
+func (l *LayerNormLayer) ForwardPropagation(input maths.Tensor, mode Mode) (maths.Tensor, Cache) {
+	output := maths.NewTensor(l.outputDims, nil)
+	if mode != Training {
+		l.ForwardPropagationInto(input, output)
+		return *output, nil
+	}
+	normalized := make([]float64, output.Len())
+	stdDev := l.forward(input, output, normalized)
+	return *output, &layerNormCache{normalized: normalized, stdDev: stdDev}
+}
+
+func (l *LayerNormLayer) ForwardPropagationInto(input maths.Tensor, output *maths.Tensor) {
+	l.forward(input, output, nil)
+}
+
+// forward normalizes input into output and returns the standard deviation of input. Unless normalized is nil the
+// normalized values are stored in it.
+func (l *LayerNormLayer) forward(input maths.Tensor, output *maths.Tensor, normalized []float64) float64 {
+	values := input.Values()
+	count := float64(len(values))
+	mean := maths.SumFloat64Slice(values) / count
+	variance := 0.0
+	for _, v := range values {
+		variance += (v - mean) * (v - mean) / count
+	}
+	stdDev := math.Sqrt(variance + l.epsilon)
+
+	out := output.Values()
+	for i, v := range values {
+		n := (v - mean) / stdDev
+		if normalized != nil {
+			normalized[i] = n
+		}
+		out[i] = l.gamma.At(i)*n + l.beta.At(i)
+	}
+	return stdDev
+}
+
+func (l *LayerNormLayer) BackwardPropagation(gradient maths.Tensor, cache Cache, grads []*maths.Tensor) maths.Tensor {
+	lc := cache.(*layerNormCache)
+	values := gradient.Values()
+	count := float64(len(values))
+
+	// Like BatchNormLayer, with the gradient of the normalized values dn = dy * gamma:
+	// dx = (count * dn - sum(dn) - n * sum(dn * n)) / (count * stdDev)
+	normalizedGradient := make([]float64, len(values))
+	sum, sumNormalized := 0.0, 0.0
+	for i, g := range values {
+		grads[0].SetValue(i, grads[0].At(i)+g*lc.normalized[i])
+		grads[1].SetValue(i, grads[1].At(i)+g)
+		normalizedGradient[i] = g * l.gamma.At(i)
+		sum += normalizedGradient[i]
+		sumNormalized += normalizedGradient[i] * lc.normalized[i]
+	}
+
+	inputGradient := make([]float64, len(values))
+	for i, dn := range normalizedGradient {
+		inputGradient[i] = (count*dn - sum - lc.normalized[i]*sumNormalized) / (count * lc.stdDev)
+	}
+	return *maths.NewTensor(l.outputDims, inputGradient)
+}
+
+func (l *LayerNormLayer) Parameters() []*Parameter {
+	return []*Parameter{
+		{Value: &l.gamma, Gradient: &l.gammaGradient},
+		{Value: &l.beta, Gradient: &l.betaGradient},
+	}
+}
+
+func (l *LayerNormLayer) OutputDims() []int { return l.outputDims }
+
+func (l *LayerNormLayer) MarshalBinary() ([]byte, error) {
+	var buf bytes.Buffer
+	w := codec.NewWriter(&buf)
+	w.Ints(l.outputDims)
+	w.Float(l.epsilon)
+	w.Tensor(&l.gamma)
+	w.Tensor(&l.beta)
+	return buf.Bytes(), w.Err()
+}
+
+func (l *LayerNormLayer) UnmarshalBinary(data []byte) error {
+	r := codec.NewReader(bytes.NewReader(data))
+	inputDims := r.Ints()
+	epsilon := r.Float()
+	gamma := r.Tensor()
+	beta := r.Tensor()
+	if err := r.Err(); err != nil {
+		return err
+	}
+	if epsilon <= 0 {
+		return errors.New("layer normalization layer: invalid epsilon")
+	}
+
+	*l = *NewLayerNormLayer(inputDims, WithEpsilon(epsilon))
+	if gamma.Len() != l.gamma.Len() || beta.Len() != l.beta.Len() {
+		return errors.New("layer normalization layer: parameters do not match the layer dimensions")
+	}
+	l.gamma = *gamma
+	l.beta = *beta
+	return nil
+}
@@ -0,0 +1,57 @@
+package layer_test
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/rubenwo/cnn-go/pkg/cnn/gradcheck"
+	"github.com/rubenwo/cnn-go/pkg/cnn/layer"
+	"github.com/rubenwo/cnn-go/pkg/cnn/maths"
+)
+
+func TestNormalizationGradients(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+	for _, dims := range [][]int{{5}, {3, 3, 2}} {
+		input := randomTensor(random, dims...)
+		gradcheck.Layer(layer.NewBatchNormLayer(dims), input, gradcheck.DefaultConfig).Check(t)
+		gradcheck.Layer(layer.NewLayerNormLayer(dims), input, gradcheck.DefaultConfig).Check(t)
+	}
+}
+
+func TestBatchNormBatchGradients(t *testing.T) {
+	// Every channel is normalized over the batch and the positions of its feature map. Without a feature map a
+	// single example is normalized to beta, so the gradients of the input and of gamma need larger batches.
+	random := rand.New(rand.NewSource(2))
+	for _, dims := range [][]int{{5}, {2, 3}, {3, 3, 2}} {
+		for _, batchSize := range []int{2, 4} {
+			b := layer.NewBatchNormLayer(dims)
+			// gamma and beta start at 1 and 0, other values make sure they are used correctly
+			for _, p := range b.Parameters() {
+				p.Value.Apply(func(float64, int) float64 { return random.NormFloat64() })
+			}
+			inputs := make([]maths.Tensor, batchSize)
+			for j := range inputs {
+				inputs[j] = randomTensor(random, dims...)
+			}
+			gradcheck.Batch(b, inputs, gradcheck.DefaultConfig).Check(t)
+		}
+	}
+}
+
+func TestBatchNormStateIsUpdatedByTheNetwork(t *testing.T) {
+	b := layer.NewBatchNormLayer([]int{2, 1}, layer.WithMomentum(0.5))
+	inputs := []maths.Tensor{*maths.NewTensor([]int{2, 1}, []float64{1, 3}), *maths.NewTensor([]int{2, 1}, []float64{5, 7})}
+
+	_, cache := b.ForwardPropagationBatch(inputs, layer.Training)
+	state := b.State()
+	if state[0][0] != 0 || state[1][0] != 1 {
+		t.Fatalf("the forward pass changed the running statistics to %v", state)
+	}
+
+	// The batch has mean 4 and unbiased variance 20 / 3
+	b.UpdateState(cache)
+	if mean, variance := state[0][0], state[1][0]; mean != 2 || math.Abs(variance-(0.5+10.0/3)) > 1e-12 {
+		t.Errorf("running mean %g and variance %g after the update", mean, variance)
+	}
+}
@@ -0,0 +1,105 @@
+package layer
+
+import (
+	"bytes"
+	"errors"
+	"github.com/rubenwo/cnn-go/pkg/cnn/internal/codec"
+	"github.com/rubenwo/cnn-go/pkg/cnn/maths"
+)
+
+// PReLULayer applies x for x > 0 and alpha * x otherwise, like LeakyReLULayer, but learns the slope alpha. Every
+// channel, the last dimension of the input, has its own slope; the slopes start at 0.25.
+type PReLULayer struct {
+	alpha         maths.Tensor
+	alphaGradient maths.Tensor
+
+	outputDims []int
+}
+
+func NewPReLULayer(inputDims []int) *PReLULayer {
+	p := &PReLULayer{outputDims: inputDims}
+	p.alpha = *maths.NewTensor([]int{inputDims[len(inputDims)-1]}, nil)
+	p.alpha.Apply(func(float64, int) float64 { return 0.25 })
+	p.alphaGradient = *p.alpha.Zeroes()
+	return p
+}
+
+// mapLen returns the number of values of every channel, which are stored one after the other
+func (p *PReLULayer) mapLen() int {
+	return maths.ProductIntSlice(p.outputDims) / p.alpha.Len()
+}
+
+// ForwardPropagation applies the activation to every value. In Training mode the cache is the input.
+func (p *PReLULayer) ForwardPropagation(input maths.Tensor, mode Mode) (maths.Tensor, Cache) {
+	output := maths.NewTensor(p.outputDims, nil)
+	p.ForwardPropagationInto(input, output)
+	if mode == Training {
+		return *output, input
+	}
+	return *output, nil
+}
+
+func (p *PReLULayer) ForwardPropagationInto(input maths.Tensor, output *maths.Tensor) {
+	mapLen := p.mapLen()
+	out := output.Values()
+	for i, x := range input.Values() {
+		if x > 0 {
+			out[i] = x
+		} else {
+			out[i] = p.alpha.At(i/mapLen) * x
+		}
+	}
+}
+
+// BackwardPropagation returns the input gradient and adds x * gradient of every negative input x to the gradient of
+// the slope of its channel.
+func (p *PReLULayer) BackwardPropagation(gradient maths.Tensor, cache Cache, grads []*maths.Tensor) maths.Tensor {
+	mapLen := p.mapLen()
+	in := cache.(maths.Tensor)
+	input := in.Values()
+	values := gradient.Values()
+	inputGradient := make([]float64, len(values))
+	for i, g := range values {
+		if input[i] > 0 {
+			inputGradient[i] = g
+			continue
+		}
+		c := i / mapLen
+		inputGradient[i] = p.alpha.At(c) * g
+		grads[0].SetValue(c, grads[0].At(c)+input[i]*g)
+	}
+	return *maths.NewTensor(p.outputDims, inputGradient)
+}
+
+func (p *PReLULayer) Parameters() []*Parameter {
+	return []*Parameter{{Value: &p.alpha, Gradient: &p.alphaGradient}}
+}
+
+func (p *PReLULayer) OutputDims() []int { return p.outputDims }
+
+func (p *PReLULayer) MarshalBinary() ([]byte, error) {
+	var buf bytes.Buffer
+	w := codec.NewWriter(&buf)
+	w.Ints(p.outputDims)
+	w.Tensor(&p.alpha)
+	return buf.Bytes(), w.Err()
+}
+
+func (p *PReLULayer) UnmarshalBinary(data []byte) error {
+	r := codec.NewReader(bytes.NewReader(data))
+	inputDims := r.Ints()
+	alpha := r.Tensor()
+	if err := r.Err(); err != nil {
+		return err
+	}
+	if len(inputDims) == 0 {
+		return errors.New("prelu layer: invalid dimensions")
+	}
+
+	*p = *NewPReLULayer(inputDims)
+	if alpha.Len() != p.alpha.Len() {
+		return errors.New("prelu layer: slopes do not match the number of channels")
+	}
+	p.alpha = *alpha
+	return nil
+}
@@ -0,0 +1,69 @@
+package layer
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// registry maps the name of every layer type that can be saved to a function returning an empty layer of that type.
+// The empty layer is initialised by its UnmarshalBinary method when a network is loaded.
+var registry = map[string]func() Layer{}
+
+// names is the reverse of registry
+var names = map[reflect.Type]string{}
+
+func init() {
+	Register("convolution", func() Layer { return &ConvolutionLayer{} })
+	Register("fully_connected", func() Layer { return &FullyConnectedLayer{} })
+	Register("max_pooling", func() Layer { return &MaxPoolingLayer{} })
+	Register("relu", func() Layer { return &ReLULayer{} })
+	Register("softmax", func() Layer { return &SoftmaxLayer{} })
+	Register("dropout", func() Layer { return &DropoutLayer{} })
+	Register("spatial_dropout", func() Layer { return &SpatialDropoutLayer{} })
+	Register("batch_norm", func() Layer { return &BatchNormLayer{} })
+	Register("layer_norm", func() Layer { return &LayerNormLayer{} })
+	Register("sigmoid", func() Layer { return &SigmoidLayer{} })
+	Register("tanh", func() Layer { return &TanhLayer{} })
+	Register("leaky_relu", func() Layer { return &LeakyReLULayer{} })
+	Register("elu", func() Layer { return &ELULayer{} })
+	Register("selu", func() Layer { return &SELULayer{} })
+	Register("gelu", func() Layer { return &GELULayer{} })
+	Register("swish", func() Layer { return &SwishLayer{} })
+	Register("softplus", func() Layer { return &SoftplusLayer{} })
+	Register("hard_sigmoid", func() Layer { return &HardSigmoidLayer{} })
+	Register("log_softmax", func() Layer { return &LogSoftmaxLayer{} })
+	Register("prelu", func() Layer { return &PReLULayer{} })
+}
+
+// Register makes a layer type available to the model format under name.
+// Layers that are registered must implement encoding.BinaryMarshaler and encoding.BinaryUnmarshaler.
+// Register panics if name or the layer type is already registered.
+func Register(name string, factory func() Layer) {
+	if _, ok := registry[name]; ok {
+		panic(fmt.Sprintf("layer: %q is already registered", name))
+	}
+	t := reflect.TypeOf(factory())
+	if _, ok := names[t]; ok {
+		panic(fmt.Sprintf("layer: %s is already registered", t))
+	}
+	registry[name] = factory
+	names[t] = name
+}
+
+// Name returns the name l's type has been registered with.
+func Name(l Layer) (string, error) {
+	name, ok := names[reflect.TypeOf(l)]
+	if !ok {
+		return "", fmt.Errorf("layer: %T is not registered", l)
+	}
+	return name, nil
+}
+
+// New returns an empty layer of the type registered as name.
+func New(name string) (Layer, error) {
+	factory, ok := registry[name]
+	if !ok {
+		return nil, fmt.Errorf("layer: unknown layer type %q", name)
+	}
+	return factory(), nil
+}
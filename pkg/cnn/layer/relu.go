@@ -1,13 +1,14 @@
 package layer
 
 import (
+	"bytes"
+	"github.com/rubenwo/cnn-go/pkg/cnn/internal/codec"
 	"github.com/rubenwo/cnn-go/pkg/cnn/maths"
 	"math"
 )
 
 type ReLULayer struct {
-	outputDims  []int
-	recentInput maths.Tensor
+	outputDims []int
 }
 
 func NewReLULayer(inputDims []int) *ReLULayer {
@@ -29,18 +30,44 @@ func (o *ReLULayer) derivatives(input maths.Tensor) *maths.Tensor {
 	return output
 }
 
-func (o *ReLULayer) ForwardPropagation(input maths.Tensor) maths.Tensor {
-	o.recentInput = input
+// ForwardPropagation applies max(x, 0) to every value. In Training mode the cache is the input.
+func (o *ReLULayer) ForwardPropagation(input maths.Tensor, mode Mode) (maths.Tensor, Cache) {
 	output := input.Zeroes()
+	o.ForwardPropagationInto(input, output)
+	if mode == Training {
+		return *output, input
+	}
+	return *output, nil
+}
+
+func (o *ReLULayer) ForwardPropagationInto(input maths.Tensor, output *maths.Tensor) {
 	for i := 0; i < input.Len(); i++ {
 		output.SetValue(i, math.Max(input.At(i), 0))
 	}
-	return *output
 }
-func (o *ReLULayer) BackwardPropagation(gradient maths.Tensor, lr float64) maths.Tensor {
-	return *gradient.MulElem(o.derivatives(o.recentInput))
+func (o *ReLULayer) BackwardPropagation(gradient maths.Tensor, cache Cache, grads []*maths.Tensor) maths.Tensor {
+	return *gradient.MulElem(o.derivatives(cache.(maths.Tensor)))
 }
 
+func (o *ReLULayer) Parameters() []*Parameter { return nil }
+
 func (o *ReLULayer) OutputDims() []int {
 	return o.outputDims
 }
+
+func (o *ReLULayer) MarshalBinary() ([]byte, error) {
+	var buf bytes.Buffer
+	w := codec.NewWriter(&buf)
+	w.Ints(o.outputDims)
+	return buf.Bytes(), w.Err()
+}
+
+func (o *ReLULayer) UnmarshalBinary(data []byte) error {
+	r := codec.NewReader(bytes.NewReader(data))
+	inputDims := r.Ints()
+	if err := r.Err(); err != nil {
+		return err
+	}
+	*o = *NewReLULayer(inputDims)
+	return nil
+}
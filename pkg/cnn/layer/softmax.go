@@ -1,13 +1,14 @@
 package layer
 
 import (
+	"bytes"
+	"github.com/rubenwo/cnn-go/pkg/cnn/internal/codec"
 	"github.com/rubenwo/cnn-go/pkg/cnn/maths"
 	"math"
 )
 
 type SoftmaxLayer struct {
-	outputDims  []int
-	recentInput maths.Tensor
+	outputDims []int
 }
 
 func NewSoftmaxLayer(inputDims []int) *SoftmaxLayer {
@@ -15,42 +16,135 @@ func NewSoftmaxLayer(inputDims []int) *SoftmaxLayer {
 		outputDims: inputDims}
 }
 
-func (o *SoftmaxLayer) ForwardPropagation(input maths.Tensor) maths.Tensor {
-	o.recentInput = input
-
+// ForwardPropagation applies the softmax function to the input. The largest input is subtracted before taking the
+// exponent, which does not change the result but keeps large inputs from overflowing.
+// In Training mode the cache is the output.
+func (o *SoftmaxLayer) ForwardPropagation(input maths.Tensor, mode Mode) (maths.Tensor, Cache) {
 	output := input.Zeroes()
+	o.ForwardPropagationInto(input, output)
+	if mode == Training {
+		return *output, *output
+	}
+	return *output, nil
+}
+
+func (o *SoftmaxLayer) ForwardPropagationInto(input maths.Tensor, output *maths.Tensor) {
+	max := input.MaxValue()
 	expSum := 0.0
 
 	for i := 0; i < input.Len(); i++ {
-		output.SetValue(i, math.Exp(input.At(i)))
+		output.SetValue(i, math.Exp(input.At(i)-max))
 		expSum += output.At(i)
 	}
 
 	output.Apply(func(val float64, idx int) float64 {
 		return val / expSum
 	})
-
-	return *output
 }
-func (o *SoftmaxLayer) BackwardPropagation(gradient maths.Tensor, lr float64) maths.Tensor {
-	return *gradient.MulElem(o.derivatives(o.recentInput))
+
+// BackwardPropagation multiplies the gradient by the Jacobian of the softmax function, which is
+// diag(y) - y * y^T for output y: the input gradient is y * (gradient - <gradient, y>) elementwise.
+func (o *SoftmaxLayer) BackwardPropagation(gradient maths.Tensor, cache Cache, grads []*maths.Tensor) maths.Tensor {
+	output := cache.(maths.Tensor)
+	dot := gradient.InnerProduct(&output)
+
+	inputGradient := output.Zeroes()
+	for i := 0; i < output.Len(); i++ {
+		inputGradient.SetValue(i, output.At(i)*(gradient.At(i)-dot))
+	}
+	return *inputGradient
 }
 
+func (o *SoftmaxLayer) Parameters() []*Parameter { return nil }
+
 func (o *SoftmaxLayer) OutputDims() []int {
 	return o.outputDims
 }
 
-func (o *SoftmaxLayer) derivatives(input maths.Tensor) *maths.Tensor {
-	output := make([]float64, input.Len())
-	expSum := 0.0
+func (o *SoftmaxLayer) MarshalBinary() ([]byte, error) {
+	var buf bytes.Buffer
+	w := codec.NewWriter(&buf)
+	w.Ints(o.outputDims)
+	return buf.Bytes(), w.Err()
+}
+
+func (o *SoftmaxLayer) UnmarshalBinary(data []byte) error {
+	r := codec.NewReader(bytes.NewReader(data))
+	inputDims := r.Ints()
+	if err := r.Err(); err != nil {
+		return err
+	}
+	*o = *NewSoftmaxLayer(inputDims)
+	return nil
+}
+
+// LogSoftmaxLayer applies the logarithm of the softmax function: x - log(sum(e^x)). It is computed without taking
+// the logarithm of the softmax, so it does not overflow or take log(0) for large inputs.
+type LogSoftmaxLayer struct {
+	outputDims []int
+}
+
+func NewLogSoftmaxLayer(inputDims []int) *LogSoftmaxLayer {
+	return &LogSoftmaxLayer{
+		outputDims: inputDims}
+}
 
+// ForwardPropagation subtracts the log-sum-exp of the input from every value. In Training mode the cache is the
+// output.
+func (o *LogSoftmaxLayer) ForwardPropagation(input maths.Tensor, mode Mode) (maths.Tensor, Cache) {
+	output := input.Zeroes()
+	o.ForwardPropagationInto(input, output)
+	if mode == Training {
+		return *output, *output
+	}
+	return *output, nil
+}
+
+func (o *LogSoftmaxLayer) ForwardPropagationInto(input maths.Tensor, output *maths.Tensor) {
+	max := input.MaxValue()
+	expSum := 0.0
 	for i := 0; i < input.Len(); i++ {
-		output[i] = math.Exp(input.At(i))
-		expSum += output[i]
+		expSum += math.Exp(input.At(i) - max)
 	}
+	logSumExp := max + math.Log(expSum)
 
 	for i := 0; i < input.Len(); i++ {
-		output[i] *= expSum - output[i]
+		output.SetValue(i, input.At(i)-logSumExp)
+	}
+}
+
+// BackwardPropagation multiplies the gradient by the Jacobian I - 1 * softmax^T: the input gradient is
+// gradient - softmax * sum(gradient), where softmax is e^output.
+func (o *LogSoftmaxLayer) BackwardPropagation(gradient maths.Tensor, cache Cache, grads []*maths.Tensor) maths.Tensor {
+	output := cache.(maths.Tensor)
+	sum := maths.SumFloat64Slice(gradient.Values())
+
+	inputGradient := output.Zeroes()
+	for i := 0; i < output.Len(); i++ {
+		inputGradient.SetValue(i, gradient.At(i)-math.Exp(output.At(i))*sum)
+	}
+	return *inputGradient
+}
+
+func (o *LogSoftmaxLayer) Parameters() []*Parameter { return nil }
+
+func (o *LogSoftmaxLayer) OutputDims() []int {
+	return o.outputDims
+}
+
+func (o *LogSoftmaxLayer) MarshalBinary() ([]byte, error) {
+	var buf bytes.Buffer
+	w := codec.NewWriter(&buf)
+	w.Ints(o.outputDims)
+	return buf.Bytes(), w.Err()
+}
+
+func (o *LogSoftmaxLayer) UnmarshalBinary(data []byte) error {
+	r := codec.NewReader(bytes.NewReader(data))
+	inputDims := r.Ints()
+	if err := r.Err(); err != nil {
+		return err
 	}
-	return maths.NewTensor(input.Dimensions(), maths.DivideFloat64SliceByFloat64(output, expSum*expSum))
+	*o = *NewLogSoftmaxLayer(inputDims)
+	return nil
 }
@@ -0,0 +1,23 @@
+package layer_test
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/rubenwo/cnn-go/pkg/cnn/gradcheck"
+	"github.com/rubenwo/cnn-go/pkg/cnn/layer"
+	"github.com/rubenwo/cnn-go/pkg/cnn/maths"
+)
+
+func TestSoftmaxGradients(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+	inputs := []maths.Tensor{
+		randomTensor(random, 5),
+		randomTensor(random, 3, 4),
+		// Large inputs are shifted by their maximum before taking the exponent
+		*maths.NewTensor([]int{3}, []float64{1000, 1001, 999.5}),
+	}
+	for _, input := range inputs {
+		gradcheck.Layer(layer.NewSoftmaxLayer(input.Dimensions()), input, gradcheck.DefaultConfig).Check(t)
+	}
+}
@@ -0,0 +1,201 @@
+package maths
+
+import (
+	"fmt"
+	"math"
+	"runtime"
+	"sync"
+)
+
+// parallelThreshold is the number of multiply-adds from which an operation is divided over multiple goroutines
+const parallelThreshold = 1 << 20
+
+// parallelize calls fn for contiguous ranges covering [0, n). When work, the number of multiply-adds, is at least
+// parallelThreshold the ranges are processed on runtime.GOMAXPROCS(0) goroutines, otherwise fn is called once for
+// the complete range.
+// The operations in this file only divide work so that every value of the result is computed by a single call of
+// fn, so the result does not depend on the number of goroutines.
+func parallelize(n, work int, fn func(start, end int)) {
+	tiles := runtime.GOMAXPROCS(0)
+	if tiles > n {
+		tiles = n
+	}
+	if work < parallelThreshold || tiles < 2 {
+		fn(0, n)
+		return
+	}
+
+	var wg sync.WaitGroup
+	for t := 0; t < tiles; t++ {
+		wg.Add(1)
+		go func(start, end int) {
+			defer wg.Done()
+			fn(start, end)
+		}(t*n/tiles, (t+1)*n/tiles)
+	}
+	wg.Wait()
+}
+
+// Gemm computes c = alpha * op(a) * op(b) + beta * c, where op(x) is x, or its transpose if the matching trans
+// flag is set. Large multiplications are divided over multiple goroutines by rows of c.
+func Gemm(transA, transB bool, alpha float64, a, b *Matrix, beta float64, c *Matrix) {
+	m, k := a.rows, a.cols
+	if transA {
+		m, k = k, m
+	}
+	kb, n := b.rows, b.cols
+	if transB {
+		kb, n = n, kb
+	}
+	if k != kb || c.rows != m || c.cols != n {
+		panic(fmt.Sprintf("dimension mismatch in Gemm: %dx%d * %dx%d into %dx%d", m, k, kb, n, c.rows, c.cols))
+	}
+	if m == 0 || n == 0 {
+		return
+	}
+
+	parallelize(m, m*n*k, func(start, end int) {
+		// Row i of op(a) starts at row i of a, or at column i if a is transposed
+		aOffset := start * a.stride
+		if transA {
+			aOffset = start
+		}
+		var aValues []float64
+		if k > 0 {
+			aValues = a.values[aOffset:]
+		}
+		gemm(transA, transB, end-start, n, k, alpha, aValues, a.stride, b.values, b.stride, beta, c.values[start*c.stride:], c.stride)
+	})
+}
+
+// Gemv computes y = alpha * op(a) * x + beta * y, where op(a) is a, or its transpose if trans is set.
+// Large multiplications are divided over multiple goroutines by values of y.
+func Gemv(trans bool, alpha float64, a *Matrix, x *Vector, beta float64, y *Vector) {
+	m, n := a.rows, a.cols
+	if trans {
+		m, n = n, m
+	}
+	if x.Len() != n || y.Len() != m {
+		panic(fmt.Sprintf("dimension mismatch in Gemv: %dx%d * %d into %d", m, n, x.Len(), y.Len()))
+	}
+
+	if !trans {
+		parallelize(m, m*n, func(start, end int) {
+			for i := start; i < end; i++ {
+				dot := Dot(a.Row(i), x)
+				if beta == 0 {
+					y.values[i] = alpha * dot
+				} else {
+					y.values[i] = alpha*dot + beta*y.values[i]
+				}
+			}
+		})
+		return
+	}
+
+	// y = alpha * a^T * x is the sum of the rows of a scaled by alpha * x, walking a row by row keeps the
+	// accesses sequential
+	parallelize(m, m*n, func(start, end int) {
+		ys := &Vector{values: y.values[start:end]}
+		Scale(beta, ys)
+		for i := 0; i < a.rows; i++ {
+			Axpy(alpha*x.values[i], &Vector{values: a.values[i*a.stride+start : i*a.stride+end]}, ys)
+		}
+	})
+}
+
+// Ger adds the outer product alpha * x * y^T to a.
+func Ger(alpha float64, x, y *Vector, a *Matrix) {
+	if x.Len() != a.rows || y.Len() != a.cols {
+		panic(fmt.Sprintf("dimension mismatch in Ger: %d x %d into %dx%d", x.Len(), y.Len(), a.rows, a.cols))
+	}
+	parallelize(a.rows, a.rows*a.cols, func(start, end int) {
+		for i := start; i < end; i++ {
+			Axpy(alpha*x.values[i], y, a.Row(i))
+		}
+	})
+}
+
+// Outer returns the outer product x * y^T as a new matrix.
+func Outer(x, y *Vector) *Matrix {
+	a := NewMatrix(x.Len(), y.Len(), nil)
+	Ger(1, x, y, a)
+	return a
+}
+
+// Axpy adds alpha * x to y.
+func Axpy(alpha float64, x, y *Vector) {
+	if x.Len() != y.Len() {
+		panic(fmt.Sprintf("dimension mismatch in Axpy: %d != %d", x.Len(), y.Len()))
+	}
+	if alpha == 0 {
+		return
+	}
+	ys := y.values[:len(x.values)]
+	for i, v := range x.values {
+		ys[i] += alpha * v
+	}
+}
+
+// Scale multiplies x by alpha.
+func Scale(alpha float64, x *Vector) {
+	if alpha == 1 {
+		return
+	}
+	for i := range x.values {
+		if alpha == 0 {
+			x.values[i] = 0
+		} else {
+			x.values[i] *= alpha
+		}
+	}
+}
+
+// Dot returns the inner product of x and y.
+func Dot(x, y *Vector) float64 {
+	if x.Len() != y.Len() {
+		panic(fmt.Sprintf("dimension mismatch in Dot: %d != %d", x.Len(), y.Len()))
+	}
+	ys := y.values[:len(x.values)]
+	result := 0.0
+	for i, v := range x.values {
+		result += v * ys[i]
+	}
+	return result
+}
+
+// Norm1 returns the sum of the absolute values of x.
+func Norm1(x *Vector) float64 {
+	result := 0.0
+	for _, v := range x.values {
+		result += math.Abs(v)
+	}
+	return result
+}
+
+// Norm2 returns the euclidean norm of x. The values are scaled by the largest absolute value first, so the
+// squares do not overflow or underflow.
+func Norm2(x *Vector) float64 {
+	scale := NormInf(x)
+	if scale == 0 || math.IsInf(scale, 0) || math.IsNaN(scale) {
+		return scale
+	}
+	sum := 0.0
+	for _, v := range x.values {
+		v /= scale
+		sum += v * v
+	}
+	return scale * math.Sqrt(sum)
+}
+
+// NormInf returns the largest absolute value of x.
+func NormInf(x *Vector) float64 {
+	result := 0.0
+	for _, v := range x.values {
+		if math.IsNaN(v) {
+			return v
+		}
+		result = math.Max(result, math.Abs(v))
+	}
+	return result
+}
@@ -0,0 +1,127 @@
+package maths
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// ErrShape is returned, wrapped, by operations on tensors with incompatible dimensions.
+var ErrShape = errors.New("maths: incompatible tensor dimensions")
+
+// BroadcastDimensions returns the dimensions of the result of a broadcasting operation on tensors of size a and b.
+// The dimensions are aligned at the end of the dimension lists, so a tensor of size [c] is combined with every
+// [.., .., c] part of a tensor of size [h, w, c]. Missing dimensions count as 1. Two aligned dimensions are
+// compatible if they are equal or one of them is 1, which is then repeated to match the other.
+func BroadcastDimensions(a, b []int) ([]int, error) {
+	n := len(a)
+	if len(b) > n {
+		n = len(b)
+	}
+	dims := make([]int, n)
+	for i := range dims {
+		da, db := alignedDim(a, i, n), alignedDim(b, i, n)
+		switch {
+		case da == db || db == 1:
+			dims[i] = da
+		case da == 1:
+			dims[i] = db
+		default:
+			return nil, fmt.Errorf("%w: can not broadcast %v and %v", ErrShape, a, b)
+		}
+	}
+	return dims, nil
+}
+
+// alignedDim returns the dimension of dims that is aligned with dimension i of an n dimensional result,
+// 1 if dims has no such dimension
+func alignedDim(dims []int, i, n int) int {
+	j := i - (n - len(dims))
+	if j < 0 {
+		return 1
+	}
+	return dims[j]
+}
+
+// broadcastStrides returns the strides of t for iterating over a tensor of size dims that t is broadcast to.
+// Repeated dimensions have a stride of 0.
+func broadcastStrides(t *Tensor, dims []int) []int {
+	tStrides := t.Strides()
+	strides := make([]int, len(dims))
+	for i := range dims {
+		j := i - (len(dims) - len(t.dimension))
+		if j >= 0 && t.dimension[j] != 1 {
+			strides[i] = tStrides[j]
+		}
+	}
+	return strides
+}
+
+// broadcast returns a new tensor holding fn applied to every pair of aligned values of a and b
+func broadcast(a, b *Tensor, fn func(x, y float64) float64) (*Tensor, error) {
+	dims, err := BroadcastDimensions(a.dimension, b.dimension)
+	if err != nil {
+		return nil, err
+	}
+	aStrides, bStrides := broadcastStrides(a, dims), broadcastStrides(b, dims)
+
+	result := NewTensor(dims, nil)
+	coords := make([]int, len(dims))
+	ia, ib := a.offset, b.offset
+	for i := range result.values {
+		result.values[i] = fn(a.values[ia], b.values[ib])
+		// Move to the next position, the first dimension varies the fastest
+		for d := range coords {
+			coords[d]++
+			ia += aStrides[d]
+			ib += bStrides[d]
+			if coords[d] < dims[d] {
+				break
+			}
+			ia -= coords[d] * aStrides[d]
+			ib -= coords[d] * bStrides[d]
+			coords[d] = 0
+		}
+	}
+	return result, nil
+}
+
+// Add returns a + b, broadcasting a and b as described by BroadcastDimensions.
+func Add(a, b *Tensor) (*Tensor, error) {
+	return broadcast(a, b, func(x, y float64) float64 { return x + y })
+}
+
+// Sub returns a - b, broadcasting a and b as described by BroadcastDimensions.
+func Sub(a, b *Tensor) (*Tensor, error) {
+	return broadcast(a, b, func(x, y float64) float64 { return x - y })
+}
+
+// Mul returns the elementwise product of a and b, broadcasting a and b as described by BroadcastDimensions.
+func Mul(a, b *Tensor) (*Tensor, error) {
+	return broadcast(a, b, func(x, y float64) float64 { return x * y })
+}
+
+// Div returns the elementwise quotient of a and b, broadcasting a and b as described by BroadcastDimensions.
+func Div(a, b *Tensor) (*Tensor, error) {
+	return broadcast(a, b, func(x, y float64) float64 { return x / y })
+}
+
+// Pow returns a to the power b elementwise, broadcasting a and b as described by BroadcastDimensions.
+func Pow(a, b *Tensor) (*Tensor, error) {
+	return broadcast(a, b, math.Pow)
+}
+
+// Maximum returns the elementwise maximum of a and b, broadcasting a and b as described by BroadcastDimensions.
+func Maximum(a, b *Tensor) (*Tensor, error) {
+	return broadcast(a, b, math.Max)
+}
+
+// Minimum returns the elementwise minimum of a and b, broadcasting a and b as described by BroadcastDimensions.
+func Minimum(a, b *Tensor) (*Tensor, error) {
+	return broadcast(a, b, math.Min)
+}
+
+// Scalar returns a tensor holding the single value v, which can be broadcast to any size.
+func Scalar(v float64) *Tensor {
+	return NewTensor([]int{1}, []float64{v})
+}
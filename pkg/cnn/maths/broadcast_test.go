@@ -0,0 +1,112 @@
+package maths
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"testing"
+)
+
+// assertTensor fails if got does not have the dimensions dims and the values want, up to tolerance. NaN values
+// equal each other.
+func assertTensor(t *testing.T, name string, got *Tensor, dims []int, want []float64, tolerance float64) {
+	t.Helper()
+	if fmt.Sprint(got.Dimensions()) != fmt.Sprint(dims) {
+		t.Fatalf("%s: dimensions %v, want %v", name, got.Dimensions(), dims)
+	}
+	values := got.Values()
+	if len(values) != len(want) {
+		t.Fatalf("%s: %d values, want %d", name, len(values), len(want))
+	}
+	for i := range want {
+		switch {
+		case math.IsNaN(want[i]) && math.IsNaN(values[i]):
+		case math.IsInf(want[i], 0) && values[i] == want[i]:
+		case math.Abs(values[i]-want[i]) <= tolerance:
+		default:
+			t.Fatalf("%s: values %v, want %v", name, values, want)
+		}
+	}
+}
+
+func TestBroadcastDimensions(t *testing.T) {
+	tests := []struct {
+		a, b []int
+		want []int
+	}{
+		{a: []int{3, 4}, b: []int{3, 4}, want: []int{3, 4}},
+		// Missing dimensions are added at the front
+		{a: []int{2, 3, 4}, b: []int{4}, want: []int{2, 3, 4}},
+		{a: []int{4}, b: []int{2, 3, 4}, want: []int{2, 3, 4}},
+		{a: []int{3, 1}, b: []int{1, 4}, want: []int{3, 4}},
+		{a: []int{2, 1, 4}, b: []int{3, 1}, want: []int{2, 3, 4}},
+		{a: []int{3, 4}, b: []int{1}, want: []int{3, 4}},
+		{a: []int{1}, b: []int{1}, want: []int{1}},
+		{a: []int{0, 4}, b: []int{1, 4}, want: []int{0, 4}},
+	}
+	for _, test := range tests {
+		got, err := BroadcastDimensions(test.a, test.b)
+		if err != nil {
+			t.Errorf("%v and %v: %v", test.a, test.b, err)
+		} else if fmt.Sprint(got) != fmt.Sprint(test.want) {
+			t.Errorf("%v and %v broadcast to %v, want %v", test.a, test.b, got, test.want)
+		}
+	}
+}
+
+func TestBroadcastIncompatibleDimensions(t *testing.T) {
+	tests := [][2][]int{
+		{{3, 4}, {4, 3}},
+		{{2, 3, 4}, {3}},
+		{{3}, {2, 3, 4}},
+		{{2, 4}, {3, 1}},
+	}
+	for _, test := range tests {
+		if _, err := BroadcastDimensions(test[0], test[1]); !errors.Is(err, ErrShape) {
+			t.Errorf("BroadcastDimensions(%v, %v) returned %v, want %v", test[0], test[1], err, ErrShape)
+		}
+		a, b := NewTensor(test[0], nil), NewTensor(test[1], nil)
+		if _, err := Add(a, b); !errors.Is(err, ErrShape) {
+			t.Errorf("Add of sizes %v and %v returned %v, want %v", test[0], test[1], err, ErrShape)
+		}
+	}
+}
+
+func TestBroadcastValues(t *testing.T) {
+	// The first dimension varies the fastest, [3, 2] holds the rows [0 1 2] and [3 4 5]
+	tests := []struct {
+		name string
+		fn   func(a, b *Tensor) (*Tensor, error)
+		a, b *Tensor
+		dims []int
+		want []float64
+	}{
+		{name: "Add", fn: Add, a: sequence(3, 2), b: sequence(3, 2), dims: []int{3, 2}, want: []float64{0, 2, 4, 6, 8, 10}},
+		{name: "Add row", fn: Add, a: sequence(3, 2), b: NewTensor([]int{3, 1}, []float64{10, 20, 30}),
+			dims: []int{3, 2}, want: []float64{10, 21, 32, 13, 24, 35}},
+		{name: "Add column", fn: Add, a: sequence(3, 2), b: NewTensor([]int{2}, []float64{10, 20}),
+			dims: []int{3, 2}, want: []float64{10, 11, 12, 23, 24, 25}},
+		{name: "Add outer", fn: Add, a: NewTensor([]int{3, 1}, []float64{1, 2, 3}), b: NewTensor([]int{1, 2}, []float64{10, 20}),
+			dims: []int{3, 2}, want: []float64{11, 12, 13, 21, 22, 23}},
+		{name: "Sub scalar", fn: Sub, a: sequence(3, 2), b: Scalar(1), dims: []int{3, 2}, want: []float64{-1, 0, 1, 2, 3, 4}},
+		{name: "Sub from scalar", fn: Sub, a: Scalar(1), b: sequence(3, 2), dims: []int{3, 2}, want: []float64{1, 0, -1, -2, -3, -4}},
+		{name: "Mul rank", fn: Mul, a: sequence(2, 1, 2), b: NewTensor([]int{3, 1}, []float64{1, 10, 100}),
+			dims: []int{2, 3, 2}, want: []float64{0, 1, 0, 10, 0, 100, 2, 3, 20, 30, 200, 300}},
+		{name: "Div", fn: Div, a: sequence(2), b: Scalar(2), dims: []int{2}, want: []float64{0, 0.5}},
+		{name: "Pow", fn: Pow, a: NewTensor([]int{2, 1}, []float64{2, 3}), b: NewTensor([]int{1, 2}, []float64{2, 3}),
+			dims: []int{2, 2}, want: []float64{4, 9, 8, 27}},
+		{name: "Maximum", fn: Maximum, a: sequence(3), b: Scalar(1), dims: []int{3}, want: []float64{1, 1, 2}},
+		{name: "Minimum", fn: Minimum, a: sequence(3), b: Scalar(1), dims: []int{3}, want: []float64{0, 1, 1}},
+		// Views are read through their strides
+		{name: "Add view", fn: Add, a: sequence(3, 2).Transpose(0, 1), b: NewTensor([]int{2, 1}, []float64{10, 20}),
+			dims: []int{2, 3}, want: []float64{10, 23, 11, 24, 12, 25}},
+	}
+	for _, test := range tests {
+		got, err := test.fn(test.a, test.b)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		assertTensor(t, test.name, got, test.dims, test.want, 0)
+	}
+}
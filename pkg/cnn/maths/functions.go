@@ -0,0 +1,12 @@
+package maths
+
+import "math"
+
+// Sigmoid returns 1 / (1 + e^-x) without overflowing for large negative x.
+func Sigmoid(x float64) float64 {
+	if x >= 0 {
+		return 1 / (1 + math.Exp(-x))
+	}
+	e := math.Exp(x)
+	return e / (1 + e)
+}
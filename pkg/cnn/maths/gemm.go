@@ -0,0 +1,142 @@
+package maths
+
+import "sync"
+
+// Block sizes of gemm. A block of A and a block of B together take about 320 KiB, so they stay in the L2 cache
+// while the block of C is computed.
+const (
+	gemmBlockM = 64
+	gemmBlockN = 256
+	gemmBlockK = 128
+)
+
+// gemmBuffer holds the packed blocks of a and b of a running gemm
+type gemmBuffer struct {
+	a, b []float64
+}
+
+// gemmBuffers holds *gemmBuffer values of the full block sizes, which are reused instead of allocated for every gemm
+var gemmBuffers = sync.Pool{New: func() interface{} {
+	return &gemmBuffer{a: make([]float64, gemmBlockM*gemmBlockK), b: make([]float64, gemmBlockK*gemmBlockN)}
+}}
+
+// gemm computes c = alpha * op(a) * op(b) + beta * c, where op(x) is x, or its transpose if the matching trans
+// flag is set. op(a) is an m x k matrix, op(b) a k x n matrix and c an m x n matrix.
+// All matrices are stored row-major in slices, lda, ldb and ldc are the distances between the starts of two rows
+// of a, b and c.
+// The matrices are multiplied block by block, so the blocks that are being worked on stay in the cache.
+// For every value of c the products are added in order of increasing k, so the result does not depend on the
+// block sizes.
+func gemm(transA, transB bool, m, n, k int, alpha float64, a []float64, lda int, b []float64, ldb int, beta float64, c []float64, ldc int) {
+	if beta != 1 {
+		for i := 0; i < m; i++ {
+			row := c[i*ldc : i*ldc+n]
+			for j := range row {
+				if beta == 0 {
+					row[j] = 0
+				} else {
+					row[j] *= beta
+				}
+			}
+		}
+	}
+	if alpha == 0 || k == 0 {
+		return
+	}
+
+	buffers := gemmBuffers.Get().(*gemmBuffer)
+	defer gemmBuffers.Put(buffers)
+	aBlock := buffers.a[:minInt(m, gemmBlockM)*minInt(k, gemmBlockK)]
+	bBlock := buffers.b[:minInt(k, gemmBlockK)*minInt(n, gemmBlockN)]
+
+	for kk := 0; kk < k; kk += gemmBlockK {
+		bk := minInt(gemmBlockK, k-kk)
+		for jj := 0; jj < n; jj += gemmBlockN {
+			bn := minInt(gemmBlockN, n-jj)
+			packBlock(bBlock, b, ldb, transB, kk, jj, bk, bn)
+
+			for ii := 0; ii < m; ii += gemmBlockM {
+				bm := minInt(gemmBlockM, m-ii)
+				packBlock(aBlock, a, lda, transA, ii, kk, bm, bk)
+
+				i := 0
+				// Four rows of c at a time, so every value of the block of b is loaded once for four rows
+				for ; i+4 <= bm; i += 4 {
+					c0 := c[(ii+i)*ldc+jj : (ii+i)*ldc+jj+bn]
+					c1 := c[(ii+i+1)*ldc+jj : (ii+i+1)*ldc+jj+bn]
+					c2 := c[(ii+i+2)*ldc+jj : (ii+i+2)*ldc+jj+bn]
+					c3 := c[(ii+i+3)*ldc+jj : (ii+i+3)*ldc+jj+bn]
+					for p := 0; p < bk; p++ {
+						a0 := alpha * aBlock[i*bk+p]
+						a1 := alpha * aBlock[(i+1)*bk+p]
+						a2 := alpha * aBlock[(i+2)*bk+p]
+						a3 := alpha * aBlock[(i+3)*bk+p]
+						bRow := bBlock[p*bn : p*bn+bn]
+						c0, c1, c2, c3 := c0[:len(bRow)], c1[:len(bRow)], c2[:len(bRow)], c3[:len(bRow)]
+						for j, bpj := range bRow {
+							c0[j] += a0 * bpj
+							c1[j] += a1 * bpj
+							c2[j] += a2 * bpj
+							c3[j] += a3 * bpj
+						}
+					}
+				}
+				for ; i < bm; i++ {
+					cRow := c[(ii+i)*ldc+jj : (ii+i)*ldc+jj+bn]
+					for p := 0; p < bk; p++ {
+						aip := alpha * aBlock[i*bk+p]
+						bRow := bBlock[p*bn : p*bn+bn]
+						for j, bpj := range bRow {
+							cRow[j] += aip * bpj
+						}
+					}
+				}
+			}
+		}
+	}
+}
+
+// packBlock copies the rows x cols block starting at (row, col) of op(src) to dst, row-major without gaps.
+// op(src) is src, or its transpose if trans is set.
+func packBlock(dst, src []float64, ld int, trans bool, row, col, rows, cols int) {
+	for i := 0; i < rows; i++ {
+		dstRow := dst[i*cols : i*cols+cols]
+		if trans {
+			for j := range dstRow {
+				dstRow[j] = src[(col+j)*ld+row+i]
+			}
+		} else {
+			copy(dstRow, src[(row+i)*ld+col:])
+		}
+	}
+}
+
+// Im2Col lowers input to a matrix of columns for a convolution: columns[i] = input[indices[i]], or 0 if
+// indices[i] is negative, which marks a value in the zero padding.
+// Every row of the resulting matrix holds the input values that are multiplied with a filter for one output
+// position, so the convolution becomes a single matrix multiplication.
+func Im2Col(columns, input []float64, indices []int) {
+	for i, index := range indices {
+		if index >= 0 {
+			columns[i] = input[index]
+		} else {
+			columns[i] = 0
+		}
+	}
+}
+
+// Col2Im is the reverse of Im2Col: it adds columns[i] to input[indices[i]] for every non-negative index.
+func Col2Im(input, columns []float64, indices []int) {
+	for i, index := range indices {
+		if index >= 0 {
+			input[index] += columns[i]
+		}
+	}
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,133 @@
+package maths
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// randomMatrix returns a rows x cols matrix with normally distributed values
+func randomMatrix(random *rand.Rand, rows, cols int) *Matrix {
+	m := NewMatrix(rows, cols, nil)
+	for i := range m.values {
+		m.values[i] = random.NormFloat64()
+	}
+	return m
+}
+
+// naiveGemm computes c = alpha * op(a) * op(b) + beta * c with a triple loop
+func naiveGemm(transA, transB bool, alpha float64, a, b *Matrix, beta float64, c *Matrix) {
+	at := func(m *Matrix, trans bool, i, j int) float64 {
+		if trans {
+			return m.At(j, i)
+		}
+		return m.At(i, j)
+	}
+	k := a.cols
+	if transA {
+		k = a.rows
+	}
+	for i := 0; i < c.rows; i++ {
+		for j := 0; j < c.cols; j++ {
+			sum := 0.0
+			for p := 0; p < k; p++ {
+				sum += at(a, transA, i, p) * at(b, transB, p, j)
+			}
+			c.Set(i, j, alpha*sum+beta*c.At(i, j))
+		}
+	}
+}
+
+func TestGemmMatchesNaive(t *testing.T) {
+	// Sizes that are not a multiple of the block sizes, and sizes large enough to be divided over goroutines
+	sizes := [][3]int{{1, 1, 1}, {5, 3, 7}, {67, 131, 259}, {130, 300, 140}, {3, 0, 4}}
+	random := rand.New(rand.NewSource(1))
+	for _, size := range sizes {
+		m, k, n := size[0], size[1], size[2]
+		for _, transA := range []bool{false, true} {
+			for _, transB := range []bool{false, true} {
+				for _, beta := range []float64{0, 1, -0.5} {
+					name := fmt.Sprintf("%dx%dx%d transA=%v transB=%v beta=%g", m, k, n, transA, transB, beta)
+					a := randomMatrix(random, m, k)
+					if transA {
+						a = randomMatrix(random, k, m)
+					}
+					b := randomMatrix(random, k, n)
+					if transB {
+						b = randomMatrix(random, n, k)
+					}
+					c := randomMatrix(random, m, n)
+					want := c.Copy()
+
+					Gemm(transA, transB, 1.5, a, b, beta, c)
+					naiveGemm(transA, transB, 1.5, a, b, beta, want)
+					for i := range want.values {
+						if d := math.Abs(c.values[i] - want.values[i]); d > 1e-9*math.Max(1, math.Abs(want.values[i])) {
+							t.Fatalf("%s: value %d is %g, want %g", name, i, c.values[i], want.values[i])
+						}
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestGemmViews(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+	a := randomMatrix(random, 80, 90).View(3, 5, 70, 65)
+	b := randomMatrix(random, 300, 70).View(10, 1, 270, 65)
+	c := randomMatrix(random, 75, 280)
+	cView := c.View(2, 7, 70, 270)
+	want := c.Copy()
+	wantView := want.View(2, 7, 70, 270)
+
+	Gemm(false, true, 1, a, b, 1, cView)
+	naiveGemm(false, true, 1, a, b, 1, wantView)
+	for i := range want.values {
+		if d := math.Abs(c.values[i] - want.values[i]); d > 1e-9*math.Max(1, math.Abs(want.values[i])) {
+			t.Fatalf("value %d is %g, want %g", i, c.values[i], want.values[i])
+		}
+	}
+}
+
+func BenchmarkGemm(b *testing.B) {
+	for _, size := range []int{64, 256, 512} {
+		b.Run(fmt.Sprint(size), func(b *testing.B) {
+			random := rand.New(rand.NewSource(1))
+			x, y, z := randomMatrix(random, size, size), randomMatrix(random, size, size), NewMatrix(size, size, nil)
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				Gemm(false, false, 1, x, y, 0, z)
+			}
+		})
+	}
+}
+
+func TestIm2ColAndCol2Im(t *testing.T) {
+	input := []float64{1, 2, 3, 4}
+	indices := []int{3, -1, 0, 0, 2, -1}
+
+	columns := make([]float64, len(indices))
+	for i := range columns {
+		columns[i] = 9
+	}
+	Im2Col(columns, input, indices)
+	want := []float64{4, 0, 1, 1, 3, 0}
+	for i := range want {
+		if columns[i] != want[i] {
+			t.Fatalf("Im2Col gives %v, want %v", columns, want)
+		}
+	}
+
+	// Col2Im adds to the input, values used several times by Im2Col receive the sum of their columns
+	gradient := []float64{1, 1, 1, 1}
+	Col2Im(gradient, []float64{1, 2, 3, 4, 5, 6}, indices)
+	want = []float64{1 + 3 + 4, 1, 1 + 5, 1 + 1}
+	for i := range want {
+		if gradient[i] != want[i] {
+			t.Fatalf("Col2Im gives %v, want %v", gradient, want)
+		}
+	}
+}
@@ -132,10 +132,11 @@ func (it *RegionsIterator) HasNext() bool {
 	return it.CoordIterator.HasNext()
 }
 
+// Next returns the next region. Like RegionView, regions within the tensor share its values instead of being copied.
 func (it *RegionsIterator) Next() *Tensor {
 	regionBottomCorner := it.CoordIterator.Next()
 	regionTopCorner := AddIntSlices(regionBottomCorner, it.regionSizes)
-	return it.tensor.Region(regionBottomCorner, regionTopCorner)
+	return it.tensor.RegionView(regionBottomCorner, regionTopCorner)
 }
 
 // RegionsIteratorIteratorIterates through all possible regions (of a certain size) that can be made from this tensor.
@@ -175,8 +176,8 @@ func (it *ValuesIterator) Next() float64 { return it.tensor.AtCoords(it.iter.Nex
 // InnerProduct Multiply each element of base with a corresponding element of other, then sum these values.
 func (it *ValuesIterator) InnerProduct(t *Tensor) float64 {
 	result := 0.0
-	for i := 0; i < len(t.values); i++ {
-		result += it.Next() * t.values[i]
+	for i := 0; i < t.Len(); i++ {
+		result += it.Next() * t.At(i)
 	}
 	return result
 }
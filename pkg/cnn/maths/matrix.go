@@ -1,4 +1,67 @@
 package maths
 
+import "fmt"
+
+// Matrix is a dense matrix stored row-major. A Matrix can be a view of a part of another matrix, see View, in
+// which case both share their values.
 type Matrix struct {
+	rows, cols int
+	// stride is the distance between the starts of two rows in values, it is larger than cols for views
+	stride int
+	values []float64
+}
+
+// NewMatrix returns a rows x cols matrix. If values is nil the matrix is zero-valued, otherwise the matrix uses
+// values as its row-major backing slice, which must hold rows*cols values.
+// A Tensor of size [cols, rows] can be used as a matrix without copying with NewMatrix(rows, cols, t.Values()).
+func NewMatrix(rows, cols int, values []float64) *Matrix {
+	if values == nil {
+		values = make([]float64, rows*cols)
+	}
+	if len(values) != rows*cols {
+		panic(fmt.Sprintf("len(values)=%d != rows*cols=%d in NewMatrix", len(values), rows*cols))
+	}
+	return &Matrix{rows: rows, cols: cols, stride: cols, values: values}
+}
+
+func (m *Matrix) Rows() int                   { return m.rows }
+func (m *Matrix) Cols() int                   { return m.cols }
+func (m *Matrix) At(i, j int) float64         { return m.values[i*m.stride+j] }
+func (m *Matrix) Set(i, j int, value float64) { m.values[i*m.stride+j] = value }
+
+// Row returns row i as a vector that shares its values with m
+func (m *Matrix) Row(i int) *Vector {
+	return &Vector{values: m.values[i*m.stride : i*m.stride+m.cols]}
+}
+
+// View returns the rows x cols part of m starting at row i and column j. The view shares its values with m.
+func (m *Matrix) View(i, j, rows, cols int) *Matrix {
+	if i < 0 || j < 0 || rows < 0 || cols < 0 || i+rows > m.rows || j+cols > m.cols {
+		panic(fmt.Sprintf("view of %dx%d at (%d, %d) is out of range of %dx%d matrix", rows, cols, i, j, m.rows, m.cols))
+	}
+	if rows == 0 || cols == 0 {
+		return &Matrix{rows: rows, cols: cols, stride: m.stride}
+	}
+	start := i*m.stride + j
+	return &Matrix{rows: rows, cols: cols, stride: m.stride, values: m.values[start : start+(rows-1)*m.stride+cols]}
+}
+
+// Copy returns a matrix with a copy of the values of m, without gaps between the rows
+func (m *Matrix) Copy() *Matrix {
+	c := NewMatrix(m.rows, m.cols, nil)
+	for i := 0; i < m.rows; i++ {
+		copy(c.values[i*c.stride:], m.values[i*m.stride:i*m.stride+m.cols])
+	}
+	return c
+}
+
+// T returns a new matrix holding the transpose of m
+func (m *Matrix) T() *Matrix {
+	t := NewMatrix(m.cols, m.rows, nil)
+	for i := 0; i < m.rows; i++ {
+		for j := 0; j < m.cols; j++ {
+			t.values[j*t.stride+i] = m.values[i*m.stride+j]
+		}
+	}
+	return t
 }
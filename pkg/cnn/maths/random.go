@@ -0,0 +1,28 @@
+package maths
+
+// Source is a SplitMix64 pseudo random number generator implementing rand.Source64.
+// Unlike the sources in math/rand its complete state is a single uint64, which makes it possible to store the
+// state and continue the exact same sequence of numbers later on.
+type Source struct {
+	state uint64
+}
+
+func NewSource(seed int64) *Source {
+	return &Source{state: uint64(seed)}
+}
+
+func (s *Source) Seed(seed int64) { s.state = uint64(seed) }
+
+func (s *Source) Uint64() uint64 {
+	s.state += 0x9e3779b97f4a7c15
+	z := s.state
+	z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+	z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+	return z ^ (z >> 31)
+}
+
+func (s *Source) Int63() int64 { return int64(s.Uint64() >> 1) }
+
+// State returns the current state, which can be restored with SetState
+func (s *Source) State() uint64         { return s.state }
+func (s *Source) SetState(state uint64) { s.state = state }
@@ -0,0 +1,184 @@
+package maths
+
+import (
+	"fmt"
+	"math"
+)
+
+// The reductions in this file combine the values of a tensor along the given axes. Without axes all dimensions
+// are reduced. The reduced dimensions are removed from the result, or kept with size 1 if keepDims is set, so the
+// result can be broadcast against the input.
+
+// reduction describes the result of reducing axes of a tensor
+type reduction struct {
+	dims []int
+	// strides of the result for iterating over the input, 0 for the reduced dimensions
+	strides []int
+	// count is the number of input values combined into every value of the result
+	count int
+}
+
+// newReduction validates axes and returns the dimensions of the result of reducing them from t
+func newReduction(t *Tensor, axes []int, keepDims bool) (*reduction, error) {
+	reduced := make([]bool, len(t.dimension))
+	if len(axes) == 0 {
+		for i := range reduced {
+			reduced[i] = true
+		}
+	}
+	for _, axis := range axes {
+		if axis < 0 || axis >= len(t.dimension) || reduced[axis] {
+			return nil, fmt.Errorf("%w: can not reduce axes %v of tensor of size %v", ErrShape, axes, t.dimension)
+		}
+		reduced[axis] = true
+	}
+
+	r := &reduction{strides: make([]int, len(t.dimension)), count: 1}
+	stride := 1
+	for i, dim := range t.dimension {
+		switch {
+		case reduced[i]:
+			r.count *= dim
+			if keepDims {
+				r.dims = append(r.dims, 1)
+			}
+		default:
+			r.dims = append(r.dims, dim)
+			r.strides[i] = stride
+			stride *= dim
+		}
+	}
+	if r.dims == nil {
+		r.dims = []int{}
+	}
+	return r, nil
+}
+
+// forEachReduced calls fn for every value of t with its index in t.values, its coordinates and the position in the
+// result of r it is reduced into
+func (r *reduction) forEachReduced(t *Tensor, fn func(index, out int, coords []int)) {
+	coords := make([]int, len(t.dimension))
+	out := 0
+	t.forEach(func(i, index int) {
+		fn(index, out, coords)
+		// Move to the next position, the first dimension varies the fastest
+		for d := range coords {
+			coords[d]++
+			out += r.strides[d]
+			if coords[d] < t.dimension[d] {
+				break
+			}
+			out -= coords[d] * r.strides[d]
+			coords[d] = 0
+		}
+	})
+}
+
+// reduce returns the tensor holding, for every position of the result, fn applied in Horner order to init and
+// every input value that is reduced into it
+func reduce(t *Tensor, axes []int, keepDims bool, init float64, fn func(acc, v float64) float64) (*Tensor, error) {
+	r, err := newReduction(t, axes, keepDims)
+	if err != nil {
+		return nil, err
+	}
+	result := NewTensor(r.dims, nil)
+	for i := range result.values {
+		result.values[i] = init
+	}
+	r.forEachReduced(t, func(index, out int, _ []int) {
+		result.values[out] = fn(result.values[out], t.values[index])
+	})
+	return result, nil
+}
+
+// Sum returns the sum of the values of t along axes.
+func Sum(t *Tensor, keepDims bool, axes ...int) (*Tensor, error) {
+	return reduce(t, axes, keepDims, 0, func(acc, v float64) float64 { return acc + v })
+}
+
+// Mean returns the mean of the values of t along axes.
+func Mean(t *Tensor, keepDims bool, axes ...int) (*Tensor, error) {
+	sum, err := Sum(t, keepDims, axes...)
+	if err != nil {
+		return nil, err
+	}
+	r, _ := newReduction(t, axes, keepDims)
+	return sum.MulScalar(1 / float64(r.count)), nil
+}
+
+// Var returns the population variance of the values of t along axes: the mean squared difference from their mean.
+func Var(t *Tensor, keepDims bool, axes ...int) (*Tensor, error) {
+	mean, err := Mean(t, true, axes...)
+	if err != nil {
+		return nil, err
+	}
+	diff, err := Sub(t, mean)
+	if err != nil {
+		return nil, err
+	}
+	diff.Apply(func(val float64, _ int) float64 { return val * val })
+	return Mean(diff, keepDims, axes...)
+}
+
+// Max returns the largest value of t along axes.
+func Max(t *Tensor, keepDims bool, axes ...int) (*Tensor, error) {
+	return reduce(t, axes, keepDims, math.Inf(-1), func(acc, v float64) float64 {
+		if v > acc || math.IsNaN(v) {
+			return v
+		}
+		return acc
+	})
+}
+
+// ArgMax returns the position along axis of the largest value of t. If the largest value occurs more than once the
+// first position is returned.
+func ArgMax(t *Tensor, axis int, keepDims bool) (*Tensor, error) {
+	r, err := newReduction(t, []int{axis}, keepDims)
+	if err != nil {
+		return nil, err
+	}
+	max := NewTensor(r.dims, nil)
+	positions := NewTensor(r.dims, nil)
+	for i := range max.values {
+		max.values[i] = math.Inf(-1)
+	}
+	r.forEachReduced(t, func(index, out int, coords []int) {
+		v := t.values[index]
+		if coords[axis] == 0 || v > max.values[out] || math.IsNaN(v) && !math.IsNaN(max.values[out]) {
+			max.values[out] = v
+			positions.values[out] = float64(coords[axis])
+		}
+	})
+	return positions, nil
+}
+
+// LogSumExp returns log(sum(exp(x))) of the values x of t along axes. The largest value is subtracted before
+// taking the exponent, so large values do not overflow.
+func LogSumExp(t *Tensor, keepDims bool, axes ...int) (*Tensor, error) {
+	max, err := Max(t, true, axes...)
+	if err != nil {
+		return nil, err
+	}
+	// Shifting by an infinite maximum would turn the values into NaN
+	max.Apply(func(val float64, _ int) float64 {
+		if math.IsInf(val, 0) {
+			return 0
+		}
+		return val
+	})
+	shifted, err := Sub(t, max)
+	if err != nil {
+		return nil, err
+	}
+	shifted.Apply(func(val float64, _ int) float64 { return math.Exp(val) })
+	sum, err := Sum(shifted, true, axes...)
+	if err != nil {
+		return nil, err
+	}
+	sum.Apply(func(val float64, i int) float64 { return math.Log(val) + max.values[i] })
+	if keepDims {
+		return sum, nil
+	}
+	r, _ := newReduction(t, axes, false)
+	return sum.Reshape(r.dims...), nil
+}
@@ -0,0 +1,123 @@
+package maths
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"testing"
+)
+
+func TestReductions(t *testing.T) {
+	// sequence(3, 2) holds the rows [0 1 2] and [3 4 5], the first dimension varies the fastest
+	tests := []struct {
+		name     string
+		fn       func(t *Tensor, keepDims bool, axes ...int) (*Tensor, error)
+		axes     []int
+		keepDims bool
+		dims     []int
+		want     []float64
+	}{
+		{name: "Sum", fn: Sum, dims: []int{}, want: []float64{15}},
+		{name: "Sum", fn: Sum, keepDims: true, dims: []int{1, 1}, want: []float64{15}},
+		{name: "Sum", fn: Sum, axes: []int{0}, dims: []int{2}, want: []float64{3, 12}},
+		{name: "Sum", fn: Sum, axes: []int{0}, keepDims: true, dims: []int{1, 2}, want: []float64{3, 12}},
+		{name: "Sum", fn: Sum, axes: []int{1}, dims: []int{3}, want: []float64{3, 5, 7}},
+		{name: "Sum", fn: Sum, axes: []int{1}, keepDims: true, dims: []int{3, 1}, want: []float64{3, 5, 7}},
+		{name: "Sum", fn: Sum, axes: []int{1, 0}, dims: []int{}, want: []float64{15}},
+		{name: "Mean", fn: Mean, axes: []int{0}, dims: []int{2}, want: []float64{1, 4}},
+		{name: "Mean", fn: Mean, axes: []int{1}, keepDims: true, dims: []int{3, 1}, want: []float64{1.5, 2.5, 3.5}},
+		{name: "Max", fn: Max, dims: []int{}, want: []float64{5}},
+		{name: "Max", fn: Max, axes: []int{0}, keepDims: true, dims: []int{1, 2}, want: []float64{2, 5}},
+		// The variance of 0, 1 and 2 is (1 + 0 + 1) / 3, that of 0 and 3 is (1.5² + 1.5²) / 2
+		{name: "Var", fn: Var, axes: []int{0}, dims: []int{2}, want: []float64{2.0 / 3, 2.0 / 3}},
+		{name: "Var", fn: Var, axes: []int{1}, keepDims: true, dims: []int{3, 1}, want: []float64{2.25, 2.25, 2.25}},
+		// The mean of 0..5 is 2.5, the squared differences are 6.25, 2.25, 0.25, 0.25, 2.25 and 6.25
+		{name: "Var", fn: Var, dims: []int{}, want: []float64{17.5 / 6}},
+		{name: "LogSumExp", fn: LogSumExp, axes: []int{1}, dims: []int{3},
+			want: []float64{math.Log(1 + math.Exp(3)), math.Log(math.Exp(1) + math.Exp(4)), math.Log(math.Exp(2) + math.Exp(5))}},
+	}
+	for _, test := range tests {
+		name := fmt.Sprintf("%s axes=%v keepDims=%v", test.name, test.axes, test.keepDims)
+		got, err := test.fn(sequence(3, 2), test.keepDims, test.axes...)
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		assertTensor(t, name, got, test.dims, test.want, 1e-12)
+	}
+}
+
+func TestReductionOfView(t *testing.T) {
+	// The transpose holds the rows [0 3], [1 4] and [2 5]
+	got, err := Sum(sequence(3, 2).Transpose(0, 1), false, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertTensor(t, "Sum", got, []int{3}, []float64{3, 5, 7}, 0)
+}
+
+func TestReductionInvalidAxes(t *testing.T) {
+	for _, axes := range [][]int{{2}, {-1}, {0, 0}} {
+		if _, err := Sum(sequence(3, 2), false, axes...); !errors.Is(err, ErrShape) {
+			t.Errorf("Sum along %v returned %v, want %v", axes, err, ErrShape)
+		}
+	}
+	for _, axis := range []int{2, -1} {
+		if _, err := ArgMax(sequence(3, 2), axis, false); !errors.Is(err, ErrShape) {
+			t.Errorf("ArgMax along %d returned %v, want %v", axis, err, ErrShape)
+		}
+	}
+}
+
+func TestArgMax(t *testing.T) {
+	nan := math.NaN()
+	tests := []struct {
+		name     string
+		input    *Tensor
+		axis     int
+		keepDims bool
+		dims     []int
+		want     []float64
+	}{
+		{name: "rows", input: sequence(3, 2), axis: 0, dims: []int{2}, want: []float64{2, 2}},
+		{name: "columns", input: sequence(3, 2), axis: 1, keepDims: true, dims: []int{3, 1}, want: []float64{1, 1, 1}},
+		// The first of equal values is returned
+		{name: "ties", input: NewTensor([]int{4}, []float64{1, 3, 3, 2}), dims: []int{}, want: []float64{1}},
+		{name: "all equal", input: NewTensor([]int{3}, []float64{2, 2, 2}), dims: []int{}, want: []float64{0}},
+		{name: "negative infinity", input: NewTensor([]int{2}, []float64{math.Inf(-1), math.Inf(-1)}), dims: []int{}, want: []float64{0}},
+		// NaN is larger than any value, the first NaN is returned
+		{name: "NaN", input: NewTensor([]int{4}, []float64{1, nan, 5, nan}), dims: []int{}, want: []float64{1}},
+		{name: "NaN first", input: NewTensor([]int{3}, []float64{nan, 5, 7}), dims: []int{}, want: []float64{0}},
+	}
+	for _, test := range tests {
+		got, err := ArgMax(test.input, test.axis, test.keepDims)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		assertTensor(t, test.name, got, test.dims, test.want, 0)
+	}
+}
+
+func TestLogSumExpInfinity(t *testing.T) {
+	inf := math.Inf(1)
+	tests := []struct {
+		name   string
+		values []float64
+		want   float64
+	}{
+		{name: "large", values: []float64{1000, 1000}, want: 1000 + math.Log(2)},
+		{name: "positive infinity", values: []float64{1, inf}, want: inf},
+		{name: "negative infinity", values: []float64{-inf, 0}, want: 0},
+		{name: "all negative infinity", values: []float64{-inf, -inf}, want: -inf},
+		{name: "both infinities", values: []float64{-inf, inf}, want: inf},
+	}
+	for _, test := range tests {
+		got, err := LogSumExp(NewTensor([]int{len(test.values)}, test.values), false)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		assertTensor(t, test.name, got, []int{}, []float64{test.want}, 1e-12)
+	}
+}
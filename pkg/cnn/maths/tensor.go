@@ -9,6 +9,10 @@ import (
 type Tensor struct {
 	dimension []int
 	values    []float64
+
+	// strides and offset are only set for views that are not contiguous, see view.go
+	strides []int
+	offset  int
 }
 
 func NewTensor(dimension []int, values []float64) *Tensor {
@@ -36,18 +40,23 @@ func (t *Tensor) MulElem(other *Tensor) *Tensor {
 	if t.Len() != other.Len() {
 		panic("dimension mismatch in Tensor.MulElem")
 	}
-	return NewTensor(t.dimension, MulFloat64Slices(t.values, other.values))
+	return NewTensor(t.dimension, MulFloat64Slices(t.Values(), other.Values()))
 }
 
 func (t *Tensor) MulScalar(scalar float64) *Tensor {
-	return NewTensor(t.dimension, MulFloat64ToSlice(t.values, scalar))
+	return NewTensor(t.dimension, MulFloat64ToSlice(t.Values(), scalar))
 }
 
-// Add Elementwise addition between two tensors. Each element of t is multiplied by "factor" first
+// Add Elementwise addition between two tensors. Each element of other is multiplied by "factor" first.
+// Use the Add function for tensors of different sizes.
 func (t *Tensor) Add(other *Tensor, factor float64) *Tensor {
-	values := make([]float64, len(t.values))
+	if t.Len() != other.Len() {
+		panic(fmt.Sprintf("dimension mismatch in Tensor.Add: %v and %v", t.dimension, other.dimension))
+	}
+	tValues, otherValues := t.Values(), other.Values()
+	values := make([]float64, len(tValues))
 	for i := 0; i < len(values); i++ {
-		values[i] = t.values[i] + other.values[i]*factor
+		values[i] = tValues[i] + otherValues[i]*factor
 	}
 	return NewTensor(t.dimension, values)
 }
@@ -65,15 +74,14 @@ func (t *Tensor) AppendTensor(other *Tensor, resultRank int) *Tensor {
 		newDimSizes[resultRank-1] += 1
 	}
 
-	newValues := append(t.values, other.values...)
+	// Copy the values, t can share its values with another tensor
+	newValues := append(append(make([]float64, 0, t.Len()+other.Len()), t.Values()...), other.Values()...)
 
 	return NewTensor(newDimSizes, newValues)
 }
 
 func (t *Tensor) Apply(fn func(val float64, idx int) float64) {
-	for i := 0; i < len(t.values); i++ {
-		t.values[i] = fn(t.values[i], i)
-	}
+	t.forEach(func(i, index int) { t.values[index] = fn(t.values[index], i) })
 }
 
 //Randomize uses a rand.NormFloat64() function which returns a random using normally distributed values with
@@ -87,24 +95,60 @@ func (t *Tensor) Randomize() *Tensor {
 	return tensor
 }
 
+// SubTensor returns a copy of the values offset up to offset+product(dims) of t as a tensor of size dims.
+// View returns the same tensor without copying.
 func (t *Tensor) SubTensor(dims []int, offset int) *Tensor {
-	tensor := NewTensor(dims, nil)
+	return t.View(dims, offset).copy()
+}
+
+// View returns the values offset up to offset+product(dims) of t as a tensor of size dims, like SubTensor.
+// It shares the values of t if t is contiguous, so writing to the result writes to t.
+func (t *Tensor) View(dims []int, offset int) *Tensor {
 	product := 1
 	for _, dim := range dims {
 		product *= dim
 	}
-	for i := offset; i < product+offset; i++ {
-		tensor.values[i-offset] = t.values[i]
+	values := t.Contiguous().values
+	return NewTensor(dims, values[offset:offset+product:offset+product])
+}
+
+// Returns a tensor with opposite corners at corner1 and corner2.
+// The values are copied, values outside of t are 0. RegionView returns the same tensor without copying.
+func (t *Tensor) Region(corner1, corner2 []int) *Tensor {
+	region, inside := t.region(corner1, corner2)
+	if inside {
+		return region.copy()
 	}
+	return region
+}
 
-	return tensor
+// RegionView returns a tensor with opposite corners at corner1 and corner2, like Region.
+// If the region lies within t, the result is a view sharing the values of t, so writing to it writes to t.
+// Otherwise the values outside of t are 0 and the values are copied.
+func (t *Tensor) RegionView(corner1, corner2 []int) *Tensor {
+	region, _ := t.region(corner1, corner2)
+	return region
 }
 
-// Returns a tensor with opposite corners at corner1 and corner2
-func (t *Tensor) Region(corner1, corner2 []int) *Tensor {
+// region returns a view of the region with opposite corners at corner1 and corner2 and true if it lies within t,
+// otherwise it returns a copy padded with zeros and false.
+func (t *Tensor) region(corner1, corner2 []int) (*Tensor, bool) {
 	newDimSizes := make([]int, len(corner1))
+	inside := len(corner1) == len(t.dimension)
 	for i := 0; i < len(newDimSizes); i++ {
 		newDimSizes[i] = int(math.Abs(float64(corner2[i])-float64(corner1[i])) + 1)
+		if inside && (corner1[i] < 0 || corner2[i] < 0 || corner1[i] >= t.dimension[i] || corner2[i] >= t.dimension[i]) {
+			inside = false
+		}
+	}
+
+	if inside {
+		strides := t.Strides()
+		offset := t.offset
+		for i := range corner1 {
+			offset += int(math.Min(float64(corner1[i]), float64(corner2[i]))) * strides[i]
+		}
+		return newView(newDimSizes, strides, offset, t.values), true
 	}
 
 	region := NewTensor(newDimSizes, nil)
@@ -114,7 +158,7 @@ func (t *Tensor) Region(corner1, corner2 []int) *Tensor {
 		region.values[i.GetCurrentCount()-1] = t.AtCoords(coords)
 	}
 
-	return region
+	return region, false
 }
 
 func (t *Tensor) Equals(other *Tensor) bool {
@@ -127,12 +171,13 @@ func (t *Tensor) Equals(other *Tensor) bool {
 		}
 	}
 
-	if len(t.values) != len(other.values) {
+	tValues, otherValues := t.Values(), other.Values()
+	if len(tValues) != len(otherValues) {
 		return false
 	}
 
-	for i := 0; i < len(t.values); i++ {
-		if fmt.Sprintf("%10.f", t.values[i]) != fmt.Sprintf("%10.f", other.values[i]) {
+	for i := 0; i < len(tValues); i++ {
+		if fmt.Sprintf("%10.f", tValues[i]) != fmt.Sprintf("%10.f", otherValues[i]) {
 			return false
 		}
 	}
@@ -142,21 +187,36 @@ func (t *Tensor) Equals(other *Tensor) bool {
 
 // InnerProduct Multiply each element of t1 with a corresponding element of t2, then sum these values
 func (t *Tensor) InnerProduct(other *Tensor) float64 {
-	if len(t.values) != len(other.values) {
-		panic(fmt.Sprintf("len(t.values)=%d != len(other.values)=%d", len(t.values), len(other.values)))
+	if t.Len() != other.Len() {
+		panic(fmt.Sprintf("t.Len()=%d != other.Len()=%d", t.Len(), other.Len()))
 	}
 	result := 0.0
-	for i := 0; i < len(t.values); i++ {
-		result += t.values[i] * other.values[i]
+	if t.strides == nil && other.strides == nil {
+		for i := 0; i < len(t.values); i++ {
+			result += t.values[i] * other.values[i]
+		}
+		return result
 	}
+	t.forEach(func(i, index int) { result += t.values[index] * other.At(i) })
 	return result
 }
 
 func (t *Tensor) MaxValueIndex() int {
-	return FindMaxIndexFloat64Slice(t.values)
+	if t.strides == nil {
+		return FindMaxIndexFloat64Slice(t.values)
+	}
+	highest := math.MaxFloat64 * -1
+	highestIndex := -1
+	t.forEach(func(i, index int) {
+		if t.values[index] > highest {
+			highest = t.values[index]
+			highestIndex = i
+		}
+	})
+	return highestIndex
 }
 func (t *Tensor) MaxValue() float64 {
-	return FindMaxValueFloat64Slice(t.values)
+	return FindMaxValueFloat64Slice(t.Values())
 }
 
 func (t *Tensor) Flip() *Tensor {
@@ -181,6 +241,16 @@ func (t *Tensor) Zeroes() *Tensor {
 	return NewTensor(t.dimension, nil)
 }
 func (t *Tensor) AtCoords(coords []int) float64 {
+	if t.strides != nil {
+		index := t.offset
+		for i, coord := range coords {
+			if coord < 0 || coord >= t.dimension[i] {
+				return 0
+			}
+			index += coord * t.strides[i]
+		}
+		return t.values[index]
+	}
 	index := CoordsToHorner(coords, t.dimension)
 	if index >= 0 && index < len(t.values) {
 		return t.values[index]
@@ -189,9 +259,20 @@ func (t *Tensor) AtCoords(coords []int) float64 {
 	return 0
 }
 
-func (t *Tensor) SetValue(idx int, val float64) { t.values[idx] = val }
-func (t *Tensor) Set(coords []int, val float64) { t.values[CoordsToHorner(coords, t.dimension)] = val }
-func (t *Tensor) Len() int                      { return len(t.values) }
-func (t *Tensor) At(i int) float64              { return t.values[i] }
-func (t *Tensor) Dimensions() []int             { return t.dimension }
-func (t *Tensor) Values() []float64             { return t.values }
+func (t *Tensor) SetValue(idx int, val float64) { t.values[t.index(idx)] = val }
+func (t *Tensor) Set(coords []int, val float64) {
+	t.values[t.index(CoordsToHorner(coords, t.dimension))] = val
+}
+func (t *Tensor) At(i int) float64  { return t.values[t.index(i)] }
+func (t *Tensor) Dimensions() []int { return t.dimension }
+
+func (t *Tensor) Len() int {
+	if t.strides == nil {
+		return len(t.values)
+	}
+	return ProductIntSlice(t.dimension)
+}
+
+// Values returns the values of t in Horner order. For a contiguous tensor these are the values of t itself, for
+// other views it is a copy.
+func (t *Tensor) Values() []float64 { return t.Contiguous().values }
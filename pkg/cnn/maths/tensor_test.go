@@ -0,0 +1,77 @@
+package maths
+
+import "testing"
+
+// sequence returns a tensor of size dims with the values 0, 1, 2, ...
+func sequence(dims ...int) *Tensor {
+	t := NewTensor(dims, nil)
+	t.Apply(func(_ float64, i int) float64 { return float64(i) })
+	return t
+}
+
+func TestSubTensorCopiesAndViewShares(t *testing.T) {
+	tensor := sequence(4, 3)
+
+	sub := tensor.SubTensor([]int{4}, 4)
+	sub.SetValue(0, -1)
+	if tensor.At(4) != 4 {
+		t.Errorf("writing to a SubTensor changed the tensor to %v", tensor.Values())
+	}
+
+	view := tensor.View([]int{4}, 4)
+	if view.At(1) != 5 {
+		t.Errorf("view value %g, want 5", view.At(1))
+	}
+	view.SetValue(0, -1)
+	if tensor.At(4) != -1 {
+		t.Errorf("writing to a View did not change the tensor: %v", tensor.Values())
+	}
+}
+
+func TestRegionCopiesAndRegionViewShares(t *testing.T) {
+	tests := []struct {
+		name    string
+		tensor  *Tensor
+		corner1 []int
+		corner2 []int
+	}{
+		// Rows of a region of the first dimension are not contiguous, regions of whole rows are
+		{name: "strided", tensor: sequence(4, 3), corner1: []int{1, 1}, corner2: []int{2, 2}},
+		{name: "contiguous", tensor: sequence(4, 3), corner1: []int{0, 1}, corner2: []int{3, 2}},
+		{name: "view", tensor: sequence(4, 3, 2).Transpose(0, 1), corner1: []int{0, 1, 1}, corner2: []int{2, 2, 1}},
+	}
+	for _, test := range tests {
+		want := test.tensor.AtCoords(test.corner1)
+
+		region := test.tensor.Region(test.corner1, test.corner2)
+		if region.At(0) != want {
+			t.Errorf("%s: first value of region %g, want %g", test.name, region.At(0), want)
+		}
+		region.SetValue(0, -1)
+		if test.tensor.AtCoords(test.corner1) != want {
+			t.Errorf("%s: writing to a Region changed the tensor", test.name)
+		}
+
+		view := test.tensor.RegionView(test.corner1, test.corner2)
+		if view.Len() != region.Len() || view.At(1) != region.At(1) {
+			t.Errorf("%s: RegionView %v differs from Region %v", test.name, view.Values(), region.Values())
+		}
+		view.SetValue(0, -1)
+		if test.tensor.AtCoords(test.corner1) != -1 {
+			t.Errorf("%s: writing to a RegionView did not change the tensor", test.name)
+		}
+	}
+}
+
+func TestRegionOutsideTensorIsPadded(t *testing.T) {
+	tensor := sequence(2, 2)
+	for _, region := range []*Tensor{tensor.Region([]int{0, 1}, []int{1, 2}), tensor.RegionView([]int{0, 1}, []int{1, 2})} {
+		if values := region.Values(); values[0] != 2 || values[1] != 3 || values[2] != 0 || values[3] != 0 {
+			t.Errorf("region values %v, want [2 3 0 0]", values)
+		}
+		region.SetValue(0, -1)
+		if tensor.At(2) != 2 {
+			t.Errorf("writing to a padded region changed the tensor")
+		}
+	}
+}
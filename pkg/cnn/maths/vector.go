@@ -1,3 +1,30 @@
 package maths
 
-type Vector struct{}
+import "fmt"
+
+// Vector is a dense vector of float64 values. A Vector returned by Matrix.Row shares its values with the matrix.
+type Vector struct {
+	values []float64
+}
+
+// NewVector returns a vector of length values. If values is nil the vector is zero-valued, otherwise the vector
+// uses values, which must have the given length.
+func NewVector(length int, values []float64) *Vector {
+	if values == nil {
+		return &Vector{values: make([]float64, length)}
+	}
+	if len(values) != length {
+		panic(fmt.Sprintf("len(values)=%d != length=%d in NewVector", len(values), length))
+	}
+	return &Vector{values: values}
+}
+
+func (v *Vector) Len() int                 { return len(v.values) }
+func (v *Vector) At(i int) float64         { return v.values[i] }
+func (v *Vector) Set(i int, value float64) { v.values[i] = value }
+func (v *Vector) Values() []float64        { return v.values }
+
+// Copy returns a vector with a copy of the values of v
+func (v *Vector) Copy() *Vector {
+	return &Vector{values: append([]float64(nil), v.values...)}
+}
@@ -0,0 +1,198 @@
+package maths
+
+import "fmt"
+
+// A Tensor can be a view of the values of another tensor. A view has strides: the distance in values between two
+// consecutive positions along every dimension, and an offset: the index in values of its first value.
+// Tensors created by NewTensor are contiguous: their values are stored in Horner order from the start of values
+// and they have no strides. Views that happen to be contiguous are stored the same way, sharing a part of the
+// values slice.
+// Slice, RegionView, View, Reshape, Permute, Transpose, Squeeze and Unsqueeze return views without copying
+// values. Writing to a view writes to the tensor it was created from. Region and SubTensor return copies.
+
+// contiguousStrides returns the strides of a contiguous tensor of size dims
+func contiguousStrides(dims []int) []int {
+	strides := make([]int, len(dims))
+	product := 1
+	for i, dim := range dims {
+		strides[i] = product
+		product *= dim
+	}
+	return strides
+}
+
+// newView returns a view of values with the given dimensions, strides and offset. The view is stored as a
+// contiguous tensor if possible.
+func newView(dims, strides []int, offset int, values []float64) *Tensor {
+	contiguous := true
+	product := 1
+	for i, dim := range dims {
+		// The stride of a dimension of size 1 is never used
+		if dim != 1 && strides[i] != product {
+			contiguous = false
+		}
+		product *= dim
+	}
+	if contiguous {
+		return &Tensor{dimension: dims, values: values[offset : offset+product : offset+product]}
+	}
+	return &Tensor{dimension: dims, values: values, strides: strides, offset: offset}
+}
+
+// IsContiguous returns whether the values of t are stored in Horner order without gaps, in which case Values
+// returns them without copying.
+func (t *Tensor) IsContiguous() bool { return t.strides == nil }
+
+// Strides returns the distance in the backing values between two consecutive positions along every dimension.
+func (t *Tensor) Strides() []int {
+	if t.strides == nil {
+		return contiguousStrides(t.dimension)
+	}
+	return append([]int(nil), t.strides...)
+}
+
+// index returns the index in t.values of the i-th value of t in Horner order
+func (t *Tensor) index(i int) int {
+	if t.strides == nil {
+		return i
+	}
+	index := t.offset
+	for d, dim := range t.dimension {
+		index += (i % dim) * t.strides[d]
+		i /= dim
+	}
+	return index
+}
+
+// forEach calls fn for every value of t in Horner order with its position i and its index in t.values
+func (t *Tensor) forEach(fn func(i, index int)) {
+	if t.strides == nil {
+		for i := range t.values {
+			fn(i, i)
+		}
+		return
+	}
+
+	length := ProductIntSlice(t.dimension)
+	coords := make([]int, len(t.dimension))
+	index := t.offset
+	for i := 0; i < length; i++ {
+		fn(i, index)
+		// Move to the next position, the first dimension varies the fastest
+		for d := range coords {
+			coords[d]++
+			index += t.strides[d]
+			if coords[d] < t.dimension[d] {
+				break
+			}
+			index -= coords[d] * t.strides[d]
+			coords[d] = 0
+		}
+	}
+}
+
+// copy returns a contiguous copy of t that does not share its values
+func (t *Tensor) copy() *Tensor {
+	if t.strides != nil {
+		return t.Contiguous()
+	}
+	return NewTensor(append([]int(nil), t.dimension...), append([]float64(nil), t.values...))
+}
+
+// Contiguous returns t if it is contiguous, otherwise it returns a contiguous copy of t.
+func (t *Tensor) Contiguous() *Tensor {
+	if t.strides == nil {
+		return t
+	}
+	values := make([]float64, ProductIntSlice(t.dimension))
+	t.forEach(func(i, index int) { values[i] = t.values[index] })
+	return NewTensor(append([]int(nil), t.dimension...), values)
+}
+
+// Slice returns a view of the positions start up to end of dimension axis of t.
+func (t *Tensor) Slice(axis, start, end int) *Tensor {
+	if axis < 0 || axis >= len(t.dimension) || start < 0 || end > t.dimension[axis] || start > end {
+		panic(fmt.Sprintf("slice [%d:%d] of axis %d is out of range of tensor of size %v", start, end, axis, t.dimension))
+	}
+	strides := t.Strides()
+	dims := append([]int(nil), t.dimension...)
+	dims[axis] = end - start
+	return newView(dims, strides, t.offset+start*strides[axis], t.values)
+}
+
+// Reshape returns a tensor of size dims with the values of t in the same Horner order. It shares the values of t
+// if t is contiguous, otherwise the values are copied first.
+func (t *Tensor) Reshape(dims ...int) *Tensor {
+	if ProductIntSlice(dims) != t.Len() {
+		panic(fmt.Sprintf("can not reshape tensor of size %v to %v", t.dimension, dims))
+	}
+	return NewTensor(append([]int(nil), dims...), t.Contiguous().values)
+}
+
+// Permute returns a view of t with its dimensions reordered: dimension i of the view is dimension axes[i] of t.
+func (t *Tensor) Permute(axes ...int) *Tensor {
+	if len(axes) != len(t.dimension) {
+		panic(fmt.Sprintf("permutation %v does not match tensor of size %v", axes, t.dimension))
+	}
+	strides := t.Strides()
+	dims := make([]int, len(axes))
+	permuted := make([]int, len(axes))
+	seen := make([]bool, len(axes))
+	for i, axis := range axes {
+		if axis < 0 || axis >= len(axes) || seen[axis] {
+			panic(fmt.Sprintf("%v is not a permutation of the dimensions of a tensor of size %v", axes, t.dimension))
+		}
+		seen[axis] = true
+		dims[i] = t.dimension[axis]
+		permuted[i] = strides[axis]
+	}
+	return newView(dims, permuted, t.offset, t.values)
+}
+
+// Transpose returns a view of t with dimensions axis1 and axis2 swapped.
+func (t *Tensor) Transpose(axis1, axis2 int) *Tensor {
+	axes := make([]int, len(t.dimension))
+	for i := range axes {
+		axes[i] = i
+	}
+	axes[axis1], axes[axis2] = axes[axis2], axes[axis1]
+	return t.Permute(axes...)
+}
+
+// Squeeze returns a view of t without the given dimensions, which must have size 1. Without axes all dimensions
+// of size 1 are removed.
+func (t *Tensor) Squeeze(axes ...int) *Tensor {
+	remove := make([]bool, len(t.dimension))
+	if len(axes) == 0 {
+		for i, dim := range t.dimension {
+			remove[i] = dim == 1
+		}
+	}
+	for _, axis := range axes {
+		if axis < 0 || axis >= len(t.dimension) || t.dimension[axis] != 1 {
+			panic(fmt.Sprintf("can not squeeze axis %d of tensor of size %v", axis, t.dimension))
+		}
+		remove[axis] = true
+	}
+
+	strides := t.Strides()
+	var dims, squeezed []int
+	for i, dim := range t.dimension {
+		if !remove[i] {
+			dims = append(dims, dim)
+			squeezed = append(squeezed, strides[i])
+		}
+	}
+	return newView(dims, squeezed, t.offset, t.values)
+}
+
+// Unsqueeze returns a view of t with a dimension of size 1 inserted at axis.
+func (t *Tensor) Unsqueeze(axis int) *Tensor {
+	if axis < 0 || axis > len(t.dimension) {
+		panic(fmt.Sprintf("can not insert axis %d in tensor of size %v", axis, t.dimension))
+	}
+	strides := t.Strides()
+	dims := append(append(append([]int(nil), t.dimension[:axis]...), 1), t.dimension[axis:]...)
+	unsqueezed := append(append(append([]int(nil), strides[:axis]...), 0), strides[axis:]...)
+	return newView(dims, unsqueezed, t.offset, t.values)
+}
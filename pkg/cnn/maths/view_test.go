@@ -0,0 +1,140 @@
+package maths
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestViews(t *testing.T) {
+	// The values of sequence are their positions in the source, so the value of a view tells where it is stored
+	tests := []struct {
+		name       string
+		view       func() (source, view *Tensor)
+		dims       []int
+		want       []float64
+		contiguous bool
+		shared     bool
+	}{
+		{name: "Slice rows", view: func() (*Tensor, *Tensor) { s := sequence(4, 3); return s, s.Slice(0, 1, 3) },
+			dims: []int{2, 3}, want: []float64{1, 2, 5, 6, 9, 10}, shared: true},
+		{name: "Slice columns", view: func() (*Tensor, *Tensor) { s := sequence(4, 3); return s, s.Slice(1, 1, 3) },
+			dims: []int{4, 2}, want: []float64{4, 5, 6, 7, 8, 9, 10, 11}, contiguous: true, shared: true},
+		{name: "Slice empty", view: func() (*Tensor, *Tensor) { s := sequence(4, 3); return s, s.Slice(1, 2, 2) },
+			dims: []int{4, 0}, want: []float64{}, contiguous: true, shared: true},
+		{name: "Permute", view: func() (*Tensor, *Tensor) { s := sequence(4, 3, 2); return s, s.Permute(2, 0, 1) },
+			dims: []int{2, 4, 3}, want: []float64{0, 12, 1, 13, 2, 14, 3, 15, 4, 16, 5, 17, 6, 18, 7, 19, 8, 20, 9, 21, 10, 22, 11, 23},
+			shared: true},
+		{name: "Permute identity", view: func() (*Tensor, *Tensor) { s := sequence(3, 2); return s, s.Permute(0, 1) },
+			dims: []int{3, 2}, want: []float64{0, 1, 2, 3, 4, 5}, contiguous: true, shared: true},
+		{name: "Transpose", view: func() (*Tensor, *Tensor) { s := sequence(3, 2); return s, s.Transpose(0, 1) },
+			dims: []int{2, 3}, want: []float64{0, 3, 1, 4, 2, 5}, shared: true},
+		{name: "Transpose twice", view: func() (*Tensor, *Tensor) { s := sequence(3, 2); return s, s.Transpose(0, 1).Transpose(1, 0) },
+			dims: []int{3, 2}, want: []float64{0, 1, 2, 3, 4, 5}, contiguous: true, shared: true},
+		{name: "Squeeze all", view: func() (*Tensor, *Tensor) { s := sequence(3, 1, 2, 1); return s, s.Squeeze() },
+			dims: []int{3, 2}, want: []float64{0, 1, 2, 3, 4, 5}, contiguous: true, shared: true},
+		{name: "Squeeze axis", view: func() (*Tensor, *Tensor) { s := sequence(1, 3, 1); return s, s.Squeeze(2) },
+			dims: []int{1, 3}, want: []float64{0, 1, 2}, contiguous: true, shared: true},
+		{name: "Squeeze slice", view: func() (*Tensor, *Tensor) { s := sequence(4, 3); return s, s.Slice(0, 2, 3).Squeeze(0) },
+			dims: []int{3}, want: []float64{2, 6, 10}, shared: true},
+		{name: "Unsqueeze", view: func() (*Tensor, *Tensor) { s := sequence(3, 2); return s, s.Unsqueeze(0) },
+			dims: []int{1, 3, 2}, want: []float64{0, 1, 2, 3, 4, 5}, contiguous: true, shared: true},
+		{name: "Unsqueeze last", view: func() (*Tensor, *Tensor) { s := sequence(3, 2); return s, s.Unsqueeze(2) },
+			dims: []int{3, 2, 1}, want: []float64{0, 1, 2, 3, 4, 5}, contiguous: true, shared: true},
+		{name: "Unsqueeze transpose", view: func() (*Tensor, *Tensor) { s := sequence(3, 2); return s, s.Transpose(0, 1).Unsqueeze(1) },
+			dims: []int{2, 1, 3}, want: []float64{0, 3, 1, 4, 2, 5}, shared: true},
+		{name: "Reshape", view: func() (*Tensor, *Tensor) { s := sequence(3, 2); return s, s.Reshape(2, 3) },
+			dims: []int{2, 3}, want: []float64{0, 1, 2, 3, 4, 5}, contiguous: true, shared: true},
+		// A view that is not contiguous is copied before reshaping
+		{name: "Reshape transpose", view: func() (*Tensor, *Tensor) { s := sequence(3, 2); return s, s.Transpose(0, 1).Reshape(6) },
+			dims: []int{6}, want: []float64{0, 3, 1, 4, 2, 5}, contiguous: true},
+		{name: "Contiguous", view: func() (*Tensor, *Tensor) { s := sequence(3, 2); return s, s.Contiguous() },
+			dims: []int{3, 2}, want: []float64{0, 1, 2, 3, 4, 5}, contiguous: true, shared: true},
+		{name: "Contiguous transpose", view: func() (*Tensor, *Tensor) { s := sequence(3, 2); return s, s.Transpose(0, 1).Contiguous() },
+			dims: []int{2, 3}, want: []float64{0, 3, 1, 4, 2, 5}, contiguous: true},
+	}
+	for _, test := range tests {
+		source, view := test.view()
+		if fmt.Sprint(view.Dimensions()) != fmt.Sprint(test.dims) {
+			t.Errorf("%s: dimensions %v, want %v", test.name, view.Dimensions(), test.dims)
+			continue
+		}
+		if view.IsContiguous() != test.contiguous {
+			t.Errorf("%s: IsContiguous is %v, want %v", test.name, view.IsContiguous(), test.contiguous)
+		}
+		if view.Len() != len(test.want) || fmt.Sprint(view.Values()) != fmt.Sprint(test.want) {
+			t.Errorf("%s: values %v, want %v", test.name, view.Values(), test.want)
+			continue
+		}
+		for i, want := range test.want {
+			if view.At(i) != want {
+				t.Errorf("%s: At(%d) is %g, want %g", test.name, i, view.At(i), want)
+			}
+		}
+		if len(test.want) == 0 {
+			continue
+		}
+
+		// Write to the last value of the view and look for it at its position in the source
+		last := len(test.want) - 1
+		position := int(test.want[last])
+		view.SetValue(last, -1)
+		if shared := source.At(position) == -1; shared != test.shared {
+			t.Errorf("%s: writing to the view changed the source: %v, want %v", test.name, shared, test.shared)
+		}
+		if view.At(last) != -1 {
+			t.Errorf("%s: At(%d) is %g after writing -1", test.name, last, view.At(last))
+		}
+	}
+}
+
+func TestViewOfView(t *testing.T) {
+	source := sequence(4, 3, 2)
+	// The slice holds the positions 1 and 2 of the first dimension, the transpose swaps the last two dimensions
+	view := source.Slice(0, 1, 3).Transpose(1, 2)
+	if want := []int{2, 2, 3}; fmt.Sprint(view.Dimensions()) != fmt.Sprint(want) {
+		t.Fatalf("dimensions %v, want %v", view.Dimensions(), want)
+	}
+	// Position [i, k, j] of the view is position [i+1, j, k] of the source
+	for _, coords := range [][]int{{0, 0, 0}, {1, 0, 2}, {0, 1, 1}, {1, 1, 2}} {
+		want := source.AtCoords([]int{coords[0] + 1, coords[2], coords[1]})
+		if got := view.AtCoords(coords); got != want {
+			t.Errorf("AtCoords(%v) is %g, want %g", coords, got, want)
+		}
+	}
+	view.Set([]int{1, 1, 2}, -1)
+	if got := source.AtCoords([]int{2, 2, 1}); got != -1 {
+		t.Errorf("writing through the view gave the source value %g, want -1", got)
+	}
+}
+
+func TestViewPanics(t *testing.T) {
+	tests := []struct {
+		name string
+		fn   func(t *Tensor)
+	}{
+		{name: "Slice axis", fn: func(t *Tensor) { t.Slice(2, 0, 1) }},
+		{name: "Slice negative axis", fn: func(t *Tensor) { t.Slice(-1, 0, 1) }},
+		{name: "Slice negative start", fn: func(t *Tensor) { t.Slice(0, -1, 2) }},
+		{name: "Slice end", fn: func(t *Tensor) { t.Slice(0, 2, 5) }},
+		{name: "Slice start after end", fn: func(t *Tensor) { t.Slice(0, 3, 2) }},
+		{name: "Reshape", fn: func(t *Tensor) { t.Reshape(5) }},
+		{name: "Permute length", fn: func(t *Tensor) { t.Permute(0) }},
+		{name: "Permute duplicate", fn: func(t *Tensor) { t.Permute(0, 0) }},
+		{name: "Permute axis", fn: func(t *Tensor) { t.Permute(0, 2) }},
+		{name: "Transpose", fn: func(t *Tensor) { t.Transpose(0, 2) }},
+		{name: "Squeeze size", fn: func(t *Tensor) { t.Squeeze(0) }},
+		{name: "Squeeze axis", fn: func(t *Tensor) { t.Squeeze(2) }},
+		{name: "Unsqueeze axis", fn: func(t *Tensor) { t.Unsqueeze(3) }},
+		{name: "Unsqueeze negative axis", fn: func(t *Tensor) { t.Unsqueeze(-1) }},
+	}
+	for _, test := range tests {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%s did not panic", test.name)
+				}
+			}()
+			test.fn(sequence(4, 3))
+		}()
+	}
+}
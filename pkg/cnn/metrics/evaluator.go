@@ -0,0 +1,286 @@
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/rubenwo/cnn-go/pkg/cnn/maths"
+)
+
+// Evaluator accumulates the predictions of a classifier one example at a time and computes classification metrics
+// from them. The class of a target or prediction is the index of its largest value.
+// The scores of every example are kept in memory to compute the areas under the ROC and PR curves, so the memory
+// use grows with the number of examples times the number of classes. An Evaluator is not safe for concurrent use.
+type Evaluator struct {
+	classes int
+	topK    []int
+
+	// confusion[actual][predicted] counts the examples
+	confusion   [][]int
+	topKCorrect []int
+	actual      []int
+	scores      [][]float64
+}
+
+// NewEvaluator returns an evaluator for predictions of classes values. The top-k accuracy is computed for every k
+// in topK.
+func NewEvaluator(classes int, topK ...int) *Evaluator {
+	for _, k := range topK {
+		if k < 1 {
+			panic(fmt.Sprintf("top-k accuracy with k=%d", k))
+		}
+	}
+	e := &Evaluator{classes: classes, topK: append([]int(nil), topK...)}
+	e.Reset()
+	return e
+}
+
+// Reset removes all examples.
+func (e *Evaluator) Reset() {
+	e.confusion = make([][]int, e.classes)
+	for i := range e.confusion {
+		e.confusion[i] = make([]int, e.classes)
+	}
+	e.topKCorrect = make([]int, len(e.topK))
+	e.actual = nil
+	e.scores = nil
+}
+
+// Add records the prediction for a single example.
+func (e *Evaluator) Add(target, predicted []float64) {
+	if len(target) != e.classes || len(predicted) != e.classes {
+		panic(fmt.Sprintf("evaluator for %d classes got target of length %d and prediction of length %d", e.classes, len(target), len(predicted)))
+	}
+	actual := maths.FindMaxIndexFloat64Slice(target)
+	e.confusion[actual][maths.FindMaxIndexFloat64Slice(predicted)]++
+
+	// The rank of the actual class is the number of classes with a higher score, ties count in its favour
+	rank := 0
+	for _, score := range predicted {
+		if score > predicted[actual] {
+			rank++
+		}
+	}
+	for i, k := range e.topK {
+		if rank < k {
+			e.topKCorrect[i]++
+		}
+	}
+
+	e.actual = append(e.actual, actual)
+	e.scores = append(e.scores, append([]float64(nil), predicted...))
+}
+
+func (e *Evaluator) Count() int { return len(e.actual) }
+
+// ClassMetrics are the one-vs-rest metrics of a single class.
+type ClassMetrics struct {
+	// Precision is 0 if the class was never predicted, Recall is 0 if it does not occur
+	Precision float64
+	Recall    float64
+	F1        float64
+	// Support is the number of examples of the class
+	Support int
+	// ROCAUC and PRAUC are the areas under the ROC curve and the precision-recall curve (average precision) of
+	// the score of the class. They are NaN if all examples or none of them belong to the class.
+	ROCAUC float64
+	PRAUC  float64
+}
+
+// Evaluation holds the metrics computed by an Evaluator.
+type Evaluation struct {
+	Count    int
+	Accuracy float64
+	// Confusion[actual][predicted] is the number of examples of class actual that were predicted as predicted
+	Confusion [][]int
+	Classes   []ClassMetrics
+
+	// The macro averages are the unweighted means over the classes. The NaN AUCs of classes are left out, the
+	// macro AUCs are NaN if every class has a NaN AUC.
+	MacroPrecision, MacroRecall, MacroF1 float64
+	MacroROCAUC, MacroPRAUC              float64
+	// The micro averages are computed from the summed counts of all classes. With a single class per example they
+	// are all equal to the accuracy.
+	MicroPrecision, MicroRecall, MicroF1 float64
+
+	// Kappa is Cohen's kappa: the agreement of the predictions with the targets, corrected for chance. It is 1 when
+	// every target and prediction is the same class and 0 without examples.
+	Kappa float64
+	// TopK maps every k the evaluator was created with to the fraction of examples whose actual class is among the
+	// k highest scores
+	TopK map[int]float64
+}
+
+// Evaluate computes the metrics of all examples added so far.
+func (e *Evaluator) Evaluate() *Evaluation {
+	n := len(e.actual)
+	ev := &Evaluation{Count: n, Confusion: make([][]int, e.classes), Classes: make([]ClassMetrics, e.classes), TopK: map[int]float64{}}
+
+	predictedCounts := make([]int, e.classes)
+	correct := 0
+	for i, row := range e.confusion {
+		ev.Confusion[i] = append([]int(nil), row...)
+		for j, count := range row {
+			predictedCounts[j] += count
+		}
+		correct += row[i]
+	}
+
+	var truePositives, falsePositives, falseNegatives int
+	rocCount, prCount := 0, 0
+	expectedAgreement := 0.0
+	for c := range ev.Classes {
+		m := &ev.Classes[c]
+		tp := e.confusion[c][c]
+		for _, count := range e.confusion[c] {
+			m.Support += count
+		}
+		m.Precision = ratio(tp, predictedCounts[c])
+		m.Recall = ratio(tp, m.Support)
+		m.F1 = f1(m.Precision, m.Recall)
+		m.ROCAUC, m.PRAUC = e.curves(c)
+
+		truePositives += tp
+		falsePositives += predictedCounts[c] - tp
+		falseNegatives += m.Support - tp
+		expectedAgreement += float64(m.Support) * float64(predictedCounts[c])
+
+		ev.MacroPrecision += m.Precision
+		ev.MacroRecall += m.Recall
+		ev.MacroF1 += m.F1
+		if !math.IsNaN(m.ROCAUC) {
+			ev.MacroROCAUC += m.ROCAUC
+			rocCount++
+		}
+		if !math.IsNaN(m.PRAUC) {
+			ev.MacroPRAUC += m.PRAUC
+			prCount++
+		}
+	}
+
+	ev.Accuracy = ratio(correct, n)
+	ev.MacroPrecision /= float64(e.classes)
+	ev.MacroRecall /= float64(e.classes)
+	ev.MacroF1 /= float64(e.classes)
+	ev.MacroROCAUC /= float64(rocCount)
+	ev.MacroPRAUC /= float64(prCount)
+	ev.MicroPrecision = ratio(truePositives, truePositives+falsePositives)
+	ev.MicroRecall = ratio(truePositives, truePositives+falseNegatives)
+	ev.MicroF1 = f1(ev.MicroPrecision, ev.MicroRecall)
+
+	// kappa = (observed - expected) / (1 - expected), expected is the agreement of independent guesses with the
+	// same class frequencies
+	switch {
+	case n == 0:
+	case correct == n:
+		// Also covers an expected agreement of 1, where the formula is 0/0
+		ev.Kappa = 1
+	default:
+		expectedAgreement /= float64(n) * float64(n)
+		ev.Kappa = (ev.Accuracy - expectedAgreement) / (1 - expectedAgreement)
+	}
+
+	for i, k := range e.topK {
+		ev.TopK[k] = ratio(e.topKCorrect[i], n)
+	}
+	return ev
+}
+
+// curves returns the areas under the ROC and the precision-recall curve of the score of class c
+func (e *Evaluator) curves(c int) (roc, pr float64) {
+	order := make([]int, len(e.actual))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool { return e.scores[order[i]][c] > e.scores[order[j]][c] })
+
+	positives := 0
+	for _, actual := range e.actual {
+		if actual == c {
+			positives++
+		}
+	}
+	negatives := len(e.actual) - positives
+	if positives == 0 || negatives == 0 {
+		return math.NaN(), math.NaN()
+	}
+
+	// Walk the thresholds from the highest score down, examples with equal scores are one step of the curves
+	var tp, fp int
+	for start := 0; start < len(order); {
+		end := start
+		groupTP, groupFP := 0, 0
+		for ; end < len(order) && e.scores[order[end]][c] == e.scores[order[start]][c]; end++ {
+			if e.actual[order[end]] == c {
+				groupTP++
+			} else {
+				groupFP++
+			}
+		}
+		// ROC: the trapezoid under the step from (fp, tp) to (fp+groupFP, tp+groupTP)
+		roc += float64(groupFP) * (float64(tp) + float64(groupTP)/2)
+		tp, fp = tp+groupTP, fp+groupFP
+		// PR: average precision, the precision at every threshold weighted by the increase in recall
+		pr += float64(groupTP) / float64(positives) * float64(tp) / float64(tp+fp)
+		start = end
+	}
+	return roc / (float64(positives) * float64(negatives)), pr
+}
+
+func ratio(a, b int) float64 {
+	if b == 0 {
+		return 0
+	}
+	return float64(a) / float64(b)
+}
+
+func f1(precision, recall float64) float64 {
+	if precision+recall == 0 {
+		return 0
+	}
+	return 2 * precision * recall / (precision + recall)
+}
+
+// String renders the evaluation as text tables: the metrics of every class and their averages, followed by the
+// confusion matrix.
+func (ev *Evaluation) String() string {
+	var buf bytes.Buffer
+	w := tabwriter.NewWriter(&buf, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "class\tprecision\trecall\tf1\tsupport\troc-auc\tpr-auc\t")
+	for c, m := range ev.Classes {
+		fmt.Fprintf(w, "%d\t%.4f\t%.4f\t%.4f\t%d\t%.4f\t%.4f\t\n", c, m.Precision, m.Recall, m.F1, m.Support, m.ROCAUC, m.PRAUC)
+	}
+	fmt.Fprintf(w, "macro\t%.4f\t%.4f\t%.4f\t%d\t%.4f\t%.4f\t\n", ev.MacroPrecision, ev.MacroRecall, ev.MacroF1, ev.Count, ev.MacroROCAUC, ev.MacroPRAUC)
+	fmt.Fprintf(w, "micro\t%.4f\t%.4f\t%.4f\t%d\t\t\t\n", ev.MicroPrecision, ev.MicroRecall, ev.MicroF1, ev.Count)
+	w.Flush()
+
+	fmt.Fprintf(&buf, "accuracy: %.4f, cohen's kappa: %.4f\n", ev.Accuracy, ev.Kappa)
+	ks := make([]int, 0, len(ev.TopK))
+	for k := range ev.TopK {
+		ks = append(ks, k)
+	}
+	sort.Ints(ks)
+	for _, k := range ks {
+		fmt.Fprintf(&buf, "top-%d accuracy: %.4f\n", k, ev.TopK[k])
+	}
+
+	fmt.Fprintln(&buf, "confusion matrix (rows: actual, columns: predicted):")
+	w = tabwriter.NewWriter(&buf, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprint(w, "\t")
+	for c := range ev.Confusion {
+		fmt.Fprintf(w, "%d\t", c)
+	}
+	fmt.Fprintln(w)
+	for c, row := range ev.Confusion {
+		fmt.Fprintf(w, "%d\t", c)
+		for _, count := range row {
+			fmt.Fprintf(w, "%d\t", count)
+		}
+		fmt.Fprintln(w)
+	}
+	w.Flush()
+	return buf.String()
+}
@@ -0,0 +1,161 @@
+package metrics
+
+import (
+	"fmt"
+	"math"
+	"testing"
+)
+
+func TestEvaluatorKappa(t *testing.T) {
+	tests := []struct {
+		name      string
+		targets   []int
+		predicted []int
+		kappa     float64
+	}{
+		{name: "no examples", kappa: 0},
+		{name: "single class", targets: []int{1, 1, 1}, predicted: []int{1, 1, 1}, kappa: 1},
+		{name: "perfect", targets: []int{0, 1, 2, 1}, predicted: []int{0, 1, 2, 1}, kappa: 1},
+		// observed 0.5, expected (2*2 + 2*2) / 16 = 0.5
+		{name: "chance", targets: []int{0, 0, 1, 1}, predicted: []int{0, 1, 0, 1}, kappa: 0},
+		// observed 0.75, expected (2*3 + 2*1) / 16 = 0.5
+		{name: "partial", targets: []int{0, 0, 1, 1}, predicted: []int{0, 1, 1, 1}, kappa: 0.5},
+	}
+	for _, test := range tests {
+		e := NewEvaluator(3)
+		for i := range test.targets {
+			e.Add(oneHot(test.targets[i], 3), oneHot(test.predicted[i], 3))
+		}
+		if kappa := e.Evaluate().Kappa; math.IsNaN(kappa) || math.Abs(kappa-test.kappa) > 1e-12 {
+			t.Errorf("%s: kappa %g, want %g", test.name, kappa, test.kappa)
+		}
+	}
+}
+
+// evaluate returns the evaluation of the examples with the given classes and scores
+func evaluate(targets []int, scores [][]float64, topK ...int) *Evaluation {
+	e := NewEvaluator(len(scores[0]), topK...)
+	for i, target := range targets {
+		e.Add(oneHot(target, len(scores[i])), scores[i])
+	}
+	return e.Evaluate()
+}
+
+func assertClose(t *testing.T, name string, got, want float64) {
+	t.Helper()
+	if math.IsNaN(got) != math.IsNaN(want) || math.Abs(got-want) > 1e-12 {
+		t.Errorf("%s is %g, want %g", name, got, want)
+	}
+}
+
+func TestEvaluatorMetrics(t *testing.T) {
+	targets := []int{0, 0, 0, 1, 1, 2, 2}
+	scores := [][]float64{
+		{0.7, 0.2, 0.1},   // predicted 0
+		{0.6, 0.3, 0.1},   // predicted 0
+		{0.3, 0.6, 0.1},   // predicted 1, the actual class is second
+		{0.2, 0.5, 0.3},   // predicted 1
+		{0.1, 0.6, 0.3},   // predicted 1
+		{0.05, 0.15, 0.8}, // predicted 2
+		{0.5, 0.4, 0.1},   // predicted 0, the actual class is third
+	}
+	ev := evaluate(targets, scores, 1, 2, 3)
+
+	if want := [][]int{{2, 1, 0}, {0, 2, 0}, {1, 0, 1}}; fmt.Sprint(ev.Confusion) != fmt.Sprint(want) {
+		t.Errorf("confusion matrix %v, want %v", ev.Confusion, want)
+	}
+	if ev.Count != 7 {
+		t.Errorf("count %d, want 7", ev.Count)
+	}
+
+	// Class 0 is predicted 3 times of which 2 are right, class 1 is predicted 3 times and found both times, class 2
+	// is predicted once correctly and missed once.
+	// ROC-AUC is the fraction of positive and negative pairs that are ordered correctly, ties count half:
+	// class 0 orders 11 of 12 pairs, class 1 8.5 of 10 and class 2 6.5 of 10.
+	// PR-AUC is the precision at every positive weighted by the increase in recall: for class 0 (1 + 1 + 3/4) / 3,
+	// class 1 has a positive tied with a negative at precision 1/2 and a positive at 2/3, class 2 has a positive at
+	// precision 1 and one tied with three negatives at precision 2/7.
+	classes := []struct {
+		precision, recall, f1 float64
+		support               int
+		roc, pr               float64
+	}{
+		{precision: 2.0 / 3, recall: 2.0 / 3, f1: 2.0 / 3, support: 3, roc: 11.0 / 12, pr: 11.0 / 12},
+		{precision: 2.0 / 3, recall: 1, f1: 0.8, support: 2, roc: 0.85, pr: 0.5/2 + (2.0/3)/2},
+		{precision: 1, recall: 0.5, f1: 2.0 / 3, support: 2, roc: 0.65, pr: 0.5 + (2.0/7)/2},
+	}
+	for c, want := range classes {
+		m := ev.Classes[c]
+		assertClose(t, fmt.Sprintf("precision of class %d", c), m.Precision, want.precision)
+		assertClose(t, fmt.Sprintf("recall of class %d", c), m.Recall, want.recall)
+		assertClose(t, fmt.Sprintf("F1 of class %d", c), m.F1, want.f1)
+		assertClose(t, fmt.Sprintf("ROC-AUC of class %d", c), m.ROCAUC, want.roc)
+		assertClose(t, fmt.Sprintf("PR-AUC of class %d", c), m.PRAUC, want.pr)
+		if m.Support != want.support {
+			t.Errorf("support of class %d is %d, want %d", c, m.Support, want.support)
+		}
+	}
+
+	assertClose(t, "accuracy", ev.Accuracy, 5.0/7)
+	assertClose(t, "macro precision", ev.MacroPrecision, 7.0/9)
+	assertClose(t, "macro recall", ev.MacroRecall, 13.0/18)
+	assertClose(t, "macro F1", ev.MacroF1, 32.0/45)
+	assertClose(t, "macro ROC-AUC", ev.MacroROCAUC, 29.0/36)
+	// Every example has a single class, so the micro averages equal the accuracy
+	assertClose(t, "micro precision", ev.MicroPrecision, 5.0/7)
+	assertClose(t, "micro recall", ev.MicroRecall, 5.0/7)
+	assertClose(t, "micro F1", ev.MicroF1, 5.0/7)
+
+	// The ranks of the actual classes are 0 for five examples, 1 and 2
+	for k, want := range map[int]float64{1: 5.0 / 7, 2: 6.0 / 7, 3: 1} {
+		assertClose(t, fmt.Sprintf("top-%d accuracy", k), ev.TopK[k], want)
+	}
+}
+
+func TestEvaluatorTopKTies(t *testing.T) {
+	// Classes with the same score as the actual class do not push it down
+	ev := evaluate([]int{2}, [][]float64{{0.4, 0.2, 0.2, 0.2}}, 1, 2)
+	assertClose(t, "top-1 accuracy", ev.TopK[1], 0)
+	assertClose(t, "top-2 accuracy", ev.TopK[2], 1)
+}
+
+func TestEvaluatorROCAUC(t *testing.T) {
+	tests := []struct {
+		name    string
+		targets []int
+		scores  [][]float64
+		roc     []float64
+		macro   float64
+	}{
+		{name: "separated", targets: []int{0, 0, 1, 1}, scores: [][]float64{{0.9, 0.1}, {0.8, 0.2}, {0.3, 0.7}, {0.4, 0.6}},
+			roc: []float64{1, 1}, macro: 1},
+		{name: "reversed", targets: []int{0, 0, 1, 1}, scores: [][]float64{{0.2, 0.9}, {0.3, 0.8}, {0.9, 0.1}, {0.7, 0.2}},
+			roc: []float64{0, 0}, macro: 0},
+		{name: "equal scores", targets: []int{0, 1, 0, 1}, scores: [][]float64{{0.5, 0.5}, {0.5, 0.5}, {0.5, 0.5}, {0.5, 0.5}},
+			roc: []float64{0.5, 0.5}, macro: 0.5},
+		// Class 2 does not occur, its AUC is NaN and left out of the macro average
+		{name: "missing class", targets: []int{0, 1}, scores: [][]float64{{0.6, 0.3, 0.1}, {0.2, 0.7, 0.1}},
+			roc: []float64{1, 1, math.NaN()}, macro: 1},
+		// Every example is of class 0, no class has positive and negative examples
+		{name: "single class", targets: []int{0, 0}, scores: [][]float64{{0.6, 0.4}, {0.3, 0.7}},
+			roc: []float64{math.NaN(), math.NaN()}, macro: math.NaN()},
+	}
+	for _, test := range tests {
+		ev := evaluate(test.targets, test.scores)
+		for c, want := range test.roc {
+			assertClose(t, fmt.Sprintf("%s: ROC-AUC of class %d", test.name, c), ev.Classes[c].ROCAUC, want)
+		}
+		assertClose(t, test.name+": macro ROC-AUC", ev.MacroROCAUC, test.macro)
+	}
+
+	// Without examples every AUC is NaN
+	ev := NewEvaluator(2).Evaluate()
+	assertClose(t, "macro ROC-AUC without examples", ev.MacroROCAUC, math.NaN())
+	assertClose(t, "macro PR-AUC without examples", ev.MacroPRAUC, math.NaN())
+}
+
+func oneHot(class, classes int) []float64 {
+	values := make([]float64, classes)
+	values[class] = 1
+	return values
+}
@@ -1,38 +1,152 @@
 package metrics
 
 import (
+	"bytes"
+	"fmt"
+	"github.com/rubenwo/cnn-go/pkg/cnn/internal/codec"
 	"github.com/rubenwo/cnn-go/pkg/cnn/maths"
 	"math"
 )
 
+// LossFunction computes the loss of every predicted value. The loss of a prediction is the sum of these values,
+// so losses that average over the values divide every value by their count.
 type LossFunction interface {
 	CalculateLoss(target, predicted []float64) maths.Tensor
 	CalculateLossDerivative(target, predicted []float64) maths.Tensor
 }
 
-type CrossEntropyLoss struct{}
+// epsilon bounds probabilities to [epsilon, 1-epsilon] before taking their logarithm or dividing by them
+const epsilon = 1e-7
+
+func clampProbability(p float64) float64 {
+	return math.Min(math.Max(p, epsilon), 1-epsilon)
+}
+
+// clamped reports whether clampProbability changes p. The loss does not change with a clamped prediction, so its
+// derivative is 0.
+func clamped(p float64) bool {
+	return p < epsilon || p > 1-epsilon
+}
+
+// smoothLabels returns target moved towards the uniform distribution over its values by smoothing: every target t
+// becomes t*(1-smoothing) + smoothing/len(target). It returns target itself if smoothing is 0.
+func smoothLabels(target []float64, smoothing float64) []float64 {
+	if smoothing == 0 {
+		return target
+	}
+	if smoothing < 0 || smoothing >= 1 {
+		panic(fmt.Sprintf("label smoothing %g is not in [0, 1)", smoothing))
+	}
+	smoothed := make([]float64, len(target))
+	for i, t := range target {
+		smoothed[i] = t*(1-smoothing) + smoothing/float64(len(target))
+	}
+	return smoothed
+}
+
+// marshalSmoothing and unmarshalSmoothing persist the configuration of losses that only have label smoothing
+func marshalSmoothing(smoothing float64) ([]byte, error) {
+	var buf bytes.Buffer
+	w := codec.NewWriter(&buf)
+	w.Float(smoothing)
+	return buf.Bytes(), w.Err()
+}
+
+func unmarshalSmoothing(data []byte) (float64, error) {
+	r := codec.NewReader(bytes.NewReader(data))
+	smoothing := r.Float()
+	return smoothing, r.Err()
+}
+
+// CrossEntropyLoss is the binary cross entropy of every predicted probability: -(t*log(p) + (1-t)*log(1-p)).
+// Predictions are clamped to [1e-7, 1-1e-7] so saturated predictions do not take log(0), the derivative of a
+// clamped prediction is 0.
+type CrossEntropyLoss struct {
+	// LabelSmoothing moves the targets towards the uniform distribution, see smoothLabels
+	LabelSmoothing float64
+}
 
 func (c *CrossEntropyLoss) CalculateLoss(target, predicted []float64) maths.Tensor {
+	target = smoothLabels(target, c.LabelSmoothing)
 	lossValues := make([]float64, len(target))
 	for i := 0; i < len(lossValues); i++ {
-		if target[i] == 1 {
-			lossValues[i] = -1.0 * math.Log(predicted[i])
-		} else {
-			lossValues[i] = -1.0 * math.Log(1-predicted[i])
-		}
+		p := clampProbability(predicted[i])
+		lossValues[i] = -(target[i]*math.Log(p) + (1-target[i])*math.Log(1-p))
 	}
 	return *maths.NewTensor([]int{len(lossValues)}, lossValues)
 }
 
 func (c *CrossEntropyLoss) CalculateLossDerivative(target, predicted []float64) maths.Tensor {
+	target = smoothLabels(target, c.LabelSmoothing)
 	lossDerivatives := make([]float64, len(target))
 
 	for i := 0; i < len(lossDerivatives); i++ {
-		if target[i] == 1 {
-			lossDerivatives[i] = -1.0 / predicted[i]
-		} else {
-			lossDerivatives[i] = 1.0 / (1 - predicted[i])
+		if p := predicted[i]; !clamped(p) {
+			lossDerivatives[i] = -target[i]/p + (1-target[i])/(1-p)
 		}
 	}
 	return *maths.NewTensor([]int{len(lossDerivatives)}, lossDerivatives)
 }
+
+func (c *CrossEntropyLoss) MarshalBinary() ([]byte, error) {
+	return marshalSmoothing(c.LabelSmoothing)
+}
+
+func (c *CrossEntropyLoss) UnmarshalBinary(data []byte) (err error) {
+	c.LabelSmoothing, err = unmarshalSmoothing(data)
+	return err
+}
+
+// SoftmaxCrossEntropyLoss is the cross entropy of the softmax of predicted, which are logits: the network should not
+// end with a softmax layer. Computing both at once uses log-sum-exp, so large logits do not overflow and
+// saturated predictions do not take log(0), and the derivative is softmax(predicted) - target for targets that sum
+// to 1.
+type SoftmaxCrossEntropyLoss struct {
+	// LabelSmoothing moves the targets towards the uniform distribution, see smoothLabels
+	LabelSmoothing float64
+}
+
+func (c *SoftmaxCrossEntropyLoss) CalculateLoss(target, predicted []float64) maths.Tensor {
+	target = smoothLabels(target, c.LabelSmoothing)
+	logSumExp := logSumExp(predicted)
+	lossValues := make([]float64, len(target))
+	for i := 0; i < len(lossValues); i++ {
+		if target[i] != 0 {
+			lossValues[i] = target[i] * (logSumExp - predicted[i])
+		}
+	}
+	return *maths.NewTensor([]int{len(lossValues)}, lossValues)
+}
+
+func (c *SoftmaxCrossEntropyLoss) CalculateLossDerivative(target, predicted []float64) maths.Tensor {
+	target = smoothLabels(target, c.LabelSmoothing)
+	logSumExp := logSumExp(predicted)
+	targetSum := maths.SumFloat64Slice(target)
+	lossDerivatives := make([]float64, len(target))
+	for i := 0; i < len(lossDerivatives); i++ {
+		lossDerivatives[i] = math.Exp(predicted[i]-logSumExp)*targetSum - target[i]
+	}
+	return *maths.NewTensor([]int{len(lossDerivatives)}, lossDerivatives)
+}
+
+func (c *SoftmaxCrossEntropyLoss) MarshalBinary() ([]byte, error) {
+	return marshalSmoothing(c.LabelSmoothing)
+}
+
+func (c *SoftmaxCrossEntropyLoss) UnmarshalBinary(data []byte) (err error) {
+	c.LabelSmoothing, err = unmarshalSmoothing(data)
+	return err
+}
+
+// logSumExp returns log(sum(exp(x))) of the values x, subtracting the largest value first so it does not overflow
+func logSumExp(values []float64) float64 {
+	max := maths.FindMaxValueFloat64Slice(values)
+	if math.IsInf(max, 0) {
+		return max
+	}
+	sum := 0.0
+	for _, v := range values {
+		sum += math.Exp(v - max)
+	}
+	return max + math.Log(sum)
+}
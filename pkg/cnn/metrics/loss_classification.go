@@ -0,0 +1,213 @@
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/rubenwo/cnn-go/pkg/cnn/internal/codec"
+	"github.com/rubenwo/cnn-go/pkg/cnn/maths"
+	"math"
+)
+
+// BinaryCrossEntropyWithLogitsLoss is the binary cross entropy of the sigmoid of every predicted value, which are
+// logits: every output is an independent yes/no prediction. The loss is computed as max(x, 0) - x*t + log(1 + e^-|x|),
+// which does not overflow for large logits, and its derivative is maths.Sigmoid(x) - t.
+type BinaryCrossEntropyWithLogitsLoss struct {
+	// LabelSmoothing moves every target towards 0.5: t becomes t*(1-LabelSmoothing) + LabelSmoothing/2
+	LabelSmoothing float64
+}
+
+func (b *BinaryCrossEntropyWithLogitsLoss) targets(target []float64) []float64 {
+	if b.LabelSmoothing == 0 {
+		return target
+	}
+	// Every value is a distribution over 2 classes
+	smoothed := make([]float64, len(target))
+	for i, t := range target {
+		smoothed[i] = smoothLabels([]float64{t, 1 - t}, b.LabelSmoothing)[0]
+	}
+	return smoothed
+}
+
+func (b *BinaryCrossEntropyWithLogitsLoss) CalculateLoss(target, predicted []float64) maths.Tensor {
+	target = b.targets(target)
+	lossValues := make([]float64, len(target))
+	for i := 0; i < len(lossValues); i++ {
+		x := predicted[i]
+		lossValues[i] = math.Max(x, 0) - x*target[i] + math.Log1p(math.Exp(-math.Abs(x)))
+	}
+	return *maths.NewTensor([]int{len(lossValues)}, lossValues)
+}
+
+func (b *BinaryCrossEntropyWithLogitsLoss) CalculateLossDerivative(target, predicted []float64) maths.Tensor {
+	target = b.targets(target)
+	lossDerivatives := make([]float64, len(target))
+	for i := 0; i < len(lossDerivatives); i++ {
+		lossDerivatives[i] = maths.Sigmoid(predicted[i]) - target[i]
+	}
+	return *maths.NewTensor([]int{len(lossDerivatives)}, lossDerivatives)
+}
+
+func (b *BinaryCrossEntropyWithLogitsLoss) MarshalBinary() ([]byte, error) {
+	return marshalSmoothing(b.LabelSmoothing)
+}
+
+func (b *BinaryCrossEntropyWithLogitsLoss) UnmarshalBinary(data []byte) (err error) {
+	b.LabelSmoothing, err = unmarshalSmoothing(data)
+	return err
+}
+
+// hingeTarget maps a target to the -1 or 1 the hinge losses expect: targets <= 0 are the negative class
+func hingeTarget(t float64) float64 {
+	if t <= 0 {
+		return -1
+	}
+	return 1
+}
+
+// HingeLoss is the mean of max(0, 1 - t*x) over the predicted values x. The targets t are 1 for the positive class
+// and -1 or 0 for the negative class.
+type HingeLoss struct{}
+
+func (h *HingeLoss) CalculateLoss(target, predicted []float64) maths.Tensor {
+	n := float64(len(target))
+	lossValues := make([]float64, len(target))
+	for i := 0; i < len(lossValues); i++ {
+		lossValues[i] = math.Max(0, 1-hingeTarget(target[i])*predicted[i]) / n
+	}
+	return *maths.NewTensor([]int{len(lossValues)}, lossValues)
+}
+
+func (h *HingeLoss) CalculateLossDerivative(target, predicted []float64) maths.Tensor {
+	n := float64(len(target))
+	lossDerivatives := make([]float64, len(target))
+	for i := 0; i < len(lossDerivatives); i++ {
+		t := hingeTarget(target[i])
+		if 1-t*predicted[i] > 0 {
+			lossDerivatives[i] = -t / n
+		}
+	}
+	return *maths.NewTensor([]int{len(lossDerivatives)}, lossDerivatives)
+}
+
+// SquaredHingeLoss is the mean of max(0, 1 - t*x)^2, with targets like HingeLoss.
+type SquaredHingeLoss struct{}
+
+func (h *SquaredHingeLoss) CalculateLoss(target, predicted []float64) maths.Tensor {
+	n := float64(len(target))
+	lossValues := make([]float64, len(target))
+	for i := 0; i < len(lossValues); i++ {
+		margin := math.Max(0, 1-hingeTarget(target[i])*predicted[i])
+		lossValues[i] = margin * margin / n
+	}
+	return *maths.NewTensor([]int{len(lossValues)}, lossValues)
+}
+
+func (h *SquaredHingeLoss) CalculateLossDerivative(target, predicted []float64) maths.Tensor {
+	n := float64(len(target))
+	lossDerivatives := make([]float64, len(target))
+	for i := 0; i < len(lossDerivatives); i++ {
+		t := hingeTarget(target[i])
+		margin := math.Max(0, 1-t*predicted[i])
+		lossDerivatives[i] = -2 * t * margin / n
+	}
+	return *maths.NewTensor([]int{len(lossDerivatives)}, lossDerivatives)
+}
+
+// KLDivergenceLoss is the Kullback-Leibler divergence t*log(t/p) of the predicted distribution p from the target
+// distribution t. Predictions are clamped like in CrossEntropyLoss, targets of 0 do not contribute.
+type KLDivergenceLoss struct{}
+
+func (k *KLDivergenceLoss) CalculateLoss(target, predicted []float64) maths.Tensor {
+	lossValues := make([]float64, len(target))
+	for i := 0; i < len(lossValues); i++ {
+		if target[i] > 0 {
+			lossValues[i] = target[i] * math.Log(target[i]/clampProbability(predicted[i]))
+		}
+	}
+	return *maths.NewTensor([]int{len(lossValues)}, lossValues)
+}
+
+func (k *KLDivergenceLoss) CalculateLossDerivative(target, predicted []float64) maths.Tensor {
+	lossDerivatives := make([]float64, len(target))
+	for i := 0; i < len(lossDerivatives); i++ {
+		if target[i] > 0 && !clamped(predicted[i]) {
+			lossDerivatives[i] = -target[i] / predicted[i]
+		}
+	}
+	return *maths.NewTensor([]int{len(lossDerivatives)}, lossDerivatives)
+}
+
+// FocalLoss is the cross entropy -w*t*(1-p)^Gamma*log(p) of predicted probabilities p, typically the output of a
+// softmax layer. The factor (1-p)^Gamma reduces the loss of examples that are already classified well, so training
+// focuses on the hard ones, and the class weights w counter class imbalance.
+type FocalLoss struct {
+	// Gamma is the focusing parameter, commonly 2. With 0 the loss is the weighted cross entropy.
+	Gamma float64
+	// Weights holds the weight of every class, all classes have weight 1 if it is nil
+	Weights []float64
+	// LabelSmoothing moves the targets towards the uniform distribution, see smoothLabels
+	LabelSmoothing float64
+}
+
+func (f *FocalLoss) weight(i, classes int) float64 {
+	if f.Weights == nil {
+		return 1
+	}
+	if len(f.Weights) != classes {
+		panic(fmt.Sprintf("focal loss has %d class weights for %d classes", len(f.Weights), classes))
+	}
+	return f.Weights[i]
+}
+
+func (f *FocalLoss) CalculateLoss(target, predicted []float64) maths.Tensor {
+	target = smoothLabels(target, f.LabelSmoothing)
+	lossValues := make([]float64, len(target))
+	for i := 0; i < len(lossValues); i++ {
+		if target[i] != 0 {
+			p := clampProbability(predicted[i])
+			lossValues[i] = -f.weight(i, len(target)) * target[i] * math.Pow(1-p, f.Gamma) * math.Log(p)
+		}
+	}
+	return *maths.NewTensor([]int{len(lossValues)}, lossValues)
+}
+
+func (f *FocalLoss) CalculateLossDerivative(target, predicted []float64) maths.Tensor {
+	target = smoothLabels(target, f.LabelSmoothing)
+	lossDerivatives := make([]float64, len(target))
+	for i := 0; i < len(lossDerivatives); i++ {
+		if p := predicted[i]; target[i] != 0 && !clamped(p) {
+			// d/dp -(1-p)^g * log(p) = g*(1-p)^(g-1)*log(p) - (1-p)^g/p
+			focus := math.Pow(1-p, f.Gamma)
+			derivative := -focus / p
+			if f.Gamma != 0 {
+				derivative += f.Gamma * math.Pow(1-p, f.Gamma-1) * math.Log(p)
+			}
+			lossDerivatives[i] = f.weight(i, len(target)) * target[i] * derivative
+		}
+	}
+	return *maths.NewTensor([]int{len(lossDerivatives)}, lossDerivatives)
+}
+
+func (f *FocalLoss) MarshalBinary() ([]byte, error) {
+	var buf bytes.Buffer
+	w := codec.NewWriter(&buf)
+	w.Float(f.Gamma)
+	w.Bool(f.Weights != nil)
+	w.Floats(f.Weights)
+	w.Float(f.LabelSmoothing)
+	return buf.Bytes(), w.Err()
+}
+
+func (f *FocalLoss) UnmarshalBinary(data []byte) error {
+	r := codec.NewReader(bytes.NewReader(data))
+	f.Gamma = r.Float()
+	hasWeights := r.Bool()
+	weights := r.Floats()
+	f.LabelSmoothing = r.Float()
+	if hasWeights {
+		f.Weights = weights
+	} else {
+		f.Weights = nil
+	}
+	return r.Err()
+}
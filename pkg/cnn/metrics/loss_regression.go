@@ -0,0 +1,114 @@
+package metrics
+
+import (
+	"bytes"
+	"github.com/rubenwo/cnn-go/pkg/cnn/internal/codec"
+	"github.com/rubenwo/cnn-go/pkg/cnn/maths"
+	"math"
+)
+
+// The regression losses average over the predicted values, so the loss does not grow with the size of the output.
+
+// MeanSquaredErrorLoss is the mean of (p-t)^2.
+type MeanSquaredErrorLoss struct{}
+
+func (m *MeanSquaredErrorLoss) CalculateLoss(target, predicted []float64) maths.Tensor {
+	n := float64(len(target))
+	lossValues := make([]float64, len(target))
+	for i := 0; i < len(lossValues); i++ {
+		d := predicted[i] - target[i]
+		lossValues[i] = d * d / n
+	}
+	return *maths.NewTensor([]int{len(lossValues)}, lossValues)
+}
+
+func (m *MeanSquaredErrorLoss) CalculateLossDerivative(target, predicted []float64) maths.Tensor {
+	n := float64(len(target))
+	lossDerivatives := make([]float64, len(target))
+	for i := 0; i < len(lossDerivatives); i++ {
+		lossDerivatives[i] = 2 * (predicted[i] - target[i]) / n
+	}
+	return *maths.NewTensor([]int{len(lossDerivatives)}, lossDerivatives)
+}
+
+// MeanAbsoluteErrorLoss is the mean of |p-t|. Its derivative where p equals t is 0.
+type MeanAbsoluteErrorLoss struct{}
+
+func (m *MeanAbsoluteErrorLoss) CalculateLoss(target, predicted []float64) maths.Tensor {
+	n := float64(len(target))
+	lossValues := make([]float64, len(target))
+	for i := 0; i < len(lossValues); i++ {
+		lossValues[i] = math.Abs(predicted[i]-target[i]) / n
+	}
+	return *maths.NewTensor([]int{len(lossValues)}, lossValues)
+}
+
+func (m *MeanAbsoluteErrorLoss) CalculateLossDerivative(target, predicted []float64) maths.Tensor {
+	n := float64(len(target))
+	lossDerivatives := make([]float64, len(target))
+	for i := 0; i < len(lossDerivatives); i++ {
+		lossDerivatives[i] = sign(predicted[i]-target[i]) / n
+	}
+	return *maths.NewTensor([]int{len(lossDerivatives)}, lossDerivatives)
+}
+
+// HuberLoss is the mean of 0.5*(p-t)^2 where |p-t| <= Delta and Delta*(|p-t| - 0.5*Delta) elsewhere: squared
+// error for small errors, absolute error for outliers.
+type HuberLoss struct {
+	// Delta is the error from which the loss grows linearly, 1 if it is 0
+	Delta float64
+}
+
+func (h *HuberLoss) delta() float64 {
+	if h.Delta == 0 {
+		return 1
+	}
+	return h.Delta
+}
+
+func (h *HuberLoss) CalculateLoss(target, predicted []float64) maths.Tensor {
+	n, delta := float64(len(target)), h.delta()
+	lossValues := make([]float64, len(target))
+	for i := 0; i < len(lossValues); i++ {
+		d := math.Abs(predicted[i] - target[i])
+		if d <= delta {
+			lossValues[i] = 0.5 * d * d / n
+		} else {
+			lossValues[i] = delta * (d - 0.5*delta) / n
+		}
+	}
+	return *maths.NewTensor([]int{len(lossValues)}, lossValues)
+}
+
+func (h *HuberLoss) CalculateLossDerivative(target, predicted []float64) maths.Tensor {
+	n, delta := float64(len(target)), h.delta()
+	lossDerivatives := make([]float64, len(target))
+	for i := 0; i < len(lossDerivatives); i++ {
+		d := predicted[i] - target[i]
+		lossDerivatives[i] = math.Max(-delta, math.Min(d, delta)) / n
+	}
+	return *maths.NewTensor([]int{len(lossDerivatives)}, lossDerivatives)
+}
+
+func (h *HuberLoss) MarshalBinary() ([]byte, error) {
+	var buf bytes.Buffer
+	w := codec.NewWriter(&buf)
+	w.Float(h.Delta)
+	return buf.Bytes(), w.Err()
+}
+
+func (h *HuberLoss) UnmarshalBinary(data []byte) error {
+	r := codec.NewReader(bytes.NewReader(data))
+	h.Delta = r.Float()
+	return r.Err()
+}
+
+func sign(v float64) float64 {
+	switch {
+	case v > 0:
+		return 1
+	case v < 0:
+		return -1
+	}
+	return 0
+}
@@ -0,0 +1,76 @@
+package metrics_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/rubenwo/cnn-go/pkg/cnn/gradcheck"
+	"github.com/rubenwo/cnn-go/pkg/cnn/metrics"
+)
+
+type lossTest struct {
+	loss              metrics.LossFunction
+	target, predicted []float64
+}
+
+func checkLosses(t *testing.T, tests []lossTest, config gradcheck.Config) {
+	t.Helper()
+	for _, test := range tests {
+		t.Run(fmt.Sprintf("%T %v", test.loss, test.predicted), func(t *testing.T) {
+			gradcheck.Loss(test.loss, test.target, test.predicted, config).Check(t)
+		})
+	}
+}
+
+func TestLossGradients(t *testing.T) {
+	probabilities := []float64{0.2, 0.7, 0.1}
+	oneHot := []float64{0, 1, 0}
+	logits := []float64{-1.5, 2, 0.3}
+	weights := []float64{0.5, 2, 1}
+
+	// The predictions avoid the kinks of the losses: MAE where p equals t, Huber where |p-t| is Delta and the hinge
+	// losses where t*p is 1
+	checkLosses(t, []lossTest{
+		{loss: &metrics.CrossEntropyLoss{}, target: oneHot, predicted: probabilities},
+		{loss: &metrics.CrossEntropyLoss{}, target: []float64{0.3, 0.7}, predicted: []float64{0.9, 0.05}},
+		{loss: &metrics.CrossEntropyLoss{LabelSmoothing: 0.1}, target: oneHot, predicted: probabilities},
+		{loss: &metrics.SoftmaxCrossEntropyLoss{}, target: oneHot, predicted: logits},
+		{loss: &metrics.SoftmaxCrossEntropyLoss{LabelSmoothing: 0.2}, target: oneHot, predicted: logits},
+		{loss: &metrics.BinaryCrossEntropyWithLogitsLoss{}, target: []float64{1, 0, 1}, predicted: logits},
+		{loss: &metrics.BinaryCrossEntropyWithLogitsLoss{LabelSmoothing: 0.1}, target: []float64{1, 0, 1}, predicted: logits},
+		{loss: &metrics.HingeLoss{}, target: []float64{1, -1, 0}, predicted: []float64{0.4, 0.2, -1.5}},
+		{loss: &metrics.SquaredHingeLoss{}, target: []float64{1, -1, 0}, predicted: []float64{0.4, 0.2, -1.5}},
+		{loss: &metrics.KLDivergenceLoss{}, target: []float64{0.5, 0.5, 0}, predicted: probabilities},
+		{loss: &metrics.FocalLoss{Gamma: 2}, target: oneHot, predicted: probabilities},
+		{loss: &metrics.FocalLoss{Gamma: 2, Weights: weights}, target: []float64{0.2, 0.8, 0}, predicted: probabilities},
+		{loss: &metrics.FocalLoss{Gamma: 0.5, Weights: weights, LabelSmoothing: 0.1}, target: oneHot, predicted: probabilities},
+		{loss: &metrics.MeanSquaredErrorLoss{}, target: []float64{1, -2, 0.5}, predicted: logits},
+		{loss: &metrics.MeanAbsoluteErrorLoss{}, target: []float64{1, -2, 0.5}, predicted: logits},
+		{loss: &metrics.HuberLoss{}, target: []float64{1, -2, 0.5}, predicted: logits},
+		{loss: &metrics.HuberLoss{Delta: 0.5}, target: []float64{1, -2, 0.5}, predicted: logits},
+	}, gradcheck.DefaultConfig)
+}
+
+func TestSaturatedLossGradients(t *testing.T) {
+	saturated := []float64{0, 1, 0.5}
+	target := []float64{1, 0, 0.5}
+	logits := []float64{1e3, -1e3, 1e3}
+
+	// The probabilities are clamped to [1e-7, 1-1e-7], the finite differences of saturated predictions must not
+	// cross the bounds
+	config := gradcheck.DefaultConfig
+	config.Epsilon = 1e-9
+	checkLosses(t, []lossTest{
+		{loss: &metrics.CrossEntropyLoss{}, target: target, predicted: saturated},
+		{loss: &metrics.CrossEntropyLoss{LabelSmoothing: 0.1}, target: target, predicted: saturated},
+		{loss: &metrics.KLDivergenceLoss{}, target: []float64{0.5, 0.5, 0}, predicted: saturated},
+		{loss: &metrics.FocalLoss{Gamma: 2, Weights: []float64{2, 1, 0.5}}, target: []float64{0.5, 0.5, 0}, predicted: saturated},
+	}, config)
+
+	checkLosses(t, []lossTest{
+		{loss: &metrics.SoftmaxCrossEntropyLoss{}, target: []float64{0, 1, 0}, predicted: logits},
+		{loss: &metrics.SoftmaxCrossEntropyLoss{LabelSmoothing: 0.1}, target: []float64{1, 0, 0}, predicted: logits},
+		{loss: &metrics.BinaryCrossEntropyWithLogitsLoss{}, target: []float64{1, 1, 0}, predicted: logits},
+		{loss: &metrics.BinaryCrossEntropyWithLogitsLoss{LabelSmoothing: 0.1}, target: []float64{1, 1, 0}, predicted: logits},
+	}, gradcheck.DefaultConfig)
+}
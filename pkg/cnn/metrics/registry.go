@@ -0,0 +1,58 @@
+package metrics
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// registry maps the name of every loss function that can be saved to a function returning an empty instance of it.
+// Loss functions with configuration implement encoding.BinaryMarshaler and encoding.BinaryUnmarshaler to persist it.
+var registry = map[string]func() LossFunction{}
+
+// names is the reverse of registry
+var names = map[reflect.Type]string{}
+
+func init() {
+	Register("cross_entropy", func() LossFunction { return &CrossEntropyLoss{} })
+	Register("softmax_cross_entropy", func() LossFunction { return &SoftmaxCrossEntropyLoss{} })
+	Register("mean_squared_error", func() LossFunction { return &MeanSquaredErrorLoss{} })
+	Register("mean_absolute_error", func() LossFunction { return &MeanAbsoluteErrorLoss{} })
+	Register("huber", func() LossFunction { return &HuberLoss{} })
+	Register("binary_cross_entropy_with_logits", func() LossFunction { return &BinaryCrossEntropyWithLogitsLoss{} })
+	Register("hinge", func() LossFunction { return &HingeLoss{} })
+	Register("squared_hinge", func() LossFunction { return &SquaredHingeLoss{} })
+	Register("kl_divergence", func() LossFunction { return &KLDivergenceLoss{} })
+	Register("focal", func() LossFunction { return &FocalLoss{} })
+}
+
+// Register makes a loss function available to the model format under name.
+// Register panics if name or the type of the loss function is already registered.
+func Register(name string, factory func() LossFunction) {
+	if _, ok := registry[name]; ok {
+		panic(fmt.Sprintf("metrics: %q is already registered", name))
+	}
+	t := reflect.TypeOf(factory())
+	if _, ok := names[t]; ok {
+		panic(fmt.Sprintf("metrics: %s is already registered", t))
+	}
+	registry[name] = factory
+	names[t] = name
+}
+
+// Name returns the name the type of loss has been registered with.
+func Name(loss LossFunction) (string, error) {
+	name, ok := names[reflect.TypeOf(loss)]
+	if !ok {
+		return "", fmt.Errorf("metrics: %T is not registered", loss)
+	}
+	return name, nil
+}
+
+// New returns an empty loss function of the type registered as name.
+func New(name string) (LossFunction, error) {
+	factory, ok := registry[name]
+	if !ok {
+		return nil, fmt.Errorf("metrics: unknown loss function %q", name)
+	}
+	return factory(), nil
+}
@@ -0,0 +1,230 @@
+package cnn
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math/rand"
+
+	"github.com/rubenwo/cnn-go/pkg/cnn/internal/codec"
+	"github.com/rubenwo/cnn-go/pkg/cnn/layer"
+	"github.com/rubenwo/cnn-go/pkg/cnn/metrics"
+)
+
+// The model format is:
+//
+//	magic      4 bytes, "CNNM"
+//	version    uint32, little endian
+//	length     uint64, little endian, length of the payload
+//	payload    see Network.marshal
+//	checksum   uint32, little endian, CRC-32 (IEEE) of the payload
+//
+// Version 1 payloads do not record the seed of the network, and store convolution layers without their strides,
+// padding, dilation and biases.
+const (
+	modelMagic   = "CNNM"
+	modelVersion = 2
+)
+
+var (
+	ErrInvalidFormat = errors.New("cnn: not a cnn-go file")
+	ErrChecksum      = errors.New("cnn: checksum mismatch, the file is corrupt")
+)
+
+// Save writes the network to w: its input dimensions, the type, configuration and weights of every layer, the
+// loss function and the seed of the network. The optimizer and scheduler are not part of the model.
+func (n *Network) Save(w io.Writer) error {
+	var payload bytes.Buffer
+	if err := n.marshal(codec.NewWriter(&payload)); err != nil {
+		return err
+	}
+	return writeEnvelope(w, modelMagic, modelVersion, payload.Bytes())
+}
+
+// Load reads a network written by Network.Save. Its random number generator starts again from the recorded seed.
+// The returned network has no optimizer, use SetOptimizer before training it any further.
+func Load(r io.Reader) (*Network, error) {
+	version, payload, err := readEnvelope(r, modelMagic, modelVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	n := &Network{}
+	n.seed(rand.Int63())
+	if err := n.unmarshal(payload, version); err != nil {
+		return nil, err
+	}
+	return n, nil
+}
+
+// SetOptimizer replaces the optimizer of the network. The state of the previous optimizer is discarded.
+func (n *Network) SetOptimizer(optimizer Optimizer) {
+	n.optimizer = optimizer
+}
+
+func (n *Network) marshal(w *codec.Writer) error {
+	w.Ints(n.inputDims)
+
+	lossName, err := metrics.Name(n.loss)
+	if err != nil {
+		return err
+	}
+	lossData, err := marshalOptional(n.loss)
+	if err != nil {
+		return err
+	}
+	w.String(lossName)
+	w.Bytes(lossData)
+
+	w.Int(len(n.layers))
+	for _, l := range n.layers {
+		name, err := layer.Name(l)
+		if err != nil {
+			return err
+		}
+		m, ok := l.(encoding.BinaryMarshaler)
+		if !ok {
+			return fmt.Errorf("cnn: layer %T can not be saved", l)
+		}
+		data, err := m.MarshalBinary()
+		if err != nil {
+			return fmt.Errorf("cnn: saving %s layer: %w", name, err)
+		}
+		w.String(name)
+		w.Bytes(data)
+	}
+
+	w.Bool(n.hasSeed)
+	w.Uint64(uint64(n.seedValue))
+	return w.Err()
+}
+
+// unmarshal reads a payload written by marshal in the given version of the model format
+func (n *Network) unmarshal(data []byte, version uint32) error {
+	r := codec.NewReader(bytes.NewReader(data))
+	n.inputDims = r.Ints()
+
+	lossName := r.String()
+	lossData := r.Bytes()
+	if err := r.Err(); err != nil {
+		return err
+	}
+	loss, err := metrics.New(lossName)
+	if err != nil {
+		return err
+	}
+	if err := unmarshalOptional(loss, lossData); err != nil {
+		return err
+	}
+	n.loss = loss
+
+	count := r.Int()
+	n.layers = make([]layer.Layer, 0, count)
+	for i := 0; i < count; i++ {
+		name := r.String()
+		data := r.Bytes()
+		if err := r.Err(); err != nil {
+			return err
+		}
+		l, err := layer.New(name)
+		if err != nil {
+			return err
+		}
+		if err := unmarshalLayer(l, data, version); err != nil {
+			return fmt.Errorf("cnn: loading %s layer: %w", name, err)
+		}
+		n.layers = append(n.layers, l)
+	}
+	if err := r.Err(); err != nil {
+		return err
+	}
+
+	if version < 2 {
+		return nil
+	}
+	hasSeed := r.Bool()
+	seed := int64(r.Uint64())
+	if err := r.Err(); err != nil {
+		return err
+	}
+	if hasSeed {
+		n.seed(seed)
+	}
+	return nil
+}
+
+// unmarshalLayer decodes data written in the given version of the model format into l
+func unmarshalLayer(l layer.Layer, data []byte, version uint32) error {
+	if u, ok := l.(layer.VersionedUnmarshaler); ok {
+		return u.UnmarshalBinaryVersion(data, version)
+	}
+	u, ok := l.(encoding.BinaryUnmarshaler)
+	if !ok {
+		return fmt.Errorf("layer %T can not be loaded", l)
+	}
+	return u.UnmarshalBinary(data)
+}
+
+// marshalOptional marshals v if it implements encoding.BinaryMarshaler, it returns nil otherwise
+func marshalOptional(v interface{}) ([]byte, error) {
+	if m, ok := v.(encoding.BinaryMarshaler); ok {
+		return m.MarshalBinary()
+	}
+	return nil, nil
+}
+
+// unmarshalOptional unmarshals data into v if v implements encoding.BinaryUnmarshaler and data is not empty
+func unmarshalOptional(v interface{}, data []byte) error {
+	if len(data) == 0 {
+		return nil
+	}
+	if u, ok := v.(encoding.BinaryUnmarshaler); ok {
+		return u.UnmarshalBinary(data)
+	}
+	return nil
+}
+
+func writeEnvelope(w io.Writer, magic string, version uint32, payload []byte) error {
+	header := make([]byte, len(magic)+12)
+	copy(header, magic)
+	binary.LittleEndian.PutUint32(header[len(magic):], version)
+	binary.LittleEndian.PutUint64(header[len(magic)+4:], uint64(len(payload)))
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	if _, err := w.Write(payload); err != nil {
+		return err
+	}
+	return binary.Write(w, binary.LittleEndian, crc32.ChecksumIEEE(payload))
+}
+
+// readEnvelope reads and verifies a file written by writeEnvelope. Files with a version newer than maxVersion
+// are rejected.
+func readEnvelope(r io.Reader, magic string, maxVersion uint32) (version uint32, payload []byte, err error) {
+	header := make([]byte, len(magic)+12)
+	if _, err := io.ReadFull(r, header); err != nil || string(header[:len(magic)]) != magic {
+		return 0, nil, ErrInvalidFormat
+	}
+	version = binary.LittleEndian.Uint32(header[len(magic):])
+	if version == 0 || version > maxVersion {
+		return 0, nil, fmt.Errorf("cnn: unsupported format version %d", version)
+	}
+	length := binary.LittleEndian.Uint64(header[len(magic)+4:])
+
+	var buf bytes.Buffer
+	if _, err := io.CopyN(&buf, r, int64(length)); err != nil {
+		return 0, nil, fmt.Errorf("cnn: reading payload: %w", err)
+	}
+	var checksum uint32
+	if err := binary.Read(r, binary.LittleEndian, &checksum); err != nil {
+		return 0, nil, fmt.Errorf("cnn: reading checksum: %w", err)
+	}
+	if checksum != crc32.ChecksumIEEE(buf.Bytes()) {
+		return 0, nil, ErrChecksum
+	}
+	return version, buf.Bytes(), nil
+}
@@ -0,0 +1,210 @@
+package cnn
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/rubenwo/cnn-go/pkg/cnn/internal/codec"
+	"github.com/rubenwo/cnn-go/pkg/cnn/layer"
+	"github.com/rubenwo/cnn-go/pkg/cnn/maths"
+	"github.com/rubenwo/cnn-go/pkg/cnn/metrics"
+)
+
+// saveAndLoad saves n and loads it again
+func saveAndLoad(t *testing.T, n *Network) *Network {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := n.Save(&buf); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := Load(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return loaded
+}
+
+// assertSamePredictions fails if the predictions of got and want for inputs are not identical
+func assertSamePredictions(t *testing.T, got, want *Network, inputs []maths.Tensor) {
+	t.Helper()
+	gotPredictions, wantPredictions := got.PredictBatch(inputs), want.PredictBatch(inputs)
+	for i := range wantPredictions {
+		for j := range wantPredictions[i] {
+			if gotPredictions[i][j] != wantPredictions[i][j] {
+				t.Fatalf("input %d: prediction %v, want %v", i, gotPredictions[i], wantPredictions[i])
+			}
+		}
+	}
+}
+
+func TestSaveAndLoadEveryLayer(t *testing.T) {
+	n := New([]int{8, 8}, NewSGD(0.1), &metrics.CrossEntropyLoss{}, WithSeed(1))
+	n.AddConvolutionLayer([]int{3, 3}, 4, layer.WithBias(), layer.WithPadding(1, 0), layer.WithStrides(1, 2)).
+		AddBatchNormLayer(layer.WithMomentum(0.5)).AddPReLULayer().AddMaxPoolingLayer(2, []int{2, 2, 1}).
+		AddSpatialDropoutLayer(0.2).AddLayerNormLayer(layer.WithEpsilon(1e-3)).AddFullyConnectedLayer(12).
+		AddSigmoidLayer().AddTanhLayer().AddLeakyReLULayer(0.1).AddELULayer(0.5).AddSELULayer().AddGELULayer().
+		AddSwishLayer().AddSoftplusLayer().AddHardSigmoidLayer().AddDropoutLayer(0.3).AddReLULayer().
+		AddFullyConnectedLayer(4).AddLogSoftmaxLayer().AddSoftmaxLayer()
+
+	// Every registered layer is part of the network
+	names := map[string]bool{}
+	for _, l := range n.layers {
+		name, err := layer.Name(l)
+		if err != nil {
+			t.Fatal(err)
+		}
+		names[name] = true
+	}
+	for _, name := range []string{"convolution", "fully_connected", "max_pooling", "relu", "softmax", "dropout",
+		"spatial_dropout", "batch_norm", "layer_norm", "sigmoid", "tanh", "leaky_relu", "elu", "selu", "gelu",
+		"swish", "softplus", "hard_sigmoid", "log_softmax", "prelu"} {
+		if !names[name] {
+			t.Errorf("the network has no %s layer", name)
+		}
+	}
+
+	// Training changes the weights, the slopes of PReLU and the statistics of batch normalization
+	inputs, labels := testData(16)
+	if _, err := n.Fit(context.Background(), inputs, labels, nil, nil, 1, 4, 0); err != nil {
+		t.Fatal(err)
+	}
+	loaded := saveAndLoad(t, n)
+	if !reflect.DeepEqual(loaded.inputDims, n.inputDims) || len(loaded.layers) != len(n.layers) {
+		t.Fatalf("loaded input dimensions %v and %d layers, want %v and %d", loaded.inputDims, len(loaded.layers),
+			n.inputDims, len(n.layers))
+	}
+	assertSamePredictions(t, loaded, n, inputs)
+}
+
+func TestSaveAndLoadEveryLoss(t *testing.T) {
+	losses := []metrics.LossFunction{
+		&metrics.CrossEntropyLoss{LabelSmoothing: 0.1},
+		&metrics.SoftmaxCrossEntropyLoss{LabelSmoothing: 0.2},
+		&metrics.MeanSquaredErrorLoss{},
+		&metrics.MeanAbsoluteErrorLoss{},
+		&metrics.HuberLoss{Delta: 0.5},
+		&metrics.BinaryCrossEntropyWithLogitsLoss{LabelSmoothing: 0.05},
+		&metrics.HingeLoss{},
+		&metrics.SquaredHingeLoss{},
+		&metrics.KLDivergenceLoss{},
+		&metrics.FocalLoss{Gamma: 2, Weights: []float64{1, 2, 0.5, 1}, LabelSmoothing: 0.1},
+	}
+	inputs, _ := testData(4)
+	for _, loss := range losses {
+		n := New([]int{8, 8}, NewSGD(0.1), loss, WithSeed(1))
+		n.AddFullyConnectedLayer(4)
+		loaded := saveAndLoad(t, n)
+		if !reflect.DeepEqual(loaded.loss, loss) {
+			t.Errorf("loaded loss %#v, want %#v", loaded.loss, loss)
+		}
+		assertSamePredictions(t, loaded, n, inputs)
+	}
+}
+
+func TestSaveAndLoadKeepsSeed(t *testing.T) {
+	n := New([]int{8, 8}, NewSGD(0.1), &metrics.CrossEntropyLoss{}, WithSeed(42))
+	n.AddFullyConnectedLayer(8).AddDropoutLayer(0.5).AddFullyConnectedLayer(4).AddSoftmaxLayer()
+	var buf bytes.Buffer
+	if err := n.Save(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	// Every loaded copy starts again from the recorded seed, so they train identically
+	inputs, labels := testData(16)
+	var trained [][][]float64
+	for i := 0; i < 2; i++ {
+		loaded, err := Load(bytes.NewReader(buf.Bytes()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if seed, ok := loaded.Seed(); seed != 42 || !ok {
+			t.Fatalf("loaded seed %d, %v, want 42, true", seed, ok)
+		}
+		loaded.SetOptimizer(NewSGD(0.1))
+		if _, err := loaded.Fit(context.Background(), inputs, labels, nil, nil, 1, 4, 0); err != nil {
+			t.Fatal(err)
+		}
+		trained = append(trained, loaded.snapshot())
+	}
+	if !reflect.DeepEqual(trained[0], trained[1]) {
+		t.Error("two networks loaded from the same file trained to different parameters")
+	}
+}
+
+func TestLoadRejectsInvalidFiles(t *testing.T) {
+	n := New([]int{8, 8}, NewSGD(0.1), &metrics.CrossEntropyLoss{})
+	n.AddFullyConnectedLayer(4).AddSoftmaxLayer()
+	var buf bytes.Buffer
+	if err := n.Save(&buf); err != nil {
+		t.Fatal(err)
+	}
+	saved := buf.Bytes()
+
+	// The header is the magic, the version and the length of the payload
+	const versionOffset, payloadOffset = 4, 16
+	tests := []struct {
+		name   string
+		modify func(data []byte) []byte
+		want   error
+	}{
+		{name: "magic", modify: func(data []byte) []byte { data[0] = 'X'; return data }, want: ErrInvalidFormat},
+		{name: "empty", modify: func(data []byte) []byte { return nil }, want: ErrInvalidFormat},
+		{name: "newer version", modify: func(data []byte) []byte {
+			binary.LittleEndian.PutUint32(data[versionOffset:], modelVersion+1)
+			return data
+		}},
+		{name: "version 0", modify: func(data []byte) []byte {
+			binary.LittleEndian.PutUint32(data[versionOffset:], 0)
+			return data
+		}},
+		{name: "payload", modify: func(data []byte) []byte { data[payloadOffset+3] ^= 1; return data }, want: ErrChecksum},
+		{name: "checksum", modify: func(data []byte) []byte { data[len(data)-1] ^= 1; return data }, want: ErrChecksum},
+		{name: "truncated", modify: func(data []byte) []byte { return data[:len(data)-10] }},
+	}
+	for _, test := range tests {
+		data := test.modify(append([]byte(nil), saved...))
+		_, err := Load(bytes.NewReader(data))
+		if err == nil {
+			t.Errorf("%s: loading did not return an error", test.name)
+		} else if test.want != nil && !errors.Is(err, test.want) {
+			t.Errorf("%s: loading returned %v, want %v", test.name, err, test.want)
+		}
+	}
+}
+
+func TestLoadVersion1(t *testing.T) {
+	n := New([]int{8, 8}, NewSGD(0.1), &metrics.CrossEntropyLoss{}, WithSeed(3))
+	n.AddFullyConnectedLayer(4).AddSoftmaxLayer()
+
+	// Version 1 payloads end before the seed, a bool and a uint64 of 8 bytes each
+	var payload bytes.Buffer
+	if err := n.marshal(codec.NewWriter(&payload)); err != nil {
+		t.Fatal(err)
+	}
+	var file bytes.Buffer
+	if err := writeEnvelope(&file, modelMagic, 1, payload.Bytes()[:payload.Len()-16]); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := Load(&file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Without a recorded seed the network is seeded randomly
+	if loaded.seedValue == 3 {
+		t.Error("a network loaded from version 1 has the seed of the saved network")
+	}
+	inputs, _ := testData(3)
+	for _, input := range inputs {
+		want, got := n.Predict(input), loaded.Predict(input)
+		for i := range want {
+			if got[i] != want[i] {
+				t.Fatalf("loaded network predicts %v, want %v", got, want)
+			}
+		}
+	}
+}
@@ -1,198 +1,646 @@
 package cnn
 
 import (
-	"fmt"
+	"context"
+	"errors"
 	"github.com/rubenwo/cnn-go/pkg/cnn/layer"
 	"github.com/rubenwo/cnn-go/pkg/cnn/maths"
 	"github.com/rubenwo/cnn-go/pkg/cnn/metrics"
 	"math/rand"
+	"runtime"
+	"sync"
+	"time"
 )
 
 type Network struct {
-	layers       []layer.Layer
-	inputDims    []int
-	learningRate float64
-	loss         metrics.LossFunction
+	layers    []layer.Layer
+	inputDims []int
+	optimizer Optimizer
+	scheduler Scheduler
+	reporter  Reporter
+	loss      metrics.LossFunction
+
+	// random is the source of rng, it is kept so its state can be stored in checkpoints. rng initializes the
+	// weights of new layers and shuffles the training data.
+	random rand.Source
+	rng    *rand.Rand
+	// seedValue is the seed random was created with, hasSeed is false if the network was given a rand.Source
+	seedValue int64
+	hasSeed   bool
+
+	checkpoints CheckpointConfig
+	workers     int
+	// workspaces holds *workspace values, the output buffers of predictions that are not running
+	workspaces sync.Pool
+	// topK are the k values Validate computes the top-k accuracy for
+	topK []int
 }
 
-func New(inputDims []int, learningRate float64, loss metrics.LossFunction) *Network {
-	return &Network{
-		inputDims:    inputDims,
-		learningRate: learningRate,
-		layers:       []layer.Layer{},
-		loss:         loss}
+// Option configures a Network, see New.
+type Option func(n *Network)
+
+// WithSeed seeds the random number generator of the network. The initial weights of the layers and the order of the
+// training data follow from the seed, so two networks built and trained the same way with the same seed give
+// identical results. Without it the seed is taken from the global math/rand source.
+func WithSeed(seed int64) Option {
+	return func(n *Network) { n.seed(seed) }
 }
 
-func (n *Network) SetLearningRate(rate float64) {
-	n.learningRate = rate
+// WithSource makes the network draw its random numbers from source. The state of the source is only stored in
+// checkpoints if it implements State() uint64 and SetState(uint64), like maths.Source.
+func WithSource(source rand.Source) Option {
+	return func(n *Network) {
+		n.random = source
+		n.rng = rand.New(source)
+		n.seedValue, n.hasSeed = 0, false
+	}
 }
 
-func (n *Network) LearningRate() float64 { return n.learningRate }
+// statefulSource is a rand.Source whose state can be saved and restored
+type statefulSource interface {
+	State() uint64
+	SetState(state uint64)
+}
 
-func (n *Network) AddConvolutionLayer(filterDimensions []int, filterCount int) *Network {
-	var dims []int
-	if len(n.layers) == 0 {
-		dims = n.inputDims
-	} else {
-		dims = n.layers[len(n.layers)-1].OutputDims()
+func New(inputDims []int, optimizer Optimizer, loss metrics.LossFunction, options ...Option) *Network {
+	n := &Network{
+		inputDims: inputDims,
+		optimizer: optimizer,
+		layers:    []layer.Layer{},
+		loss:      loss}
+	n.seed(rand.Int63())
+	for _, option := range options {
+		option(n)
 	}
-	n.layers = append(n.layers, layer.NewConvolutionLayer(filterDimensions, filterCount, dims))
 	return n
 }
 
-func (n *Network) AddMaxPoolingLayer(stride int, dimensions []int) *Network {
-	var dims []int
+// seed replaces the random number generator of the network by one seeded with seed
+func (n *Network) seed(seed int64) {
+	n.random = maths.NewSource(seed)
+	n.rng = rand.New(n.random)
+	n.seedValue, n.hasSeed = seed, true
+}
+
+// Seed returns the seed of the random number generator of the network. It returns false if the network was created
+// with WithSource.
+func (n *Network) Seed() (int64, bool) { return n.seedValue, n.hasSeed }
+
+// Layers returns the layers of the network, in order
+func (n *Network) Layers() []layer.Layer { return append([]layer.Layer(nil), n.layers...) }
+
+// outputDims returns the dimensions of the output of the last layer, which are the input dimensions of the next
+// layer
+func (n *Network) outputDims() []int {
 	if len(n.layers) == 0 {
-		dims = n.inputDims
-	} else {
-		dims = n.layers[len(n.layers)-1].OutputDims()
+		return n.inputDims
 	}
+	return n.layers[len(n.layers)-1].OutputDims()
+}
+
+// add initializes the parameters of l with the random number generator of the network and appends it to the layers
+func (n *Network) add(l layer.Layer) *Network {
+	if i, ok := l.(layer.Initializable); ok {
+		i.InitializeParameters(n.rng)
+	}
+	n.layers = append(n.layers, l)
+	return n
+}
+
+func (n *Network) SetLearningRate(rate float64) {
+	n.optimizer.SetLearningRate(rate)
+}
+
+func (n *Network) LearningRate() float64 { return n.optimizer.LearningRate() }
+
+// AddConvolutionLayer adds a layer with filterCount filters of size filterDimensions. options configure the
+// strides, padding, dilation, bias and initialization of the layer, see layer.ConvolutionOption.
+func (n *Network) AddConvolutionLayer(filterDimensions []int, filterCount int, options ...layer.ConvolutionOption) *Network {
+	return n.add(layer.NewConvolutionLayer(filterDimensions, filterCount, n.outputDims(), options...))
+}
+
+func (n *Network) AddMaxPoolingLayer(stride int, dimensions []int) *Network {
+	dims := n.outputDims()
 	strides := make([]int, len(dimensions))
 	for i := 0; i < len(strides); i++ {
 		strides[i] = stride
 	}
 
-	n.layers = append(n.layers, layer.NewMaxPoolingLayer(strides, dimensions, dims))
-	return n
+	return n.add(layer.NewMaxPoolingLayer(strides, dimensions, dims))
 }
 
-func (n *Network) AddFullyConnectedLayer(outputLength int) *Network {
-	var dims []int
-	if len(n.layers) == 0 {
-		dims = n.inputDims
-	} else {
-		dims = n.layers[len(n.layers)-1].OutputDims()
-	}
-	n.layers = append(n.layers, layer.NewFullyConnectedLayer(outputLength, dims))
-	return n
+// AddFullyConnectedLayer adds a layer with outputLength outputs. options configure the layer, see
+// layer.FullyConnectedOption.
+func (n *Network) AddFullyConnectedLayer(outputLength int, options ...layer.FullyConnectedOption) *Network {
+	return n.add(layer.NewFullyConnectedLayer(outputLength, n.outputDims(), options...))
 }
 
 func (n *Network) AddReLULayer() *Network {
-	var dims []int
-	if len(n.layers) == 0 {
-		dims = n.inputDims
-	} else {
-		dims = n.layers[len(n.layers)-1].OutputDims()
-	}
-	n.layers = append(n.layers, layer.NewReLULayer(dims))
-	return n
+	return n.add(layer.NewReLULayer(n.outputDims()))
+}
+
+// AddDropoutLayer adds a layer that sets a fraction rate of the values to 0 during training, see layer.DropoutLayer.
+func (n *Network) AddDropoutLayer(rate float64) *Network {
+	return n.add(layer.NewDropoutLayer(rate, n.outputDims()))
+}
+
+// AddSpatialDropoutLayer adds a layer that sets a fraction rate of the feature maps to 0 during training, see
+// layer.SpatialDropoutLayer.
+func (n *Network) AddSpatialDropoutLayer(rate float64) *Network {
+	return n.add(layer.NewSpatialDropoutLayer(rate, n.outputDims()))
+}
+
+// AddBatchNormLayer adds a layer that normalizes every channel over the batch, see layer.BatchNormLayer. options
+// set its epsilon and momentum.
+func (n *Network) AddBatchNormLayer(options ...layer.NormalizationOption) *Network {
+	return n.add(layer.NewBatchNormLayer(n.outputDims(), options...))
+}
+
+// AddLayerNormLayer adds a layer that normalizes every example, see layer.LayerNormLayer. options set its epsilon.
+func (n *Network) AddLayerNormLayer(options ...layer.NormalizationOption) *Network {
+	return n.add(layer.NewLayerNormLayer(n.outputDims(), options...))
+}
+
+func (n *Network) AddSigmoidLayer() *Network {
+	return n.add(layer.NewSigmoidLayer(n.outputDims()))
+}
+
+func (n *Network) AddTanhLayer() *Network {
+	return n.add(layer.NewTanhLayer(n.outputDims()))
+}
+
+// AddLeakyReLULayer adds a ReLU with slope alpha for negative inputs, see layer.LeakyReLULayer.
+func (n *Network) AddLeakyReLULayer(alpha float64) *Network {
+	return n.add(layer.NewLeakyReLULayer(alpha, n.outputDims()))
+}
+
+// AddELULayer adds an exponential linear unit that saturates at -alpha, see layer.ELULayer.
+func (n *Network) AddELULayer(alpha float64) *Network {
+	return n.add(layer.NewELULayer(alpha, n.outputDims()))
+}
+
+func (n *Network) AddSELULayer() *Network {
+	return n.add(layer.NewSELULayer(n.outputDims()))
+}
+
+func (n *Network) AddGELULayer() *Network {
+	return n.add(layer.NewGELULayer(n.outputDims()))
+}
+
+// AddSwishLayer adds a layer applying x * sigmoid(x), also known as SiLU.
+func (n *Network) AddSwishLayer() *Network {
+	return n.add(layer.NewSwishLayer(n.outputDims()))
+}
+
+func (n *Network) AddSoftplusLayer() *Network {
+	return n.add(layer.NewSoftplusLayer(n.outputDims()))
+}
+
+func (n *Network) AddHardSigmoidLayer() *Network {
+	return n.add(layer.NewHardSigmoidLayer(n.outputDims()))
+}
+
+// AddPReLULayer adds a leaky ReLU that learns the slope of every channel, see layer.PReLULayer.
+func (n *Network) AddPReLULayer() *Network {
+	return n.add(layer.NewPReLULayer(n.outputDims()))
 }
 
 func (n *Network) AddSoftmaxLayer() *Network {
-	var dims []int
-	if len(n.layers) == 0 {
-		dims = n.inputDims
-	} else {
-		dims = n.layers[len(n.layers)-1].OutputDims()
-	}
+	return n.add(layer.NewSoftmaxLayer(n.outputDims()))
+}
 
-	n.layers = append(n.layers, layer.NewSoftmaxLayer(dims))
-	return n
+// AddLogSoftmaxLayer adds a layer computing the logarithm of the softmax, see layer.LogSoftmaxLayer.
+func (n *Network) AddLogSoftmaxLayer() *Network {
+	return n.add(layer.NewLogSoftmaxLayer(n.outputDims()))
 }
 
 // Fit will train the CNN. inputs are the inputs, labels are the labels.
 // epochs are the amount of times the network is fitted
-// if valInputs and valLabels != nil a validation step is ran on that data after each epoch
-// batchSize is the size of every propagation batch.
-// if verbose then logging is enabled and is written to to stdout with fmt
-// every 'logRate' of iterations a message is written when verbose == true
-// onBatchDone is a callback that is called every time a batch is done. This can be used to reduce the learning rate for example
-func (n *Network) Fit(inputs, labels, valInputs, valLabels []maths.Tensor, epochs int, batchSize int, verbose bool, logRate int, onEpochDone func()) {
-	fmt.Println("Fit: ignoring batch size")
+// if valInputs is not empty a validation step is ran on that data and valLabels after each epoch
+// batchSize is the size of every propagation batch. The gradients of every example in a batch are accumulated and
+// the weights are updated once per batch using their average. The examples of a batch are divided over the
+// workers set with SetWorkers, which does not change the result.
+// every 'logRate' of iterations the training metrics are recorded in the History and passed to the reporter,
+// a logRate of 0 disables this.
+// callbacks are notified of the progress of training and can stop it, see Callback.
+// Training stops after the current batch when ctx is cancelled, Fit then returns the History so far and ctx.Err().
+// If a Scheduler is set with SetScheduler, it determines the learning rate during training.
+// If checkpointing is enabled with SetCheckpointing, checkpoints are written during training and when it is
+// cancelled, which can be used to continue training with Resume.
+// Progress is passed to the Reporter set with SetReporter, Fit does not print anything itself.
+func (n *Network) Fit(ctx context.Context, inputs, labels, valInputs, valLabels []maths.Tensor, epochs int, batchSize int, logRate int, callbacks ...Callback) (*History, error) {
 	if len(labels) != len(inputs) {
 		panic("length of labels is not equal to length of inputs")
 	}
+	if batchSize < 1 {
+		panic("batchSize must be at least 1")
+	}
+
+	if n.scheduler != nil {
+		n.SetLearningRate(n.scheduler.LearningRate())
+	}
+
+	p := &progress{bestAccuracy: -1, history: &History{}}
+	return n.train(ctx, p, inputs, labels, valInputs, valLabels, epochs, batchSize, logRate, callbacks)
+}
+
+// progress is the position of Fit in the training process. It is stored in checkpoints so training can be resumed.
+type progress struct {
+	epoch    int
+	position int   // index into order of the next example to train on
+	order    []int // order in which the inputs are visited during the current epoch, nil if the epoch hasn't started
+
+	epochLoss    float64 // sum of the loss of this epoch
+	epochCorrect float64 // number of correct predictions this epoch
+	epochElapsed time.Duration
+	logLoss      float64 // sum of the loss since the last log interval
+	logAccuracy  float64 // number of correct predictions since the last log interval
+
+	schedule     ScheduleState
+	bestAccuracy float64 // best validation accuracy so far, -1 if not validated yet
+
+	history *History
+
+	// not stored in checkpoints, durations that have been recorded in a checkpoint are included by moving
+	// these start times back when training is resumed
+	trainStarted time.Time
+	epochStarted time.Time
+}
+
+// saveDurations records the time spent so far so it can be stored in a checkpoint
+func (p *progress) saveDurations() {
+	p.history.Duration = time.Since(p.trainStarted)
+	p.epochElapsed = time.Since(p.epochStarted)
+}
+
+func (n *Network) train(ctx context.Context, p *progress, inputs, labels, valInputs, valLabels []maths.Tensor, epochs int, batchSize int, logRate int, callbacks []Callback) (*History, error) {
+	p.trainStarted = time.Now().Add(-p.history.Duration)
+	p.epochStarted = time.Now().Add(-p.epochElapsed)
+
+	err := n.runEpochs(ctx, p, inputs, labels, valInputs, valLabels, epochs, batchSize, logRate, callbacks)
+	if err != nil && ctx.Err() != nil && p.order != nil {
+		// Cancelled in the middle of an epoch, save the progress so it can be resumed
+		p.saveDurations()
+		if checkpointErr := n.checkpoint(p, false); checkpointErr != nil {
+			err = checkpointErr
+		}
+	}
+	if errors.Is(err, ErrStopTraining) {
+		err = nil
+	}
+
+	p.history.Duration = time.Since(p.trainStarted)
+	if callbackErr := notify(callbacks, func(c Callback) error { return c.OnTrainEnd(n, p.history) }); err == nil {
+		err = callbackErr
+	}
+	return p.history, err
+}
+
+// notify calls fn for every callback, so every callback sees the event even if an earlier one stops training.
+// It returns the first error.
+func notify(callbacks []Callback, fn func(c Callback) error) error {
+	var first error
+	for _, c := range callbacks {
+		if err := fn(c); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+func (n *Network) runEpochs(ctx context.Context, p *progress, inputs, labels, valInputs, valLabels []maths.Tensor, epochs int, batchSize int, logRate int, callbacks []Callback) error {
+	if err := notify(callbacks, func(c Callback) error { return c.OnTrainBegin(n) }); err != nil {
+		return err
+	}
+
+	accumulators := n.newAccumulators(batchSize)
+	for p.epoch < epochs {
+		if p.order == nil {
+			if n.reporter != nil {
+				n.reporter.EpochStarted(p.epoch)
+			}
+			if err := notify(callbacks, func(c Callback) error { return c.OnEpochBegin(n, p.epoch) }); err != nil {
+				return err
+			}
+			p.order = n.rng.Perm(len(inputs))
+			p.epochStarted = time.Now()
+		}
+
+		for p.position < len(p.order) {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
+			batchEnd := p.position + batchSize
+			if batchEnd > len(p.order) {
+				batchEnd = len(p.order)
+			}
+			batch := BatchMetrics{Epoch: p.epoch, Size: batchEnd - p.position, LearningRate: n.LearningRate()}
 
-	for epoch := 0; epoch < epochs; epoch++ {
-		fmt.Printf("Starting epoch: %d\n", epoch)
-		rand.Shuffle(len(inputs), func(i, j int) {
-			inputs[i], inputs[j] = inputs[j], inputs[i]
-			labels[i], labels[j] = labels[j], labels[i]
-		})
-		averageLoss := 0.0
-		accuracy := 0.0
-		for i := range inputs {
 			// train the network
-			output := n.forward(inputs[i])
-			// Use the loss as input for the backpropagation
-			n.backward(n.loss.CalculateLossDerivative(labels[i].Values(), output.Values()))
-
-			if verbose {
-				loss := n.loss.CalculateLoss(labels[i].Values(), output.Values())
-				averageLoss += maths.SumFloat64Slice(loss.Values())
-				if maths.FindMaxIndexFloat64Slice(labels[i].Values()) == maths.FindMaxIndexFloat64Slice(output.Values()) {
-					accuracy++
+			losses, corrects := n.trainBatch(accumulators, inputs, labels, p.order[p.position:batchEnd])
+
+			for j := 0; p.position < batchEnd; p.position, j = p.position+1, j+1 {
+				loss, correct := losses[j], corrects[j]
+				p.epochLoss += loss
+				p.epochCorrect += correct
+				batch.Loss += loss
+				batch.Accuracy += correct
+
+				if logRate > 0 {
+					p.logLoss += loss
+					p.logAccuracy += correct
+					if p.position%logRate == 0 {
+						metrics := IntervalMetrics{
+							Epoch:        p.epoch,
+							Position:     p.position,
+							Size:         logRate,
+							Loss:         p.logLoss / float64(logRate),
+							Accuracy:     p.logAccuracy / float64(logRate),
+							LearningRate: n.LearningRate(),
+						}
+						p.history.Intervals = append(p.history.Intervals, metrics)
+						if n.reporter != nil {
+							n.reporter.IntervalCompleted(metrics)
+						}
+						p.logLoss = 0
+						p.logAccuracy = 0
+					}
 				}
-				if i%logRate == 0 {
-					fmt.Printf("Input: %d / %d, average loss for last %d iterations was %f\n", i, len(inputs), logRate, averageLoss/float64(logRate))
-					fmt.Printf("Accuracy for the last %d iterations was %.2f\n", logRate, accuracy/float64(logRate))
-					fmt.Printf("Using learning rate of %f\n", n.learningRate)
-					averageLoss = 0
-					accuracy = 0
+			}
+			// Apply the averaged gradients of this batch
+			n.update(batch.Size)
+
+			p.schedule.Batch++
+			p.schedule.TrainingLoss = p.epochLoss / float64(batchEnd)
+			if n.scheduler != nil && n.scheduler.Interval() == EveryBatch {
+				n.stepScheduler(p.schedule)
+			}
+
+			batch.Batch = p.schedule.Batch
+			batch.Loss /= float64(batch.Size)
+			batch.Accuracy /= float64(batch.Size)
+			if err := notify(callbacks, func(c Callback) error { return c.OnBatchEnd(n, batch) }); err != nil {
+				return err
+			}
+
+			if n.checkpoints.Every > 0 && p.schedule.Batch%n.checkpoints.Every == 0 && p.position < len(p.order) {
+				p.saveDurations()
+				if err := n.checkpoint(p, false); err != nil {
+					return err
 				}
 			}
 		}
-		if valLabels != nil && valInputs != nil {
-			n.Validate(valInputs, valLabels)
+
+		metrics := EpochMetrics{
+			Epoch:        p.epoch,
+			Loss:         p.epochLoss / float64(len(p.order)),
+			Accuracy:     p.epochCorrect / float64(len(p.order)),
+			LearningRate: n.LearningRate(),
+		}
+
+		p.schedule.Epoch++
+		p.schedule.Validated = false
+		improved := false
+		if len(valInputs) > 0 {
+			result := n.validate(valInputs, valLabels)
+			metrics.Validation = &result
+			p.schedule.ValidationLoss = result.Loss
+			p.schedule.Validated = true
+			if result.Accuracy > p.bestAccuracy {
+				p.bestAccuracy = result.Accuracy
+				improved = true
+			}
+		}
+		metrics.Duration = time.Since(p.epochStarted)
+		p.history.Epochs = append(p.history.Epochs, metrics)
+		if n.reporter != nil {
+			n.reporter.EpochCompleted(metrics)
+		}
+		if n.scheduler != nil && n.scheduler.Interval() == EveryEpoch {
+			n.stepScheduler(p.schedule)
+		}
+
+		p.epoch++
+		p.position = 0
+		p.order = nil
+		p.epochLoss, p.epochCorrect, p.logLoss, p.logAccuracy = 0, 0, 0, 0
+		p.epochStarted = time.Now()
+		p.saveDurations()
+		if err := n.checkpoint(p, improved); err != nil {
+			return err
 		}
-		fmt.Printf("Completed epoch: %d\n", epoch)
-		if onEpochDone != nil {
-			onEpochDone()
+
+		if err := notify(callbacks, func(c Callback) error { return c.OnEpochEnd(n, metrics) }); err != nil {
+			return err
 		}
 	}
+	return nil
+}
+
+// Validate runs the network over inputs and returns the average loss and the accuracy, and the classification
+// metrics of the predictions in Evaluation. Without inputs there is no average, so it returns an error.
+func (n *Network) Validate(inputs []maths.Tensor, labels []maths.Tensor) (EvaluationResult, error) {
+	if len(inputs) == 0 {
+		return EvaluationResult{}, errors.New("cnn: no inputs to validate on")
+	}
+	return n.validate(inputs, labels), nil
 }
 
-func (n *Network) Validate(inputs []maths.Tensor, labels []maths.Tensor) {
+// validate runs the network over at least one input
+func (n *Network) validate(inputs []maths.Tensor, labels []maths.Tensor) EvaluationResult {
 	if len(labels) != len(inputs) {
 		panic("length of labels is not equal to length of inputs")
 	}
-	fmt.Printf("Validating network with %d inputs...\n", len(inputs))
-
-	averageLoss := 0.0
-	accuracy := 0.0
-	for i := range inputs {
-		// train the network
-		output := n.forward(inputs[i])
-		loss := n.loss.CalculateLoss(labels[i].Values(), output.Values())
-		averageLoss += maths.SumFloat64Slice(loss.Values())
-		if maths.FindMaxIndexFloat64Slice(labels[i].Values()) == maths.FindMaxIndexFloat64Slice(output.Values()) {
-			accuracy++
+
+	result := EvaluationResult{Count: len(inputs)}
+	var evaluator *metrics.Evaluator
+	for i, output := range n.PredictBatch(inputs) {
+		lossTensor := n.loss.CalculateLoss(labels[i].Values(), output)
+		result.Loss += maths.SumFloat64Slice(lossTensor.Values())
+		if evaluator == nil {
+			evaluator = metrics.NewEvaluator(len(output), n.topK...)
 		}
+		evaluator.Add(labels[i].Values(), output)
+	}
+	result.Loss /= float64(len(inputs))
+	if evaluator != nil {
+		result.Evaluation = evaluator.Evaluate()
+		result.Accuracy = result.Evaluation.Accuracy
 	}
-	fmt.Printf("Validation average loss: %f\n", averageLoss/float64(len(inputs)))
-	fmt.Printf("Validation accuracy: %.2f\n", accuracy/float64(len(inputs)))
+	return result
+}
+
+// SetTopK sets the k values Validate computes the top-k accuracy for, for example 5 to also count predictions
+// that have the actual class among their 5 highest scores as correct.
+func (n *Network) SetTopK(k ...int) {
+	n.topK = append([]int(nil), k...)
+}
+
+// SetReporter sets the reporter that is notified of the progress of Fit. A nil reporter disables reporting.
+func (n *Network) SetReporter(reporter Reporter) {
+	n.reporter = reporter
+}
+
+// SetScheduler sets the scheduler that determines the learning rate during Fit.
+// A nil scheduler keeps the learning rate constant.
+func (n *Network) SetScheduler(scheduler Scheduler) {
+	n.scheduler = scheduler
 }
 
-// Returns a slice of probabilities
+// stepScheduler advances the scheduler and applies its new learning rate to the optimizer
+func (n *Network) stepScheduler(state ScheduleState) {
+	n.scheduler.Step(state)
+	n.SetLearningRate(n.scheduler.LearningRate())
+}
+
+// Returns a slice of probabilities.
+// Predict, PredictIndex and PredictBatch do not modify the network, so they can be called from multiple
+// goroutines at the same time, as long as the network is not being trained or loaded concurrently.
+// Every goroutine gets its own buffers for the outputs of the layers, which are reused by later predictions, so
+// the only allocation of Predict for networks of layer.BufferedLayer layers is the returned slice.
 func (n *Network) Predict(input maths.Tensor) []float64 {
-	output := n.forward(input)
-	return output.Values()
+	w := n.workspace()
+	output := n.forwardInto(w, input)
+	values := append([]float64(nil), output.Values()...)
+	n.workspaces.Put(w)
+	return values
 }
 
 // Returns the highest index from the prediction
 func (n *Network) PredictIndex(input maths.Tensor) int {
-	output := n.forward(input)
-	return maths.FindMaxIndexFloat64Slice(output.Values())
+	w := n.workspace()
+	output := n.forwardInto(w, input)
+	index := maths.FindMaxIndexFloat64Slice(output.Values())
+	n.workspaces.Put(w)
+	return index
 }
 
-func (n *Network) forward(input maths.Tensor) maths.Tensor {
+// PredictBatch returns the prediction for every input, in the same order as inputs.
+// The inputs are divided over runtime.NumCPU() goroutines.
+func (n *Network) PredictBatch(inputs []maths.Tensor) [][]float64 {
+	outputs := make([][]float64, len(inputs))
+
+	workers := runtime.NumCPU()
+	if workers > len(inputs) {
+		workers = len(inputs)
+	}
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := w; i < len(inputs); i += workers {
+				outputs[i] = n.Predict(inputs[i])
+			}
+		}(w)
+	}
+	wg.Wait()
+	return outputs
+}
+
+// workspace holds an output buffer for every layer of a network
+type workspace struct {
+	outputs []*maths.Tensor
+}
+
+// workspace returns a workspace that is not used by any other goroutine. It has to be returned to n.workspaces
+// when the prediction is done.
+func (n *Network) workspace() *workspace {
+	w, ok := n.workspaces.Get().(*workspace)
+	if !ok {
+		w = &workspace{}
+	}
+	if len(w.outputs) != len(n.layers) {
+		w.outputs = make([]*maths.Tensor, len(n.layers))
+	}
+	return w
+}
+
+// forwardInto runs input through all layers in Inference mode, computing the outputs of layer.BufferedLayer layers
+// into the buffers of w. The returned tensor can be one of those buffers.
+func (n *Network) forwardInto(w *workspace, input maths.Tensor) maths.Tensor {
 	output := input
+	for i, l := range n.layers {
+		b, ok := l.(layer.BufferedLayer)
+		if !ok {
+			output, _ = l.ForwardPropagation(output, layer.Inference)
+			continue
+		}
+		// The layers can be replaced by loading a checkpoint, so the size of the buffer is checked every time
+		if w.outputs[i] == nil || !equalDims(w.outputs[i].Dimensions(), l.OutputDims()) {
+			w.outputs[i] = maths.NewTensor(append([]int(nil), l.OutputDims()...), nil)
+		}
+		b.ForwardPropagationInto(output, w.outputs[i])
+		output = *w.outputs[i]
+	}
+	return output
+}
+
+// forwardLayer runs input through l. Stochastic layers draw their random numbers from random, unless it is nil.
+func forwardLayer(l layer.Layer, input maths.Tensor, mode layer.Mode, random *rand.Rand) (maths.Tensor, layer.Cache) {
+	if s, ok := l.(layer.Stochastic); ok && random != nil {
+		return s.ForwardPropagationRandom(input, mode, random)
+	}
+	return l.ForwardPropagation(input, mode)
+}
 
+// parameters returns the trainable parameters of all layers, in order
+func (n *Network) parameters() []*layer.Parameter {
+	var params []*layer.Parameter
 	for _, l := range n.layers {
-		output = l.ForwardPropagation(output)
+		params = append(params, l.Parameters()...)
 	}
+	return params
+}
 
-	return output
+// snapshot returns a copy of the values of the parameters and the state of the layer.Stateful layers, which
+// restore copies back into the network
+func (n *Network) snapshot() [][]float64 {
+	var values [][]float64
+	for _, p := range n.parameters() {
+		values = append(values, append([]float64(nil), p.Value.Values()...))
+	}
+	for _, l := range n.layers {
+		if s, ok := l.(layer.Stateful); ok {
+			for _, state := range s.State() {
+				values = append(values, append([]float64(nil), state...))
+			}
+		}
+	}
+	return values
+}
+
+// restore resets the parameters and the state of the layers to a snapshot
+func (n *Network) restore(snapshot [][]float64) {
+	for _, p := range n.parameters() {
+		copy(p.Value.Values(), snapshot[0])
+		snapshot = snapshot[1:]
+	}
+	for _, l := range n.layers {
+		if s, ok := l.(layer.Stateful); ok {
+			for _, state := range s.State() {
+				copy(state, snapshot[0])
+				snapshot = snapshot[1:]
+			}
+		}
+	}
 }
 
-func (n *Network) backward(outputGradient maths.Tensor) maths.Tensor {
-	inputGradient := outputGradient
+// update averages the gradients accumulated over the last batchSize examples, lets the optimizer apply them and
+// resets them for the next batch
+func (n *Network) update(batchSize int) {
+	params := n.parameters()
+	for _, p := range params {
+		p.Gradient.Apply(func(val float64, idx int) float64 { return val / float64(batchSize) })
+	}
 
-	for i := len(n.layers) - 1; i >= 0; i-- {
-		inputGradient = n.layers[i].BackwardPropagation(inputGradient, n.learningRate)
+	n.optimizer.Update(params)
 
+	for _, p := range params {
+		p.Gradient.Apply(func(val float64, idx int) float64 { return 0 })
 	}
-	return inputGradient
 }
 
 //// Copy is a deep copy of the network, this is useful for GA's when mutating the network
@@ -0,0 +1,117 @@
+package cnn
+
+import (
+	"context"
+	"math/rand"
+	"runtime"
+	"testing"
+
+	"github.com/rubenwo/cnn-go/pkg/cnn/layer"
+	"github.com/rubenwo/cnn-go/pkg/cnn/maths"
+	"github.com/rubenwo/cnn-go/pkg/cnn/metrics"
+)
+
+// testData returns count 8x8 inputs of 4 classes with one-hot labels, the class of an input is marked by a high value
+func testData(count int) (inputs, labels []maths.Tensor) {
+	random := rand.New(rand.NewSource(5))
+	for i := 0; i < count; i++ {
+		class := random.Intn(4)
+		values := make([]float64, 64)
+		for j := range values {
+			values[j] = random.Float64()
+		}
+		values[class*3] += 2
+		label := make([]float64, 4)
+		label[class] = 1
+		inputs = append(inputs, *maths.NewTensor([]int{8, 8}, values))
+		labels = append(labels, *maths.NewTensor([]int{4}, label))
+	}
+	return inputs, labels
+}
+
+// newInferenceNetwork returns a network with a layer of every kind that behaves differently during inference
+func newInferenceNetwork() *Network {
+	n := New([]int{8, 8}, NewSGD(0.1), &metrics.CrossEntropyLoss{}, WithSeed(2))
+	n.AddConvolutionLayer([]int{3, 3}, 4, layer.WithBias()).AddBatchNormLayer().AddPReLULayer().AddMaxPoolingLayer(2, []int{2, 2, 1}).
+		AddDropoutLayer(0.5).AddLayerNormLayer().AddFullyConnectedLayer(6).AddGELULayer().AddFullyConnectedLayer(4).AddSoftmaxLayer()
+	return n
+}
+
+func TestPredictMatchesForwardPropagation(t *testing.T) {
+	n := newInferenceNetwork()
+	inputs, _ := testData(5)
+	for i, prediction := range n.PredictBatch(inputs) {
+		output := inputs[i]
+		for _, l := range n.layers {
+			output, _ = l.ForwardPropagation(output, layer.Inference)
+		}
+		for j, v := range output.Values() {
+			if prediction[j] != v {
+				t.Fatalf("input %d: prediction %v, forward propagation %v", i, prediction, output.Values())
+			}
+		}
+	}
+}
+
+func TestPredictReusesLayerOutputs(t *testing.T) {
+	if raceEnabled {
+		t.Skip("the buffers are not reliably reused with the race detector")
+	}
+	n := New([]int{28, 28}, NewSGD(0.1), &metrics.CrossEntropyLoss{}, WithSeed(2))
+	n.AddConvolutionLayer([]int{5, 5}, 8).AddReLULayer().AddFullyConnectedLayer(64).AddTanhLayer().
+		AddFullyConnectedLayer(10).AddSoftmaxLayer()
+	input := *maths.NewTensor([]int{28, 28}, nil)
+	n.Predict(input)
+
+	// The lowered input of the convolution alone has 24*24*25 values, the remaining allocations are the returned
+	// slice and the matrix and vector headers
+	const runs = 100
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	for i := 0; i < runs; i++ {
+		n.Predict(input)
+	}
+	runtime.ReadMemStats(&after)
+	if bytes := (after.TotalAlloc - before.TotalAlloc) / runs; bytes > 4096 {
+		t.Errorf("Predict allocated %d bytes", bytes)
+	}
+}
+
+func TestValidateWithoutInputs(t *testing.T) {
+	n := New([]int{4}, NewSGD(0.1), &metrics.CrossEntropyLoss{})
+	n.AddFullyConnectedLayer(2).AddSoftmaxLayer()
+	if _, err := n.Validate(nil, nil); err == nil {
+		t.Error("validating without inputs did not return an error")
+	}
+	if _, err := n.Validate([]maths.Tensor{}, []maths.Tensor{}); err == nil {
+		t.Error("validating an empty slice of inputs did not return an error")
+	}
+}
+
+func TestSameSeedTrainsIdentically(t *testing.T) {
+	inputs, labels := testData(24)
+	train := func(seed int64) *Network {
+		n := New([]int{8, 8}, NewSGD(0.1), &metrics.CrossEntropyLoss{}, WithSeed(seed))
+		n.AddConvolutionLayer([]int{3, 3}, 4).AddSpatialDropoutLayer(0.25).AddFullyConnectedLayer(8).AddDropoutLayer(0.5).
+			AddReLULayer().AddFullyConnectedLayer(4).AddSoftmaxLayer()
+		if _, err := n.Fit(context.Background(), inputs, labels, nil, nil, 2, 4, 0); err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+
+	// The seed determines the initial parameters, the order of the inputs and the dropout masks
+	a, b, other := train(7).snapshot(), train(7).snapshot(), train(8).snapshot()
+	differs := false
+	for i, values := range a {
+		for j, v := range values {
+			if b[i][j] != v {
+				t.Fatalf("parameter %d[%d] is %g and %g for the same seed", i, j, v, b[i][j])
+			}
+			differs = differs || other[i][j] != v
+		}
+	}
+	if !differs {
+		t.Error("networks with different seeds trained to the same parameters")
+	}
+}
@@ -0,0 +1,300 @@
+package cnn
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/rubenwo/cnn-go/pkg/cnn/internal/codec"
+	"github.com/rubenwo/cnn-go/pkg/cnn/layer"
+	"math"
+)
+
+// Optimizer updates the parameters of a network using their gradients.
+// The network passes its parameters in the same order on every call, which allows an optimizer
+// to keep state (velocities, moments) for each parameter by its index.
+// Optimizers that implement encoding.BinaryMarshaler and encoding.BinaryUnmarshaler have their state
+// stored in checkpoints.
+type Optimizer interface {
+	// Update applies the (batch averaged) gradients in params to their values.
+	Update(params []*layer.Parameter)
+
+	LearningRate() float64
+	SetLearningRate(rate float64)
+}
+
+// parameterState holds one slice of values for every value of every parameter.
+type parameterState [][]float64
+
+// ensure makes sure there is a zeroed state slice for every parameter in params.
+func (s parameterState) ensure(params []*layer.Parameter) parameterState {
+	if len(s) == len(params) {
+		return s
+	}
+	s = make(parameterState, len(params))
+	for i, p := range params {
+		s[i] = make([]float64, p.Value.Len())
+	}
+	return s
+}
+
+func (s parameterState) write(w *codec.Writer) {
+	w.Int(len(s))
+	for _, values := range s {
+		w.Floats(values)
+	}
+}
+
+func readParameterState(r *codec.Reader) parameterState {
+	// The slices are appended as they are read, so a corrupt count does not allocate memory up front
+	var s parameterState
+	for count := r.Length(); len(s) < count && r.Err() == nil; {
+		s = append(s, r.Floats())
+	}
+	return s
+}
+
+// check returns an error if s is not empty and does not hold a slice of the right length for every parameter in
+// params. An empty state is created by the first update.
+func (s parameterState) check(params []*layer.Parameter) error {
+	if len(s) == 0 {
+		return nil
+	}
+	if len(s) != len(params) {
+		return fmt.Errorf("cnn: optimizer state has %d parameters, the network has %d", len(s), len(params))
+	}
+	for i, p := range params {
+		if len(s[i]) != p.Value.Len() {
+			return fmt.Errorf("cnn: optimizer state of parameter %d has %d values, the parameter has %d", i, len(s[i]), p.Value.Len())
+		}
+	}
+	return nil
+}
+
+// stateChecker is implemented by the optimizers of this package, so the state restored from a checkpoint can be
+// checked against the parameters of the network before it is used
+type stateChecker interface {
+	checkState(params []*layer.Parameter) error
+}
+
+// SGD is stochastic gradient descent with optional (Nesterov) momentum.
+type SGD struct {
+	learningRate float64
+	momentum     float64
+	nesterov     bool
+
+	velocities parameterState
+}
+
+// NewSGD returns plain stochastic gradient descent: value -= learningRate * gradient
+func NewSGD(learningRate float64) *SGD {
+	return &SGD{learningRate: learningRate}
+}
+
+// NewMomentumSGD returns stochastic gradient descent with momentum.
+// if nesterov is true the gradient is evaluated at the look-ahead position (Nesterov accelerated gradient).
+func NewMomentumSGD(learningRate, momentum float64, nesterov bool) *SGD {
+	return &SGD{learningRate: learningRate, momentum: momentum, nesterov: nesterov}
+}
+
+func (o *SGD) Update(params []*layer.Parameter) {
+	if o.momentum == 0 {
+		for _, p := range params {
+			values, gradients := p.Value.Values(), p.Gradient.Values()
+			for j := range values {
+				values[j] -= o.learningRate * gradients[j]
+			}
+		}
+		return
+	}
+
+	o.velocities = o.velocities.ensure(params)
+	for i, p := range params {
+		values, gradients, velocity := p.Value.Values(), p.Gradient.Values(), o.velocities[i]
+		for j := range values {
+			velocity[j] = o.momentum*velocity[j] - o.learningRate*gradients[j]
+			if o.nesterov {
+				values[j] += o.momentum*velocity[j] - o.learningRate*gradients[j]
+			} else {
+				values[j] += velocity[j]
+			}
+		}
+	}
+}
+
+func (o *SGD) checkState(params []*layer.Parameter) error {
+	return o.velocities.check(params)
+}
+
+func (o *SGD) LearningRate() float64        { return o.learningRate }
+func (o *SGD) SetLearningRate(rate float64) { o.learningRate = rate }
+
+func (o *SGD) MarshalBinary() ([]byte, error) {
+	var buf bytes.Buffer
+	w := codec.NewWriter(&buf)
+	w.Float(o.learningRate)
+	o.velocities.write(w)
+	return buf.Bytes(), w.Err()
+}
+
+func (o *SGD) UnmarshalBinary(data []byte) error {
+	r := codec.NewReader(bytes.NewReader(data))
+	o.learningRate = r.Float()
+	o.velocities = readParameterState(r)
+	return r.Err()
+}
+
+// Adam implements the Adam optimizer from "Adam: A Method for Stochastic Optimization" (Kingma & Ba).
+type Adam struct {
+	learningRate float64
+	beta1, beta2 float64
+	epsilon      float64
+
+	step         int
+	firstMoment  parameterState
+	secondMoment parameterState
+}
+
+// NewAdam returns an Adam optimizer. Commonly used values are beta1 = 0.9, beta2 = 0.999 and epsilon = 1e-8
+func NewAdam(learningRate, beta1, beta2, epsilon float64) *Adam {
+	return &Adam{learningRate: learningRate, beta1: beta1, beta2: beta2, epsilon: epsilon}
+}
+
+func (o *Adam) Update(params []*layer.Parameter) {
+	o.firstMoment = o.firstMoment.ensure(params)
+	o.secondMoment = o.secondMoment.ensure(params)
+	o.step++
+
+	// bias correction for the moments, which are initialized at 0
+	correction1 := 1 - math.Pow(o.beta1, float64(o.step))
+	correction2 := 1 - math.Pow(o.beta2, float64(o.step))
+
+	for i, p := range params {
+		values, gradients := p.Value.Values(), p.Gradient.Values()
+		m, v := o.firstMoment[i], o.secondMoment[i]
+		for j := range values {
+			m[j] = o.beta1*m[j] + (1-o.beta1)*gradients[j]
+			v[j] = o.beta2*v[j] + (1-o.beta2)*gradients[j]*gradients[j]
+			values[j] -= o.learningRate * (m[j] / correction1) / (math.Sqrt(v[j]/correction2) + o.epsilon)
+		}
+	}
+}
+
+func (o *Adam) checkState(params []*layer.Parameter) error {
+	if err := o.firstMoment.check(params); err != nil {
+		return err
+	}
+	return o.secondMoment.check(params)
+}
+
+func (o *Adam) LearningRate() float64        { return o.learningRate }
+func (o *Adam) SetLearningRate(rate float64) { o.learningRate = rate }
+
+func (o *Adam) MarshalBinary() ([]byte, error) {
+	var buf bytes.Buffer
+	w := codec.NewWriter(&buf)
+	w.Float(o.learningRate)
+	w.Int(o.step)
+	o.firstMoment.write(w)
+	o.secondMoment.write(w)
+	return buf.Bytes(), w.Err()
+}
+
+func (o *Adam) UnmarshalBinary(data []byte) error {
+	r := codec.NewReader(bytes.NewReader(data))
+	o.learningRate = r.Float()
+	o.step = r.Int()
+	o.firstMoment = readParameterState(r)
+	o.secondMoment = readParameterState(r)
+	return r.Err()
+}
+
+// RMSProp divides the gradient by a running average of its recent magnitude.
+type RMSProp struct {
+	learningRate float64
+	decay        float64
+	epsilon      float64
+
+	meanSquares parameterState
+}
+
+// NewRMSProp returns a RMSProp optimizer. A commonly used decay is 0.9
+func NewRMSProp(learningRate, decay, epsilon float64) *RMSProp {
+	return &RMSProp{learningRate: learningRate, decay: decay, epsilon: epsilon}
+}
+
+func (o *RMSProp) Update(params []*layer.Parameter) {
+	o.meanSquares = o.meanSquares.ensure(params)
+	for i, p := range params {
+		values, gradients, meanSquare := p.Value.Values(), p.Gradient.Values(), o.meanSquares[i]
+		for j := range values {
+			meanSquare[j] = o.decay*meanSquare[j] + (1-o.decay)*gradients[j]*gradients[j]
+			values[j] -= o.learningRate * gradients[j] / (math.Sqrt(meanSquare[j]) + o.epsilon)
+		}
+	}
+}
+
+func (o *RMSProp) checkState(params []*layer.Parameter) error {
+	return o.meanSquares.check(params)
+}
+
+func (o *RMSProp) LearningRate() float64        { return o.learningRate }
+func (o *RMSProp) SetLearningRate(rate float64) { o.learningRate = rate }
+
+func (o *RMSProp) MarshalBinary() ([]byte, error) {
+	var buf bytes.Buffer
+	w := codec.NewWriter(&buf)
+	w.Float(o.learningRate)
+	o.meanSquares.write(w)
+	return buf.Bytes(), w.Err()
+}
+
+func (o *RMSProp) UnmarshalBinary(data []byte) error {
+	r := codec.NewReader(bytes.NewReader(data))
+	o.learningRate = r.Float()
+	o.meanSquares = readParameterState(r)
+	return r.Err()
+}
+
+// AdaGrad scales the learning rate of every value by the inverse root of the sum of its squared gradients.
+type AdaGrad struct {
+	learningRate float64
+	epsilon      float64
+
+	sumSquares parameterState
+}
+
+func NewAdaGrad(learningRate, epsilon float64) *AdaGrad {
+	return &AdaGrad{learningRate: learningRate, epsilon: epsilon}
+}
+
+func (o *AdaGrad) Update(params []*layer.Parameter) {
+	o.sumSquares = o.sumSquares.ensure(params)
+	for i, p := range params {
+		values, gradients, sumSquare := p.Value.Values(), p.Gradient.Values(), o.sumSquares[i]
+		for j := range values {
+			sumSquare[j] += gradients[j] * gradients[j]
+			values[j] -= o.learningRate * gradients[j] / (math.Sqrt(sumSquare[j]) + o.epsilon)
+		}
+	}
+}
+
+func (o *AdaGrad) checkState(params []*layer.Parameter) error {
+	return o.sumSquares.check(params)
+}
+
+func (o *AdaGrad) LearningRate() float64        { return o.learningRate }
+func (o *AdaGrad) SetLearningRate(rate float64) { o.learningRate = rate }
+
+func (o *AdaGrad) MarshalBinary() ([]byte, error) {
+	var buf bytes.Buffer
+	w := codec.NewWriter(&buf)
+	w.Float(o.learningRate)
+	o.sumSquares.write(w)
+	return buf.Bytes(), w.Err()
+}
+
+func (o *AdaGrad) UnmarshalBinary(data []byte) error {
+	r := codec.NewReader(bytes.NewReader(data))
+	o.learningRate = r.Float()
+	o.sumSquares = readParameterState(r)
+	return r.Err()
+}
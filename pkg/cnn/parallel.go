@@ -0,0 +1,167 @@
+package cnn
+
+import (
+	"math/rand"
+	"runtime"
+	"sync"
+
+	"github.com/rubenwo/cnn-go/pkg/cnn/layer"
+	"github.com/rubenwo/cnn-go/pkg/cnn/maths"
+)
+
+// SetWorkers sets the number of goroutines Fit uses to train on a batch. The batch is divided in chunks of
+// consecutive examples whose gradients are accumulated separately, the workers train on the chunks concurrently
+// with the shared weights. The gradients of the chunks are added together in the order of the examples before the
+// weights are updated, so training gives identical results for any number of workers.
+// 0, the default, uses runtime.NumCPU() workers.
+func (n *Network) SetWorkers(workers int) {
+	if workers < 0 {
+		panic("workers must not be negative")
+	}
+	n.workers = workers
+}
+
+// gradientChunk is the number of consecutive examples of a batch whose gradients are accumulated together. It does
+// not depend on the number of workers, which would change the order in which the gradients are added.
+const gradientChunk = 8
+
+// accumulator holds the gradients accumulated over a chunk of consecutive examples of a batch
+type accumulator struct {
+	// grads has a tensor for every parameter of every layer, grads[i] are the gradients of n.layers[i]
+	grads [][]*maths.Tensor
+}
+
+// newAccumulators returns an accumulator for every chunk of a batch of batchSize examples
+func (n *Network) newAccumulators(batchSize int) []*accumulator {
+	accumulators := make([]*accumulator, (batchSize+gradientChunk-1)/gradientChunk)
+	for i := range accumulators {
+		a := &accumulator{grads: make([][]*maths.Tensor, len(n.layers))}
+		for j, l := range n.layers {
+			for _, p := range l.Parameters() {
+				a.grads[j] = append(a.grads[j], p.Gradient.Zeroes())
+			}
+		}
+		accumulators[i] = a
+	}
+	return accumulators
+}
+
+// workerCount returns the number of workers set with SetWorkers
+func (n *Network) workerCount() int {
+	if n.workers == 0 {
+		return runtime.NumCPU()
+	}
+	return n.workers
+}
+
+// trainBatch runs the forward and backward pass for inputs[batch[i]] and adds the gradients to the gradients of the
+// parameters. The batch passes through the layers one layer at a time: layers that implement layer.BatchLayer get
+// the whole batch, for the other layers the chunks of the batch are divided over the workers.
+// accumulators needs an accumulator for every chunk of the batch, see newAccumulators.
+// It returns the loss and whether the prediction was correct (1 or 0) for every example of the batch.
+func (n *Network) trainBatch(accumulators []*accumulator, inputs, labels []maths.Tensor, batch []int) (losses, corrects []float64) {
+	losses = make([]float64, len(batch))
+	corrects = make([]float64, len(batch))
+	workers := n.workerCount()
+
+	// Every example gets its own generator, seeded in order from the generator of the network, so the random
+	// numbers of stochastic layers do not depend on the worker that trains the example. They are only drawn if a
+	// layer needs them.
+	randoms := make([]*rand.Rand, len(batch))
+	for _, l := range n.layers {
+		if _, ok := l.(layer.Stochastic); ok {
+			for j := range randoms {
+				randoms[j] = rand.New(maths.NewSource(n.rng.Int63()))
+			}
+			break
+		}
+	}
+
+	outputs := make([]maths.Tensor, len(batch))
+	for j, i := range batch {
+		outputs[j] = inputs[i]
+	}
+	// caches[i] holds the cache of every example for layer i, or a single cache for a layer.BatchLayer
+	caches := make([][]layer.Cache, len(n.layers))
+	for i, l := range n.layers {
+		if b, ok := l.(layer.BatchLayer); ok {
+			var cache layer.Cache
+			outputs, cache = b.ForwardPropagationBatch(outputs, layer.Training)
+			caches[i] = []layer.Cache{cache}
+		} else {
+			caches[i] = make([]layer.Cache, len(batch))
+			forEachExample(workers, accumulators, len(batch), func(_ *accumulator, j int) {
+				outputs[j], caches[i][j] = forwardLayer(l, outputs[j], layer.Training, randoms[j])
+			})
+		}
+		// The state is updated in the order of the examples, after all of them have passed the layer
+		if s, ok := l.(layer.Stateful); ok {
+			for _, cache := range caches[i] {
+				s.UpdateState(cache)
+			}
+		}
+	}
+
+	// Use the loss as input for the backpropagation
+	gradients := make([]maths.Tensor, len(batch))
+	forEachExample(workers, accumulators, len(batch), func(_ *accumulator, j int) {
+		label, output := labels[batch[j]].Values(), outputs[j].Values()
+		gradients[j] = n.loss.CalculateLossDerivative(label, output)
+
+		lossTensor := n.loss.CalculateLoss(label, output)
+		losses[j] = maths.SumFloat64Slice(lossTensor.Values())
+		if maths.FindMaxIndexFloat64Slice(label) == maths.FindMaxIndexFloat64Slice(output) {
+			corrects[j] = 1
+		}
+	})
+
+	for i := len(n.layers) - 1; i >= 0; i-- {
+		l := n.layers[i]
+		if b, ok := l.(layer.BatchLayer); ok {
+			gradients = b.BackwardPropagationBatch(gradients, caches[i][0], accumulators[0].grads[i])
+			continue
+		}
+		forEachExample(workers, accumulators, len(batch), func(a *accumulator, j int) {
+			gradients[j] = l.BackwardPropagation(gradients[j], caches[i][j], a.grads[i])
+		})
+	}
+
+	// Reduce in the order of the chunks so the result depends neither on the number of workers nor on which worker
+	// finished first
+	for _, a := range accumulators[:(len(batch)+gradientChunk-1)/gradientChunk] {
+		for i, l := range n.layers {
+			for j, p := range l.Parameters() {
+				grad := a.grads[i][j]
+				p.Gradient.Apply(func(val float64, idx int) float64 { return val + grad.At(idx) })
+				grad.Apply(func(val float64, idx int) float64 { return 0 })
+			}
+		}
+	}
+	return losses, corrects
+}
+
+// forEachExample calls fn for examples 0 to count-1 with the accumulator of their chunk. The chunks are divided over
+// workers goroutines, the examples of a chunk are run one after the other by the same goroutine.
+func forEachExample(workers int, accumulators []*accumulator, count int, fn func(a *accumulator, j int)) {
+	chunks := (count + gradientChunk - 1) / gradientChunk
+	if workers > chunks {
+		workers = chunks
+	}
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for c := w; c < chunks; c += workers {
+				end := (c + 1) * gradientChunk
+				if end > count {
+					end = count
+				}
+				for j := c * gradientChunk; j < end; j++ {
+					fn(accumulators[c], j)
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+}
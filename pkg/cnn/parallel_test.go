@@ -0,0 +1,35 @@
+package cnn
+
+import (
+	"context"
+	"testing"
+
+	"github.com/rubenwo/cnn-go/pkg/cnn/metrics"
+)
+
+func TestTrainingDoesNotDependOnWorkers(t *testing.T) {
+	inputs, labels := testData(50)
+	train := func(workers int) *Network {
+		n := New([]int{8, 8}, NewMomentumSGD(0.05, 0.9, false), &metrics.CrossEntropyLoss{}, WithSeed(3))
+		n.AddConvolutionLayer([]int{3, 3}, 4).AddBatchNormLayer().AddReLULayer().AddDropoutLayer(0.2).
+			AddFullyConnectedLayer(4).AddSoftmaxLayer()
+		n.SetWorkers(workers)
+		// 50 examples in batches of 20 give chunks that are only partly filled
+		if _, err := n.Fit(context.Background(), inputs, labels, nil, nil, 2, 20, 0); err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+
+	want := train(1).parameters()
+	for _, workers := range []int{2, 3, 16} {
+		got := train(workers).parameters()
+		for i, p := range got {
+			for j, v := range p.Value.Values() {
+				if w := want[i].Value.At(j); v != w {
+					t.Fatalf("%d workers: value %d of parameter %d is %v, with 1 worker %v", workers, j, i, v, w)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,357 @@
+package cnn
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/rubenwo/cnn-go/pkg/cnn/internal/codec"
+	"math"
+)
+
+// Interval determines how often Fit steps a Scheduler.
+type Interval int
+
+const (
+	EveryEpoch Interval = iota
+	EveryBatch
+)
+
+// ScheduleState describes the progress of training at the moment a Scheduler is stepped.
+type ScheduleState struct {
+	Epoch int // the number of completed epochs
+	Batch int // the number of completed batches, counted over all epochs
+
+	// TrainingLoss is the average loss over the current epoch so far
+	TrainingLoss float64
+	// ValidationLoss is only set when Validated is true, which happens at the end of an epoch
+	// when Fit is given validation data.
+	ValidationLoss float64
+	Validated      bool
+}
+
+// Scheduler determines the learning rate of the optimizer during Fit.
+// Fit sets the learning rate to LearningRate() before training starts and after every call to Step.
+// Schedulers that implement encoding.BinaryMarshaler and encoding.BinaryUnmarshaler have their state
+// stored in checkpoints.
+type Scheduler interface {
+	// Interval returns whether the scheduler is stepped after every batch or after every epoch.
+	Interval() Interval
+	// Step advances the scheduler by one batch or epoch.
+	Step(state ScheduleState)
+	// LearningRate returns the learning rate for the current step.
+	LearningRate() float64
+}
+
+// monitoredLoss returns the loss a scheduler should react to: validation loss if available, training loss otherwise.
+func (s ScheduleState) monitoredLoss() float64 {
+	if s.Validated {
+		return s.ValidationLoss
+	}
+	return s.TrainingLoss
+}
+
+// StepDecay multiplies the learning rate by gamma every stepSize steps.
+type StepDecay struct {
+	interval Interval
+	baseRate float64
+	gamma    float64
+	stepSize int
+
+	step int
+}
+
+func NewStepDecay(interval Interval, baseRate, gamma float64, stepSize int) *StepDecay {
+	if stepSize < 1 {
+		panic("stepSize must be at least 1")
+	}
+	return &StepDecay{interval: interval, baseRate: baseRate, gamma: gamma, stepSize: stepSize}
+}
+
+func (s *StepDecay) Interval() Interval       { return s.interval }
+func (s *StepDecay) Step(state ScheduleState) { s.step++ }
+func (s *StepDecay) LearningRate() float64 {
+	return s.baseRate * math.Pow(s.gamma, float64(s.step/s.stepSize))
+}
+
+func (s *StepDecay) MarshalBinary() ([]byte, error) {
+	var buf bytes.Buffer
+	w := codec.NewWriter(&buf)
+	w.Int(s.step)
+	return buf.Bytes(), w.Err()
+}
+
+func (s *StepDecay) UnmarshalBinary(data []byte) error {
+	r := codec.NewReader(bytes.NewReader(data))
+	s.step = r.Int()
+	return r.Err()
+}
+
+// ExponentialDecay multiplies the learning rate by gamma every step.
+type ExponentialDecay struct {
+	interval Interval
+	baseRate float64
+	gamma    float64
+
+	step int
+}
+
+func NewExponentialDecay(interval Interval, baseRate, gamma float64) *ExponentialDecay {
+	return &ExponentialDecay{interval: interval, baseRate: baseRate, gamma: gamma}
+}
+
+func (s *ExponentialDecay) Interval() Interval       { return s.interval }
+func (s *ExponentialDecay) Step(state ScheduleState) { s.step++ }
+func (s *ExponentialDecay) LearningRate() float64 {
+	return s.baseRate * math.Pow(s.gamma, float64(s.step))
+}
+
+func (s *ExponentialDecay) MarshalBinary() ([]byte, error) {
+	var buf bytes.Buffer
+	w := codec.NewWriter(&buf)
+	w.Int(s.step)
+	return buf.Bytes(), w.Err()
+}
+
+func (s *ExponentialDecay) UnmarshalBinary(data []byte) error {
+	r := codec.NewReader(bytes.NewReader(data))
+	s.step = r.Int()
+	return r.Err()
+}
+
+// CosineAnnealing anneals the learning rate from baseRate to minRate following a half cosine over period steps,
+// after which it restarts at baseRate (SGDR: "Stochastic Gradient Descent with Warm Restarts", Loshchilov & Hutter).
+// After every restart the period is multiplied by periodMultiplier. A periodMultiplier of 1 keeps the period constant.
+type CosineAnnealing struct {
+	interval         Interval
+	baseRate         float64
+	minRate          float64
+	periodMultiplier float64
+
+	period    int // length of the current cycle
+	cycleStep int // step within the current cycle
+}
+
+func NewCosineAnnealing(interval Interval, baseRate, minRate float64, period int, periodMultiplier float64) *CosineAnnealing {
+	if period < 1 {
+		panic("period must be at least 1")
+	}
+	if periodMultiplier < 1 {
+		panic("periodMultiplier must be at least 1")
+	}
+	return &CosineAnnealing{
+		interval:         interval,
+		baseRate:         baseRate,
+		minRate:          minRate,
+		periodMultiplier: periodMultiplier,
+		period:           period,
+	}
+}
+
+func (s *CosineAnnealing) Interval() Interval { return s.interval }
+func (s *CosineAnnealing) Step(state ScheduleState) {
+	s.cycleStep++
+	if s.cycleStep >= s.period {
+		// warm restart
+		s.cycleStep = 0
+		s.period = int(math.Round(float64(s.period) * s.periodMultiplier))
+	}
+}
+func (s *CosineAnnealing) LearningRate() float64 {
+	progress := float64(s.cycleStep) / float64(s.period)
+	return s.minRate + (s.baseRate-s.minRate)*(1+math.Cos(math.Pi*progress))/2
+}
+
+func (s *CosineAnnealing) MarshalBinary() ([]byte, error) {
+	var buf bytes.Buffer
+	w := codec.NewWriter(&buf)
+	w.Int(s.period)
+	w.Int(s.cycleStep)
+	return buf.Bytes(), w.Err()
+}
+
+func (s *CosineAnnealing) UnmarshalBinary(data []byte) error {
+	r := codec.NewReader(bytes.NewReader(data))
+	s.period = r.Int()
+	s.cycleStep = r.Int()
+	return r.Err()
+}
+
+// LinearWarmup increases the learning rate linearly to the learning rate of the wrapped scheduler during the first
+// warmupSteps steps. After the warmup the wrapped scheduler takes over and is stepped as usual.
+type LinearWarmup struct {
+	after       Scheduler
+	warmupSteps int
+
+	step int
+}
+
+func NewLinearWarmup(warmupSteps int, after Scheduler) *LinearWarmup {
+	return &LinearWarmup{after: after, warmupSteps: warmupSteps}
+}
+
+func (s *LinearWarmup) Interval() Interval { return s.after.Interval() }
+func (s *LinearWarmup) Step(state ScheduleState) {
+	if s.step < s.warmupSteps {
+		s.step++
+		return
+	}
+	s.after.Step(state)
+}
+func (s *LinearWarmup) LearningRate() float64 {
+	if s.step < s.warmupSteps {
+		return s.after.LearningRate() * float64(s.step+1) / float64(s.warmupSteps+1)
+	}
+	return s.after.LearningRate()
+}
+
+func (s *LinearWarmup) MarshalBinary() ([]byte, error) {
+	after, err := marshalOptional(s.after)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	w := codec.NewWriter(&buf)
+	w.Int(s.step)
+	w.Bytes(after)
+	return buf.Bytes(), w.Err()
+}
+
+func (s *LinearWarmup) UnmarshalBinary(data []byte) error {
+	r := codec.NewReader(bytes.NewReader(data))
+	s.step = r.Int()
+	after := r.Bytes()
+	if err := r.Err(); err != nil {
+		return err
+	}
+	return unmarshalOptional(s.after, after)
+}
+
+// OneCycle implements the 1cycle policy ("Super-Convergence", Smith & Topin): the learning rate is annealed from
+// maxRate/divFactor up to maxRate during the first warmupFraction of totalSteps and then down to
+// maxRate/(divFactor*finalDivFactor) at the end, both following a half cosine.
+// It is usually stepped EveryBatch with totalSteps = epochs * batches per epoch. warmupFraction has to be in [0, 1],
+// divFactor and finalDivFactor have to be positive.
+type OneCycle struct {
+	interval       Interval
+	maxRate        float64
+	totalSteps     int
+	warmupFraction float64
+	divFactor      float64
+	finalDivFactor float64
+
+	step int
+}
+
+func NewOneCycle(interval Interval, maxRate float64, totalSteps int, warmupFraction, divFactor, finalDivFactor float64) *OneCycle {
+	if totalSteps < 1 {
+		panic("totalSteps must be at least 1")
+	}
+	if warmupFraction < 0 || warmupFraction > 1 {
+		panic(fmt.Sprintf("warmupFraction %g is not in [0, 1]", warmupFraction))
+	}
+	if divFactor <= 0 || finalDivFactor <= 0 {
+		panic("divFactor and finalDivFactor must be positive")
+	}
+	return &OneCycle{
+		interval:       interval,
+		maxRate:        maxRate,
+		totalSteps:     totalSteps,
+		warmupFraction: warmupFraction,
+		divFactor:      divFactor,
+		finalDivFactor: finalDivFactor,
+	}
+}
+
+func (s *OneCycle) Interval() Interval       { return s.interval }
+func (s *OneCycle) Step(state ScheduleState) { s.step++ }
+func (s *OneCycle) LearningRate() float64 {
+	cosineAnneal := func(from, to, progress float64) float64 {
+		return to + (from-to)*(1+math.Cos(math.Pi*math.Min(progress, 1)))/2
+	}
+	initialRate := s.maxRate / s.divFactor
+	finalRate := initialRate / s.finalDivFactor
+
+	warmupSteps := s.warmupFraction * float64(s.totalSteps)
+	if float64(s.step) < warmupSteps {
+		return cosineAnneal(initialRate, s.maxRate, float64(s.step)/warmupSteps)
+	}
+	annealSteps := float64(s.totalSteps) - warmupSteps
+	if annealSteps <= 0 {
+		// warmupFraction is 1, there is no annealing phase and the cycle has ended
+		return finalRate
+	}
+	return cosineAnneal(s.maxRate, finalRate, (float64(s.step)-warmupSteps)/annealSteps)
+}
+
+func (s *OneCycle) MarshalBinary() ([]byte, error) {
+	var buf bytes.Buffer
+	w := codec.NewWriter(&buf)
+	w.Int(s.step)
+	return buf.Bytes(), w.Err()
+}
+
+func (s *OneCycle) UnmarshalBinary(data []byte) error {
+	r := codec.NewReader(bytes.NewReader(data))
+	s.step = r.Int()
+	return r.Err()
+}
+
+// ReduceOnPlateau multiplies the learning rate by factor when the monitored loss has not improved by more than
+// minDelta for patience consecutive epochs, with patience 0 at every epoch that does not improve the loss. The
+// validation loss is monitored when Fit is given validation data, the training loss otherwise. The learning rate is
+// never reduced below minRate.
+type ReduceOnPlateau struct {
+	factor   float64
+	patience int
+	minDelta float64
+	minRate  float64
+
+	rate     float64
+	bestLoss float64
+	wait     int
+}
+
+func NewReduceOnPlateau(baseRate, factor float64, patience int, minDelta, minRate float64) *ReduceOnPlateau {
+	return &ReduceOnPlateau{
+		factor:   factor,
+		patience: patience,
+		minDelta: minDelta,
+		minRate:  minRate,
+		rate:     baseRate,
+		bestLoss: math.Inf(1),
+	}
+}
+
+// Interval is always EveryEpoch, the validation loss is only known at the end of an epoch.
+func (s *ReduceOnPlateau) Interval() Interval { return EveryEpoch }
+func (s *ReduceOnPlateau) Step(state ScheduleState) {
+	loss := state.monitoredLoss()
+	if loss < s.bestLoss-s.minDelta {
+		s.bestLoss = loss
+		s.wait = 0
+		return
+	}
+
+	s.wait++
+	if s.wait >= s.patience {
+		s.rate = math.Max(s.rate*s.factor, s.minRate)
+		s.wait = 0
+	}
+}
+func (s *ReduceOnPlateau) LearningRate() float64 { return s.rate }
+
+func (s *ReduceOnPlateau) MarshalBinary() ([]byte, error) {
+	var buf bytes.Buffer
+	w := codec.NewWriter(&buf)
+	w.Float(s.rate)
+	w.Float(s.bestLoss)
+	w.Int(s.wait)
+	return buf.Bytes(), w.Err()
+}
+
+func (s *ReduceOnPlateau) UnmarshalBinary(data []byte) error {
+	r := codec.NewReader(bytes.NewReader(data))
+	s.rate = r.Float()
+	s.bestLoss = r.Float()
+	s.wait = r.Int()
+	return r.Err()
+}
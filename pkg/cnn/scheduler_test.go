@@ -0,0 +1,53 @@
+package cnn
+
+import (
+	"math"
+	"testing"
+)
+
+func TestOneCycleLearningRate(t *testing.T) {
+	for _, warmupFraction := range []float64{0, 0.3, 1} {
+		s := NewOneCycle(EveryBatch, 1, 10, warmupFraction, 10, 100)
+		for step := 0; step <= 10; step++ {
+			rate := s.LearningRate()
+			if math.IsNaN(rate) || rate < 0.001 || rate > 1 {
+				t.Errorf("warmupFraction %g, step %d: learning rate %g", warmupFraction, step, rate)
+			}
+			s.Step(ScheduleState{})
+		}
+		if rate := s.LearningRate(); math.Abs(rate-0.001) > 1e-12 {
+			t.Errorf("warmupFraction %g: final learning rate %g, want 0.001", warmupFraction, rate)
+		}
+	}
+}
+
+func TestNewOneCycleRejectsInvalidArguments(t *testing.T) {
+	tests := []struct {
+		warmupFraction, divFactor, finalDivFactor float64
+	}{
+		{-0.1, 10, 100},
+		{1.1, 10, 100},
+		{0.3, 0, 100},
+		{0.3, 10, 0},
+	}
+	for _, test := range tests {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("NewOneCycle(%g, %g, %g) did not panic", test.warmupFraction, test.divFactor, test.finalDivFactor)
+				}
+			}()
+			NewOneCycle(EveryBatch, 1, 10, test.warmupFraction, test.divFactor, test.finalDivFactor)
+		}()
+	}
+}
+
+func TestReduceOnPlateauPatience(t *testing.T) {
+	s := NewReduceOnPlateau(1, 0.5, 1, 0, 0)
+	for _, loss := range []float64{3, 2, 2} {
+		s.Step(ScheduleState{TrainingLoss: loss})
+	}
+	if rate := s.LearningRate(); rate != 0.5 {
+		t.Errorf("learning rate %g after one epoch without improvement, want 0.5", rate)
+	}
+}